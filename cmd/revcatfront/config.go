@@ -65,38 +65,60 @@ type Login struct {
 	Issuer       string               `toml:"issuer"`
 }
 
+type EmbeddingConfig struct {
+	Provider  string               `toml:"provider"`
+	URL       string               `toml:"url"`
+	APIKey    configutil.EnvString `toml:"apikey"`
+	Model     string               `toml:"model"`
+	CacheDir  string               `toml:"cachedir"`
+	CacheSize int                  `toml:"cachesize"`
+}
+
+type FeedConfig struct {
+	CacheDir  string              `toml:"cachedir"`
+	CacheSize int                 `toml:"cachesize"`
+	CacheTTL  configutil.Duration `toml:"cachettl"`
+}
+
 type RevCatFrontConfig struct {
-	Name                string                  `toml:"name"`
-	LocalAddr           string                  `toml:"localaddr"`
-	ExternalAddr        string                  `toml:"externaladdr"`
-	SearchAddr          string                  `toml:"searchaddr"`
-	DetailAddr          string                  `toml:"detailaddr"`
-	FacetInclude        []string                `toml:"facetinclude"`
-	FacetExclude        []string                `toml:"facetexclude"`
-	TLSCert             string                  `toml:"tlscert"`
-	TLSKey              string                  `toml:"tlskey"`
-	ProtoHTTP           bool                    `toml:"protohttp"`
-	Auth                []*AuthConfig           `toml:"auth"`
-	OpenAIApiKey        configutil.EnvString    `toml:"openaiapikey"`
-	Templates           string                  `toml:"templates"`
-	StaticFiles         string                  `toml:"staticfiles"`
-	Locale              LocaleConfig            `toml:"locale"`
-	LogFile             string                  `toml:"logfile"`
-	LogLevel            string                  `toml:"loglevel"`
-	Revcat              RevcatConfig            `toml:"revcat"`
-	Directus            Directus                `toml:"directus"`
-	ZoomOnly            bool                    `toml:"zoomonly"`
-	MediaserverBase     string                  `toml:"mediaserverbase"`
-	MediaserverTokenExp configutil.Duration     `toml:"mediaservertokenexp"`
-	MediaserverKey      configutil.EnvString    `toml:"mediaserverkey"`
-	DataDir             string                  `toml:"datadir"`
-	Collections         []*server.CollFacetType `toml:"collections"`
-	FieldMapping        map[string]string       `toml:"fieldmapping"`
-	JWTKey              configutil.EnvString    `toml:"jwtkey"`
-	JWTAlg              string                  `toml:"jwtalg"`
-	Login               Login                   `toml:"login"`
-	Locations           []Network               `toml:"locations"`
-	Mode                string                  `toml:"mode"`
+	Name                string                          `toml:"name"`
+	LocalAddr           string                          `toml:"localaddr"`
+	ExternalAddr        string                          `toml:"externaladdr"`
+	SearchAddr          string                          `toml:"searchaddr"`
+	DetailAddr          string                          `toml:"detailaddr"`
+	FacetInclude        []string                        `toml:"facetinclude"`
+	FacetExclude        []string                        `toml:"facetexclude"`
+	TLSCert             string                          `toml:"tlscert"`
+	TLSKey              string                          `toml:"tlskey"`
+	ProtoHTTP           bool                            `toml:"protohttp"`
+	Auth                []*AuthConfig                   `toml:"auth"`
+	OpenAIApiKey        configutil.EnvString            `toml:"openaiapikey"`
+	Embedding           EmbeddingConfig                 `toml:"embedding"`
+	Feed                FeedConfig                      `toml:"feed"`
+	HybridWeight        float64                         `toml:"hybridweight"`
+	HybridWindow        int64                           `toml:"hybridwindow"`
+	Templates           string                          `toml:"templates"`
+	StaticFiles         string                          `toml:"staticfiles"`
+	Locale              LocaleConfig                    `toml:"locale"`
+	LogFile             string                          `toml:"logfile"`
+	LogLevel            string                          `toml:"loglevel"`
+	Revcat              RevcatConfig                    `toml:"revcat"`
+	Directus            Directus                        `toml:"directus"`
+	ZoomOnly            bool                            `toml:"zoomonly"`
+	MediaserverBase     string                          `toml:"mediaserverbase"`
+	MediaserverTokenExp configutil.Duration             `toml:"mediaservertokenexp"`
+	MediaserverKey      configutil.EnvString            `toml:"mediaserverkey"`
+	DataDir             string                          `toml:"datadir"`
+	Collections         []*server.CollFacetType         `toml:"collections"`
+	FieldMapping        map[string]*server.FieldMapping `toml:"fieldmapping"`
+	Facets              []*server.FacetConfig           `toml:"facets"`
+	Sort                []*server.SortOption            `toml:"sort"`
+	OAI                 *server.OAIConfig               `toml:"oai"`
+	JWTKey              configutil.EnvString            `toml:"jwtkey"`
+	JWTAlg              string                          `toml:"jwtalg"`
+	Login               Login                           `toml:"login"`
+	Locations           []Network                       `toml:"locations"`
+	Mode                string                          `toml:"mode"`
 }
 
 func LoadRevCatFrontConfig(fSys fs.FS, fp string, conf *RevCatFrontConfig) error {
@@ -23,6 +23,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/Yamashou/gqlgenc/clientv2"
 	"github.com/bluele/gcache"
+	"github.com/dgraph-io/badger/v4"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/je4/ink3/v2/config"
 	"github.com/je4/ink3/v2/data/certs"
@@ -35,6 +36,7 @@ import (
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/rs/zerolog"
+	oai "github.com/sashabaranov/go-openai"
 	"golang.org/x/text/language"
 )
 
@@ -74,6 +76,12 @@ func main() {
 		FacetInclude: []string{"voc:.*"},
 		Name:         "performance",
 		Mode:         "auto",
+		HybridWeight: 0.5,
+		HybridWindow: 100,
+		Embedding: EmbeddingConfig{
+			Model:     string(oai.SmallEmbedding3),
+			CacheSize: 256,
+		},
 	}
 
 	if err := LoadRevCatFrontConfig(cfgFS, cfgFile, conf); err != nil {
@@ -173,12 +181,50 @@ func main() {
 		staticFS = static.FS
 	}
 
-	var embeddings *openai.ClientV2
-	if string(conf.OpenAIApiKey) != "" {
-		kv := openai.NewKVGCache(gcache.New(256).LRU().Build())
-		embeddings = openai.NewClientV2(string(conf.OpenAIApiKey), kv, logger)
+	// openaiapikey without embedding section selects openai
+	if conf.Embedding.Provider == "" && conf.OpenAIApiKey != "" {
+		conf.Embedding.Provider = "openai"
+	}
+	if conf.Embedding.APIKey == "" {
+		conf.Embedding.APIKey = conf.OpenAIApiKey
+	}
+	var embeddings server.EmbeddingProvider
+	if conf.Embedding.Provider != "" {
+		var kv openai.KVStore = openai.NewKVGCache(gcache.New(conf.Embedding.CacheSize).LRU().Build())
+		if conf.Embedding.CacheDir != "" {
+			db, err := badger.Open(badger.DefaultOptions(conf.Embedding.CacheDir).WithLogger(nil))
+			if err != nil {
+				logger.Fatal().Msgf("cannot open embedding cache %s: %v", conf.Embedding.CacheDir, err)
+			}
+			defer db.Close()
+			kv = server.NewEmbeddingCache(kv, openai.NewKVBadger(db))
+		}
+		var oaiConfig oai.ClientConfig
+		switch conf.Embedding.Provider {
+		case "openai":
+			oaiConfig = oai.DefaultConfig(string(conf.Embedding.APIKey))
+		case "local":
+			if conf.Embedding.URL == "" {
+				logger.Fatal().Msgf("no url for local embedding provider")
+			}
+			oaiConfig = oai.DefaultConfig(string(conf.Embedding.APIKey))
+			oaiConfig.BaseURL = conf.Embedding.URL
+		default:
+			logger.Fatal().Msgf("unknown embedding provider '%s'", conf.Embedding.Provider)
+		}
+		embeddings = server.NewOpenAIEmbeddings(oaiConfig, conf.Embedding.Model, kv, logger)
 	}
 
+	var feedDB *badger.DB
+	if conf.Feed.CacheDir != "" {
+		feedDB, err = badger.Open(badger.DefaultOptions(conf.Feed.CacheDir).WithLogger(nil))
+		if err != nil {
+			logger.Fatal().Msgf("cannot open feed cache %s: %v", conf.Feed.CacheDir, err)
+		}
+		defer feedDB.Close()
+	}
+	feedTimes := server.NewFeedTimes(feedDB, conf.Feed.CacheSize, time.Duration(conf.Feed.CacheTTL))
+
 	if conf.Revcat.Insecure {
 		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
@@ -242,6 +288,15 @@ func main() {
 		}
 	}
 
+	// facetinclude and facetexclude configure the vocabulary facet of the default facets
+	facets := conf.Facets
+	if len(facets) == 0 {
+		facets = server.DefaultFacets(conf.FacetInclude, conf.FacetExclude)
+	}
+	sortOptions := conf.Sort
+	if len(sortOptions) == 0 {
+		sortOptions = server.DefaultSortOptions()
+	}
 	ctrl, err := server.NewController(
 		conf.LocalAddr,
 		conf.ExternalAddr,
@@ -262,6 +317,9 @@ func main() {
 		conf.Collections,
 		conf.FieldMapping,
 		embeddings,
+		feedTimes,
+		conf.HybridWeight,
+		conf.HybridWindow,
 		conf.Templates != "",
 		conf.ZoomOnly,
 		conf.Login.URL,
@@ -269,8 +327,9 @@ func main() {
 		string(conf.Login.JWTKey),
 		conf.Login.JWTAlg,
 		locations,
-		conf.FacetInclude,
-		conf.FacetExclude,
+		facets,
+		sortOptions,
+		conf.OAI,
 		conf.Mode,
 		logger)
 	if err != nil {
@@ -1,7 +1,19 @@
 const removePrefix = (value, prefix) =>
     value.startsWith(prefix) ? value.slice(prefix.length) : value;
 
-function search(url, cursor, exhibition, ki, sortField, sortOrder) {
+// selected facet values are kept as they are, excluded values get a minus sign
+const facetValue = (button) => {
+    if (button.getAttribute("selected") === "true") {
+        return button.getAttribute("value");
+    }
+    if (button.getAttribute("excluded") === "true") {
+        return "-" + button.getAttribute("value");
+    }
+    return null;
+};
+
+// sort and sortOrder default to the current sort of the page
+function search(url, cursor, exhibition, ki, sort, sortOrder) {
     let search = document.getElementById("search").value;
 
     const params = new URLSearchParams({
@@ -22,8 +34,9 @@ function search(url, cursor, exhibition, ki, sortField, sortOrder) {
     let colls = document.getElementsByClassName("collectionButton")
     let collParam = "";
     for (let i = 0; i < colls.length; i++) {
-        if (colls[i].getAttribute("selected") === "true") {
-            collParam += colls[i].getAttribute("value") + ",";
+        const value = facetValue(colls[i]);
+        if (value !== null) {
+            collParam += value + ",";
         }
     }
     if ( colls.length == 0 ){
@@ -43,20 +56,225 @@ function search(url, cursor, exhibition, ki, sortField, sortOrder) {
     let vocs = document.getElementsByClassName("vocButton")
     let vocParam = "";
     for (let i = 0; i < vocs.length; i++) {
-        if (vocs[i].getAttribute("selected") === "true") {
-            let value = vocs[i].getAttribute("value");
-            value = removePrefix(value, "voc:generic:");
-            vocParam += value + ",";
+        const value = facetValue(vocs[i]);
+        if (value !== null) {
+            if (value.startsWith("-")) {
+                vocParam += "-" + removePrefix(value.slice(1), "voc:generic:") + ",";
+            } else {
+                vocParam += removePrefix(value, "voc:generic:") + ",";
+            }
         }
     }
     if ( vocs.length > 0 ){
         params.set("vocabulary", vocParam);
     }
-    if (sortField !== undefined && sortField !== "") {
-        params.set("sortField", sortField);
+
+    let dates = document.getElementsByClassName("dateButton")
+    let dateParam = "";
+    for (let i = 0; i < dates.length; i++) {
+        if (dates[i].getAttribute("selected") === "true") {
+            dateParam += dates[i].getAttribute("value") + ",";
+        }
+    }
+    if (dateParam !== "") {
+        params.set("dates", dateParam);
+    }
+
+    // term facets, the values may contain commas
+    let facets = document.getElementsByClassName("facetButton")
+    for (let i = 0; i < facets.length; i++) {
+        const value = facetValue(facets[i]);
+        if (value !== null) {
+            params.append(facets[i].dataset.param, value);
+        }
+    }
+    // a new search starts with the first page, the page size is kept
+    const size = document.getElementById("size");
+    if (size !== null && size.value !== "") {
+        params.set("size", size.value);
+    }
+    const bbox = document.getElementById("bbox");
+    if (bbox !== null && bbox.value !== "") {
+        params.set("bbox", bbox.value);
+    }
+    let expand = document.getElementById("expand");
+    if (expand !== null && expand.value !== "") {
+        params.set("expand", expand.value);
+    }
+    if (sort === undefined) {
+        const sortInput = document.getElementById("sort");
+        const sortOrderInput = document.getElementById("sortOrder");
+        sort = sortInput !== null ? sortInput.value : "";
+        sortOrder = sortOrderInput !== null ? sortOrderInput.value : "";
+    }
+    if (sort !== "" && sort !== "relevance") {
+        params.set("sort", sort);
         if (sortOrder !== undefined && sortOrder !== "") {
             params.set("sortOrder", sortOrder);
         }
     }
     window.location.href = url + "?" + params.toString();
-}
\ No newline at end of file
+}
+// zooms the map into the clicked position.
+// The map element contains zoom level and upper left corner of the web mercator projection
+function zoomMap(event, query) {
+    const map = event.currentTarget;
+    const zoom = parseInt(map.dataset.zoom, 10) + 1;
+    const worldSize = 256 * Math.pow(2, zoom);
+    const rect = map.getBoundingClientRect();
+    const x = (parseFloat(map.dataset.left) + event.clientX - rect.left) * 2;
+    const y = (parseFloat(map.dataset.top) + event.clientY - rect.top) * 2;
+    const dx = parseFloat(map.dataset.width) * 0.4;
+    const dy = parseFloat(map.dataset.height) * 0.4;
+    const lon = (px) => Math.max(-180, Math.min(180, px / worldSize * 360 - 180));
+    const lat = (py) => Math.max(-85.0511, Math.min(85.0511, Math.atan(Math.sinh(Math.PI * (1 - 2 * py / worldSize))) * 180 / Math.PI));
+    const bbox = [lon(x - dx), lat(y + dy), lon(x + dx), lat(y - dy)].map(v => v.toFixed(4));
+    window.location.href = "?" + query + "bbox=" + bbox.join(",");
+}
+
+// toggles the expand state of a vocabulary node, which is kept in the url
+function toggleExpand(id) {
+    const input = document.getElementById("expand");
+    let ids = input.value.split(",").filter(v => v !== "");
+    if (ids.includes(id)) {
+        ids = ids.filter(v => v !== id);
+    } else {
+        ids.push(id);
+    }
+    input.value = ids.join(",");
+}
+
+// type-ahead for the search field
+// the suggestion replaces the word at the cursor
+function initSuggest(url) {
+    const input = document.getElementById("search");
+    if (input === null) {
+        return;
+    }
+    const list = document.createElement("ul");
+    list.className = "dropdown-menu";
+    list.style.top = "100%";
+    list.style.left = "0";
+    input.parentElement.classList.add("position-relative");
+    input.parentElement.appendChild(list);
+
+    let timer = null;
+    let active = -1;
+
+    const currentWord = () => {
+        const text = input.value.substring(0, input.selectionStart);
+        let start = text.length;
+        let quoted = (text.split("\"").length - 1) % 2 === 1;
+        while (start > 0) {
+            const c = text.charAt(start - 1);
+            if (c === "\"") {
+                quoted = !quoted;
+            } else if (c === " " && !quoted) {
+                break;
+            }
+            start--;
+        }
+        return {start: start, end: input.selectionStart, word: text.substring(start)};
+    };
+    const hide = () => {
+        list.classList.remove("show");
+        list.innerHTML = "";
+        active = -1;
+    };
+    const apply = (insert) => {
+        const cw = currentWord();
+        const before = input.value.substring(0, cw.start);
+        const after = input.value.substring(cw.end);
+        input.value = before + insert + " " + after.trimStart();
+        const pos = before.length + insert.length + 1;
+        input.setSelectionRange(pos, pos);
+        hide();
+        input.focus();
+    };
+    const highlight = (index) => {
+        const items = list.getElementsByClassName("dropdown-item");
+        for (let i = 0; i < items.length; i++) {
+            items[i].classList.toggle("active", i === index);
+        }
+        active = index;
+    };
+    const show = (suggestions) => {
+        list.innerHTML = "";
+        active = -1;
+        if (suggestions.length === 0) {
+            hide();
+            return;
+        }
+        for (const s of suggestions) {
+            const li = document.createElement("li");
+            const a = document.createElement("a");
+            a.className = "dropdown-item d-flex justify-content-between";
+            a.href = "#";
+            a.dataset.insert = s.insert;
+            const label = document.createElement("span");
+            label.textContent = (s.field !== "" ? s.field + ": " : "") + s.label;
+            const count = document.createElement("span");
+            count.className = "ms-3 opacity-50";
+            count.textContent = s.count;
+            a.append(label, count);
+            a.addEventListener("mousedown", (event) => {
+                event.preventDefault();
+                apply(s.insert);
+            });
+            li.appendChild(a);
+            list.appendChild(li);
+        }
+        list.classList.add("show");
+    };
+
+    input.addEventListener("input", () => {
+        clearTimeout(timer);
+        const word = currentWord().word.replace(/^-/, "");
+        // do not complete field values
+        if (word.length < 2 || word.includes(":")) {
+            hide();
+            return;
+        }
+        timer = setTimeout(() => {
+            fetch(url + "?" + new URLSearchParams({q: word}).toString())
+                .then((response) => response.ok ? response.json() : [])
+                .then(show)
+                .catch(hide);
+        }, 200);
+    });
+    input.addEventListener("keydown", (event) => {
+        const items = list.getElementsByClassName("dropdown-item");
+        if (!list.classList.contains("show") || items.length === 0) {
+            return;
+        }
+        switch (event.key) {
+            case "ArrowDown":
+                event.preventDefault();
+                highlight((active + 1) % items.length);
+                break;
+            case "ArrowUp":
+                event.preventDefault();
+                highlight((active + items.length - 1) % items.length);
+                break;
+            case "Enter":
+                if (active >= 0) {
+                    event.preventDefault();
+                    input.suggestTaken = true;
+                    apply(items[active].dataset.insert);
+                }
+                break;
+            case "Escape":
+                hide();
+                break;
+        }
+    });
+    input.addEventListener("blur", hide);
+}
+
+// suggestionTaken is true, if the last enter key selected a suggestion instead of starting the search
+function suggestionTaken() {
+    const input = document.getElementById("search");
+    const taken = input.suggestTaken === true;
+    input.suggestTaken = false;
+    return taken;
+}
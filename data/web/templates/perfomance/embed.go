@@ -6,5 +6,5 @@ import "embed"
 //go:embed footer.gohtml detail_text.gotmpl detail.gohtml detail_image.gohtml
 //go:embed detail_pdf_pdfjs.gohtml detail_video.gohtml detail_audio.gohtml zoom.gohtml detail_pdf_dflip.gohtml
 //go:embed detail_verovio.gohtml detail_webrecorder.gohtml detail_epub_foliate.gohtml
-//go:embed impressum.gohtml kontakt.gohtml
+//go:embed impressum.gohtml kontakt.gohtml collection.gohtml
 var FS embed.FS
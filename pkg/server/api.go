@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/je4/zsearch/v2/pkg/translate"
+)
+
+type apiSearchEdge struct {
+	Signature  string                        `json:"signature"`
+	Title      string                        `json:"title"`
+	Date       string                        `json:"date"`
+	Type       string                        `json:"type"`
+	PersonRole map[string][]string           `json:"personRole"`
+	Base       *client.MediathekBaseFragment `json:"base"`
+}
+
+type apiSearchResult struct {
+	TotalCount int                      `json:"totalCount"`
+	PageInfo   *client.PageInfoFragment `json:"pageInfo"`
+	Pagination *pagination              `json:"pagination"`
+	QueryError string                   `json:"queryError,omitempty"`
+	Sort       string                   `json:"sort"`
+	SortOrder  string                   `json:"sortOrder,omitempty"`
+	Edges      []*apiSearchEdge         `json:"edges"`
+	*searchFacets
+}
+
+// localTitle returns the title in lang or in the original language
+func localTitle(title *translate.MultiLangString, lang string) string {
+	if str := title.GetStr(lang); str != "" {
+		return str
+	}
+	return title.String()
+}
+
+// searchAPI returns the result of the search page as json
+func (ctrl *Controller) searchAPI(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	params, err := requestSearchParams(c)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msg("cannot read search parameters")
+		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("cannot read search parameters: %v", err))
+		return
+	}
+	sr, err := ctrl.search(c, params)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", params.Search)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", params.Search, err))
+		return
+	}
+	result := &apiSearchResult{
+		TotalCount:   int(sr.Result.GetSearch().GetTotalCount()),
+		PageInfo:     sr.pageInfo(),
+		Pagination:   sr.Pagination,
+		QueryError:   sr.QueryError,
+		Sort:         sr.Sort,
+		SortOrder:    sr.SortOrder,
+		Edges:        []*apiSearchEdge{},
+		searchFacets: ctrl.searchFacets(sr, lang),
+	}
+	for _, e := range sr.Result.GetSearch().GetEdges() {
+		se := newSearchEdge(e)
+		result.Edges = append(result.Edges, &apiSearchEdge{
+			Signature:  e.Base.GetSignature(),
+			Title:      localTitle(se.Title, lang),
+			Date:       se.Date,
+			Type:       se.Type,
+			PersonRole: se.PersonRole,
+			Base:       e.Base,
+		})
+	}
+	if sr.QueryError != "" {
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
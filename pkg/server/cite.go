@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// citationFormats are the export formats, which are offered for the citation of a single entry
+var citationFormats = []string{"bibtex", "ris", "csl"}
+
+// citationDateFormat is the format of the access date in the formatted citations
+const citationDateFormat = "2006-01-02"
+
+// citationTerms are the localized words of the formatted citations
+type citationTerms struct {
+	And         string
+	Accessed    string
+	NoDate      string
+	AvailableAt string
+}
+
+func (ctrl *Controller) citationTerms(lang string) *citationTerms {
+	return &citationTerms{
+		And:         ctrl.localize("and", lang),
+		Accessed:    ctrl.localize("accessed", lang),
+		NoDate:      ctrl.localize("nodate", lang),
+		AvailableAt: ctrl.localize("availableat", lang),
+	}
+}
+
+// citationStyle formats an entry as plain text in the manner of a csl style
+type citationStyle struct {
+	ID     string
+	Label  string
+	Format func(rec *exportRecord, terms *citationTerms) string
+}
+
+var citationStyles = []*citationStyle{
+	{ID: "apa", Label: "APA", Format: formatAPA},
+	{ID: "chicago", Label: "Chicago", Format: formatChicago},
+	{ID: "mla", Label: "MLA", Format: formatMLA},
+	{ID: "harvard", Label: "Harvard", Format: formatHarvard},
+}
+
+func citationStyleByID(id string) (*citationStyle, bool) {
+	for _, style := range citationStyles {
+		if style.ID == id {
+			return style, true
+		}
+	}
+	return nil, false
+}
+
+// citation is a formatted citation of the detail page
+type citation struct {
+	Style string
+	Label string
+	Text  string
+}
+
+func (ctrl *Controller) citations(rec *exportRecord, lang string) []*citation {
+	terms := ctrl.citationTerms(lang)
+	result := []*citation{}
+	for _, style := range citationStyles {
+		result = append(result, &citation{Style: style.ID, Label: style.Label, Text: style.Format(rec, terms)})
+	}
+	return result
+}
+
+// sentence ends text with a period, if it has no closing punctuation
+func sentence(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text[len(text)-1:], ".?!") {
+		return text
+	}
+	return text + "."
+}
+
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	r, n := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(r)) + text[n:]
+}
+
+// initials abbreviates the given names, John Paul becomes J. P.
+func initials(given string) string {
+	result := []string{}
+	for _, part := range strings.Fields(given) {
+		r, _ := utf8.DecodeRuneInString(part)
+		result = append(result, string(r)+".")
+	}
+	return strings.Join(result, " ")
+}
+
+// citationName returns the name as family, given and the given names in front of the family name.
+// Names without comma are organizations, which are not inverted
+func citationName(name string, abbreviate bool) (inverted, natural string) {
+	n := newCSLName(name)
+	if n.Literal != "" {
+		return n.Literal, n.Literal
+	}
+	given := n.Given
+	if abbreviate {
+		given = initials(given)
+	}
+	return n.Family + ", " + given, given + " " + n.Family
+}
+
+func citationYear(rec *exportRecord, terms *citationTerms) string {
+	switch {
+	case rec.Year > 0:
+		return strconv.Itoa(rec.Year)
+	case rec.Date != "":
+		return rec.Date
+	}
+	return terms.NoDate
+}
+
+// citationPublisher returns place and publisher as place: publisher
+func citationPublisher(rec *exportRecord) string {
+	return strings.Join(nonEmpty(rec.Place, rec.Publisher), ": ")
+}
+
+// formatAPA follows the reference list of apa 7: Doe, J., & Smith, A. (1995). Title. Publisher. URL
+func formatAPA(rec *exportRecord, terms *citationTerms) string {
+	names := []string{}
+	for _, p := range rec.creators() {
+		inverted, _ := citationName(p.Name, true)
+		names = append(names, inverted)
+	}
+	var authors string
+	switch len(names) {
+	case 0:
+	case 1:
+		authors = names[0]
+	default:
+		authors = strings.Join(names[:len(names)-1], ", ") + ", & " + names[len(names)-1]
+	}
+	year := "(" + citationYear(rec, terms) + ")."
+	parts := []string{}
+	if authors != "" {
+		parts = append(parts, authors, year, sentence(rec.Title))
+	} else {
+		parts = append(parts, sentence(rec.Title), year)
+	}
+	if rec.Publisher != "" {
+		parts = append(parts, sentence(rec.Publisher))
+	}
+	parts = append(parts, fmt.Sprintf("%s (%s %s)", rec.Link, terms.Accessed, rec.Accessed.Format(citationDateFormat)))
+	return strings.Join(nonEmpty(parts...), " ")
+}
+
+// chicagoAuthors lists the first author inverted and the others in natural order
+func chicagoAuthors(persons []*exportPerson, terms *citationTerms, maxNames int) string {
+	names := []string{}
+	for i, p := range persons {
+		inverted, natural := citationName(p.Name, false)
+		if i == 0 {
+			names = append(names, inverted)
+		} else {
+			names = append(names, natural)
+		}
+	}
+	switch {
+	case len(names) == 0:
+		return ""
+	case len(names) == 1:
+		return names[0]
+	case len(names) > maxNames:
+		return names[0] + ", et al"
+	case len(names) == 2:
+		return names[0] + ", " + terms.And + " " + names[1]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", " + terms.And + " " + names[len(names)-1]
+}
+
+// formatChicago follows the bibliography of the chicago notes style: Doe, John, and Ann Smith. Title. Place: Publisher, 1995. URL
+func formatChicago(rec *exportRecord, terms *citationTerms) string {
+	parts := nonEmpty(sentence(chicagoAuthors(rec.creators(), terms, 10)), sentence(rec.Title))
+	parts = append(parts, sentence(strings.Join(nonEmpty(citationPublisher(rec), citationYear(rec, terms)), ", ")))
+	parts = append(parts, sentence(fmt.Sprintf("%s %s", capitalize(terms.Accessed), rec.Accessed.Format(citationDateFormat))), sentence(rec.Link))
+	return strings.Join(parts, " ")
+}
+
+// formatMLA follows mla 9: Doe, John, and Ann Smith. Title. Collection, Publisher, 1995, URL. Accessed date
+func formatMLA(rec *exportRecord, terms *citationTerms) string {
+	parts := nonEmpty(sentence(chicagoAuthors(rec.creators(), terms, 2)), sentence(rec.Title))
+	parts = append(parts, sentence(strings.Join(nonEmpty(rec.Collection, rec.Publisher, citationYear(rec, terms), rec.Link), ", ")))
+	parts = append(parts, sentence(fmt.Sprintf("%s %s", capitalize(terms.Accessed), rec.Accessed.Format(citationDateFormat))))
+	return strings.Join(parts, " ")
+}
+
+// formatHarvard follows the harvard style: Doe, J. and Smith, A. (1995) Title. Place: Publisher. Available at: URL (Accessed date)
+func formatHarvard(rec *exportRecord, terms *citationTerms) string {
+	names := []string{}
+	for _, p := range rec.creators() {
+		inverted, _ := citationName(p.Name, true)
+		names = append(names, inverted)
+	}
+	var authors string
+	switch len(names) {
+	case 0:
+	case 1:
+		authors = names[0]
+	default:
+		authors = strings.Join(names[:len(names)-1], ", ") + " " + terms.And + " " + names[len(names)-1]
+	}
+	year := "(" + citationYear(rec, terms) + ")"
+	parts := []string{}
+	if authors != "" {
+		parts = append(parts, authors, year, sentence(rec.Title))
+	} else {
+		parts = append(parts, rec.Title, sentence(year))
+	}
+	if publisher := citationPublisher(rec); publisher != "" {
+		parts = append(parts, sentence(publisher))
+	}
+	parts = append(parts, fmt.Sprintf("%s: %s (%s %s).", terms.AvailableAt, rec.Link, capitalize(terms.Accessed), rec.Accessed.Format(citationDateFormat)))
+	return strings.Join(nonEmpty(parts...), " ")
+}
+
+// cite returns the citation of an entry in one of the citation formats or as text in a citation style
+func (ctrl *Controller) cite(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	signature := c.Param("signature")
+	formatName := c.Param("format")
+	style, isStyle := citationStyleByID(formatName)
+	if !isStyle && !slices.Contains(citationFormats, formatName) {
+		ctrl.logger.Error().Msgf("unknown citation format '%s'", formatName)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("unknown citation format '%s'", formatName))
+		return
+	}
+	source, err := ctrl.client.MediathekEntries(c, []string{signature})
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot get source '%s'", signature)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get source '%s': %v", signature, err))
+		return
+	}
+	if source == nil || len(source.MediathekEntries) == 0 {
+		ctrl.logger.Error().Msgf("source '%s' not found", signature)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' not found", signature))
+		return
+	}
+	me := source.MediathekEntries[0]
+	rec := ctrl.newExportRecord(me.GetBase(), me.GetAbstract(), lang)
+	rec.Accessed = time.Now()
+	if isStyle {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(style.Format(rec, ctrl.citationTerms(lang))+"\n"))
+		return
+	}
+
+	format := exportFormats[formatName]
+	buf := &bytes.Buffer{}
+	wr, err := format.NewWriter(buf)
+	if err == nil {
+		if err = wr.Write(rec); err == nil {
+			err = wr.Close()
+		}
+	}
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot write %s citation of '%s'", formatName, signature)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot write %s citation of '%s': %v", formatName, signature, err))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", bibTeXKeyRegexp.ReplaceAllString(signature, "_"), format.Extension))
+	c.Data(http.StatusOK, format.ContentType, buf.Bytes())
+}
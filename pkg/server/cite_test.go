@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCitationStyles(t *testing.T) {
+	terms := &citationTerms{And: "and", Accessed: "accessed", NoDate: "n.d.", AvailableAt: "Available at"}
+	rec := testRecord()
+	rec.Title = "Title"
+	rec.Publisher = "Pub"
+	rec.Link = "https://example.org/detail/zotero2-1.AB C/en"
+	rec.Accessed = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	rec.Persons = append(rec.Persons, &exportPerson{Name: "Lee, Mary Ann", Role: "author"})
+	for id, want := range map[string]string{
+		"apa":     "Doe, J., & Lee, M. A. (1995). Title. Pub. https://example.org/detail/zotero2-1.AB C/en (accessed 2026-03-10)",
+		"chicago": "Doe, John, and Mary Ann Lee. Title. Basel: Pub, 1995. Accessed 2026-03-10. https://example.org/detail/zotero2-1.AB C/en.",
+		"mla":     "Doe, John, and Mary Ann Lee. Title. Performance Chronik, Pub, 1995, https://example.org/detail/zotero2-1.AB C/en. Accessed 2026-03-10.",
+		"harvard": "Doe, J. and Lee, M. A. (1995) Title. Basel: Pub. Available at: https://example.org/detail/zotero2-1.AB C/en (Accessed 2026-03-10).",
+	} {
+		style, ok := citationStyleByID(id)
+		if !ok {
+			t.Fatalf("unknown style %s", id)
+		}
+		if text := style.Format(rec, terms); text != want {
+			t.Errorf("%s:\n%s\nexpected\n%s", id, text, want)
+		}
+	}
+
+	rec.Persons = []*exportPerson{}
+	rec.Date, rec.Year = "", 0
+	if text := formatAPA(rec, terms); !strings.HasPrefix(text, "Title. (n.d.). Pub.") {
+		t.Errorf("apa without authors: %s", text)
+	}
+	if text := formatHarvard(rec, terms); !strings.HasPrefix(text, "Title (n.d.). Basel: Pub.") {
+		t.Errorf("harvard without authors: %s", text)
+	}
+}
+
+func TestCitationAccessed(t *testing.T) {
+	rec := testRecord()
+	rec.Accessed = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for name, want := range map[string]string{
+		"bibtex": "urldate = {2026-03-10}",
+		"ris":    "Y2  - 2026/03/10\r\n",
+		"csl":    `"accessed":{"date-parts":[[2026,3,10]]}`,
+	} {
+		buf := &bytes.Buffer{}
+		wr, err := exportFormats[name].NewWriter(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s: missing %s in %s", name, want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// the kinds of collection identifiers, an identifier is kind:value
+const (
+	collectionKindCategory  = "cat"
+	collectionKindTag       = "tag"
+	collectionKindSignature = "sig"
+	collectionKindQuery     = "query"
+)
+
+// collectionFieldKinds are the kinds, which are counted by a term facet
+var collectionFieldKinds = []string{collectionKindCategory, collectionKindTag, collectionKindSignature}
+
+// signatureField is the revcat field of the signature lists
+const signatureField = "signature.keyword"
+
+// collection is a configured collection with its parsed identifier.
+// Category, tag and signature collections match one of Values in Field,
+// query collections match the fulltext Query and the field filters of Filter
+type collection struct {
+	*CollFacetType
+	Kind   string
+	Field  string
+	Values []string
+	Query  string
+	Filter []*client.InFilter
+}
+
+// search returns the fulltext query and the filters of the collection records
+func (coll *collection) search() (string, []*client.InFilter) {
+	if coll.Kind == collectionKindQuery {
+		// the date ranges of the filters are resolved in place
+		filter := []*client.InFilter{}
+		for _, f := range coll.Filter {
+			bt := *f.BoolTerm
+			bt.Values = slices.Clone(bt.Values)
+			filter = append(filter, &client.InFilter{BoolTerm: &bt})
+		}
+		return coll.Query, filter
+	}
+	return "", []*client.InFilter{
+		{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  coll.Field,
+				Values: slices.Clone(coll.Values),
+				And:    false,
+			},
+		},
+	}
+}
+
+// collectionRegistry parses the collection identifiers and builds facets and filters of the collections
+type collectionRegistry struct {
+	facet       *FacetConfig
+	collections []*collection
+}
+
+// newCollectionRegistry parses the identifiers of the collections.
+// The category field and the facet size are taken from the collection facet, if there is one
+func newCollectionRegistry(collections []*CollFacetType, facet *FacetConfig, fieldMapping map[string]*FieldMapping) (*collectionRegistry, error) {
+	if facet == nil {
+		facet = &FacetConfig{Name: "collections", Type: facetTypeCollection, Field: "category.keyword", Size: facetDefaultSize[facetTypeCollection]}
+	}
+	reg := &collectionRegistry{facet: facet, collections: []*collection{}}
+	ids := map[int64]bool{}
+	for _, cft := range collections {
+		if ids[cft.Id] {
+			return nil, errors.Errorf("duplicate collection id %d", cft.Id)
+		}
+		ids[cft.Id] = true
+		coll, err := reg.parse(cft, fieldMapping)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid identifier of collection %d", cft.Id)
+		}
+		reg.collections = append(reg.collections, coll)
+	}
+	return reg, nil
+}
+
+func (reg *collectionRegistry) parse(cft *CollFacetType, fieldMapping map[string]*FieldMapping) (*collection, error) {
+	kind, value, ok := strings.Cut(cft.Identifier, ":")
+	if !ok {
+		return nil, errors.Errorf("identifier '%s' without kind", cft.Identifier)
+	}
+	coll := &collection{CollFacetType: cft, Kind: kind, Values: []string{}, Filter: []*client.InFilter{}}
+	switch kind {
+	case collectionKindCategory, collectionKindTag:
+		coll.Values = append(coll.Values, strings.Trim(value, "\" "))
+	case collectionKindSignature:
+		coll.Values = splitParam(strings.Trim(value, "\" "))
+	case collectionKindQuery:
+		// the query is a search with the syntax of the search field
+		q, err := parseQuery(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse query '%s'", value)
+		}
+		if coll.Query, coll.Filter, err = compileQuery(q, fieldMapping); err != nil {
+			return nil, errors.Wrapf(err, "cannot compile query '%s'", value)
+		}
+		if coll.Query == "" && len(coll.Filter) == 0 {
+			return nil, errors.Errorf("empty query '%s'", value)
+		}
+		return coll, nil
+	default:
+		return nil, errors.Errorf("unknown kind '%s' of identifier '%s'", kind, cft.Identifier)
+	}
+	if len(coll.Values) == 0 || coll.Values[0] == "" {
+		return nil, errors.Errorf("identifier '%s' without value", cft.Identifier)
+	}
+	coll.Field = reg.field(kind)
+	return coll, nil
+}
+
+// get returns the collection with the given id
+func (reg *collectionRegistry) get(id int64) (*collection, bool) {
+	for _, coll := range reg.collections {
+		if coll.Id == id {
+			return coll, true
+		}
+	}
+	return nil, false
+}
+
+// facetName returns the name of the term facet of the kind.
+// The categories keep the name of the collection facet, the other kinds get a suffix
+func (reg *collectionRegistry) facetName(kind string) string {
+	if kind == collectionKindCategory {
+		return reg.facet.Name
+	}
+	return reg.facet.Name + "_" + kind
+}
+
+// values returns the distinct values of all collections of the kind
+func (reg *collectionRegistry) values(kind string) []string {
+	result := []string{}
+	for _, coll := range reg.collections {
+		if coll.Kind != kind {
+			continue
+		}
+		for _, val := range coll.Values {
+			if !slices.Contains(result, val) {
+				result = append(result, val)
+			}
+		}
+	}
+	return result
+}
+
+// facets returns a term facet without selection for each kind with collections
+func (reg *collectionRegistry) facets() []*client.InFacet {
+	result := []*client.InFacet{}
+	for _, kind := range collectionFieldKinds {
+		values := reg.values(kind)
+		if len(values) == 0 {
+			continue
+		}
+		include := values
+		// revcat uses a single include as regexp
+		if len(include) == 1 {
+			include = []string{regexp.QuoteMeta(include[0])}
+		}
+		field := reg.field(kind)
+		result = append(result, &client.InFacet{
+			Term: &client.InFacetTerm{
+				Name:        reg.facetName(kind),
+				Field:       aggregationField(field),
+				Size:        max(reg.facet.Size, int64(len(values))),
+				MinDocCount: reg.facet.MinDocCount,
+				Include:     include,
+				Exclude:     []string{},
+			},
+			Query: &client.InFilter{
+				BoolTerm: &client.InFilterBoolTerm{
+					Field:  field,
+					Values: []string{},
+					And:    false,
+				},
+			},
+		})
+	}
+	return result
+}
+
+func (reg *collectionRegistry) field(kind string) string {
+	switch kind {
+	case collectionKindTag:
+		return vocabularyField
+	case collectionKindSignature:
+		return signatureField
+	default:
+		return reg.facet.Field
+	}
+}
+
+// counts returns the number of hits of the counted collections in the facets of a search result.
+// The signature lists are the sum of their signatures
+func (reg *collectionRegistry) counts(facets []*client.FacetFragment) map[int64]int {
+	buckets := map[string]map[string]int{}
+	for _, facet := range facets {
+		kind, ok := reg.facetKind(facet.GetName())
+		if !ok {
+			continue
+		}
+		buckets[kind] = map[string]int{}
+		for _, val := range facet.GetValues() {
+			strVal := val.GetFacetValueString()
+			if strVal == nil || reg.facet.excluded(strVal.GetStrVal()) {
+				continue
+			}
+			buckets[kind][strVal.GetStrVal()] = int(strVal.GetCount())
+		}
+	}
+	result := map[int64]int{}
+	for _, coll := range reg.collections {
+		kindBuckets, ok := buckets[coll.Kind]
+		if !ok {
+			continue
+		}
+		var count int
+		var found bool
+		for _, val := range coll.Values {
+			if c, ok := kindBuckets[val]; ok {
+				count += c
+				found = true
+			}
+		}
+		if found {
+			result[coll.Id] = count
+		}
+	}
+	return result
+}
+
+// collFacets returns the collections of a search result, the most frequent first.
+// Query collections are not counted, they are listed last with count -1
+func (reg *collectionRegistry) collFacets(facets []*client.FacetFragment, selected, excluded []int) []*collFacetType {
+	counts := reg.counts(facets)
+	result := []*collFacetType{}
+	queries := []*collFacetType{}
+	for _, coll := range reg.collections {
+		cf := &collFacetType{
+			ID:       int(coll.Id),
+			Name:     coll.Title,
+			Checked:  slices.Contains(selected, int(coll.Id)),
+			Excluded: slices.Contains(excluded, int(coll.Id)),
+		}
+		if coll.Kind == collectionKindQuery {
+			cf.Count = -1
+			queries = append(queries, cf)
+			continue
+		}
+		count, ok := counts[coll.Id]
+		if !ok {
+			continue
+		}
+		cf.Count = count
+		result = append(result, cf)
+	}
+	slices.SortStableFunc(result, func(a, b *collFacetType) int { return b.Count - a.Count })
+	return append(result, queries...)
+}
+
+func (reg *collectionRegistry) facetKind(name string) (string, bool) {
+	for _, kind := range collectionFieldKinds {
+		if reg.facetName(kind) == name {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// collectionSelection restricts a search to the selected collections
+type collectionSelection struct {
+	// Values are the filter values of the collection facets
+	Values map[string][]string
+	// Query is added to the fulltext query with AND, Filter to the filters
+	Query  string
+	Filter []*client.InFilter
+	// Excluded are negated in the fulltext query, phrases are values, clauses are queries
+	ExcludedPhrases []string
+	ExcludedClauses []string
+}
+
+// selection creates the restriction of the selected collections without the excluded ones.
+// Without selection, the search is restricted to all collections.
+// revcat combines filters of different fields with AND, so collections of different kinds cannot be combined.
+// Values as phrases in the fulltext query would also match other fields. Without selection,
+// the excluded collections are negated in the fulltext query then
+func (reg *collectionRegistry) selection(selected, excluded []int) (*collectionSelection, error) {
+	sel := &collectionSelection{
+		Values:          map[string][]string{},
+		Filter:          []*client.InFilter{},
+		ExcludedPhrases: []string{},
+		ExcludedClauses: []string{},
+	}
+	colls := []*collection{}
+	for _, id := range selected {
+		if coll, ok := reg.get(int64(id)); ok {
+			colls = append(colls, coll)
+		}
+	}
+	all := len(colls) == 0
+	if all {
+		if len(reg.collections) == 0 {
+			return sel, nil
+		}
+		colls = reg.collections
+	}
+	colls = slices.DeleteFunc(slices.Clone(colls), func(coll *collection) bool {
+		return slices.Contains(excluded, int(coll.Id))
+	})
+	if len(colls) == 0 {
+		// all collections are excluded
+		sel.Filter = append(sel.Filter, &client.InFilter{
+			BoolTerm: &client.InFilterBoolTerm{Field: signatureField, Values: []string{noMatchValue}},
+		})
+		return sel, nil
+	}
+	if len(colls) == 1 && colls[0].Kind == collectionKindQuery {
+		sel.Query, sel.Filter = colls[0].search()
+		return sel, nil
+	}
+	kind := colls[0].Kind
+	for _, coll := range colls {
+		if coll.Kind == collectionKindQuery && len(coll.Filter) > 0 {
+			if all {
+				return reg.exclusion(sel, excluded)
+			}
+			return nil, &QueryError{Msg: fmt.Sprintf("collection '%s' with field filters cannot be combined with other collections", coll.Title)}
+		}
+		if coll.Kind != kind {
+			if all {
+				return reg.exclusion(sel, excluded)
+			}
+			return nil, &QueryError{Msg: fmt.Sprintf("collections '%s' and '%s' of different kinds cannot be combined", colls[0].Title, coll.Title)}
+		}
+	}
+	if kind == collectionKindQuery {
+		sel.Query = reg.anyQuery(colls)
+		return sel, nil
+	}
+	values := []string{}
+	for _, coll := range colls {
+		for _, val := range coll.Values {
+			if !slices.Contains(values, val) {
+				values = append(values, val)
+			}
+		}
+	}
+	sel.Values[reg.facetName(kind)] = values
+	return sel, nil
+}
+
+// anyQuery combines query collections without field filters with OR in one fulltext query
+func (reg *collectionRegistry) anyQuery(colls []*collection) string {
+	clauses := []string{}
+	for _, coll := range colls {
+		clauses = append(clauses, "("+coll.Query+")")
+	}
+	return strings.Join(clauses, " | ")
+}
+
+// exclusion negates the excluded collections in the fulltext query of an unrestricted search
+func (reg *collectionRegistry) exclusion(sel *collectionSelection, excluded []int) (*collectionSelection, error) {
+	for _, id := range excluded {
+		coll, ok := reg.get(int64(id))
+		if !ok {
+			continue
+		}
+		if coll.Kind != collectionKindQuery {
+			sel.ExcludedPhrases = append(sel.ExcludedPhrases, coll.Values...)
+			continue
+		}
+		if len(coll.Filter) > 0 {
+			return nil, &QueryError{Msg: fmt.Sprintf("collection '%s' with field filters cannot be excluded", coll.Title)}
+		}
+		sel.ExcludedClauses = append(sel.ExcludedClauses, "("+coll.Query+")")
+	}
+	return sel, nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+func TestCollectionRegistry(t *testing.T) {
+	fieldMapping := map[string]*FieldMapping{"author": {Field: "[persons].name.keyword", And: true}}
+	reg, err := newCollectionRegistry([]*CollFacetType{
+		{Id: 1, Title: "ACT", Identifier: `cat:"zotero2!!ACT Performance Festival"`},
+		{Id: 2, Title: "Werke", Identifier: `cat:"zotero2!!Werke"`},
+		{Id: 3, Title: "Tanz", Identifier: `tag:"voc:voc_tanzen"`},
+		{Id: 4, Title: "Auswahl", Identifier: `sig:"zotero2-1, zotero2-2"`},
+		{Id: 5, Title: "Muster", Identifier: `query:tanz author:"Muster, Max"`},
+	}, nil, fieldMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	facets := reg.facets()
+	names := []string{}
+	for _, f := range facets {
+		names = append(names, f.Term.Name+"="+f.Term.Field)
+	}
+	if want := "collections=category.keyword collections_tag=tags.keyword collections_sig=signature.keyword"; strings.Join(names, " ") != want {
+		t.Errorf("facets are '%s', want '%s'", strings.Join(names, " "), want)
+	}
+	if include := facets[1].Term.Include; len(include) != 1 || include[0] != `voc:voc_tanzen` {
+		t.Errorf("invalid include %v", include)
+	}
+
+	counts := reg.counts([]*client.FacetFragment{
+		{Name: "collections", Values: []*client.FacetValueFragment{
+			{FacetValueString: client.FacetValueStringFragment{StrVal: "zotero2!!Werke", Count: 7}},
+		}},
+		{Name: "collections_sig", Values: []*client.FacetValueFragment{
+			{FacetValueString: client.FacetValueStringFragment{StrVal: "zotero2-1", Count: 1}},
+			{FacetValueString: client.FacetValueStringFragment{StrVal: "zotero2-2", Count: 1}},
+		}},
+	})
+	if len(counts) != 2 || counts[2] != 7 || counts[4] != 2 {
+		t.Errorf("invalid counts %v", counts)
+	}
+
+	// without selection, the query collection with field filters cannot be combined with the others,
+	// the search is not restricted then
+	sel, err := reg.selection(nil, []int{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.Values) != 0 || len(sel.ExcludedPhrases) != 1 || sel.ExcludedPhrases[0] != "voc:voc_tanzen" {
+		t.Errorf("invalid selection %+v", sel)
+	}
+	sel, err = reg.selection([]int{1, 2}, []int{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals := sel.Values["collections"]; len(vals) != 1 || vals[0] != "zotero2!!ACT Performance Festival" {
+		t.Errorf("invalid category selection %+v", sel.Values)
+	}
+	sel, err = reg.selection([]int{5}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Query != "tanz" || len(sel.Filter) != 1 || sel.Filter[0].BoolTerm.Values[0] != "Muster, Max" {
+		t.Errorf("invalid query selection %+v", sel)
+	}
+	// collections of different kinds cannot be combined, values as phrases would also match other fields
+	var qErr *QueryError
+	if _, err := reg.selection([]int{1, 3, 4}, nil); !errors.As(err, &qErr) {
+		t.Errorf("collections of different kinds must not be combined: %v", err)
+	}
+	if _, err := reg.selection([]int{1, 5}, nil); !errors.As(err, &qErr) {
+		t.Errorf("query collections with field filters must not be combined: %v", err)
+	}
+	// without selection, the search is not restricted then
+	if sel, err = reg.selection(nil, []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	if sel.Query != "" || len(sel.Values) != 0 || len(sel.Filter) != 0 || strings.Join(sel.ExcludedPhrases, ",") != "zotero2!!Werke" {
+		t.Errorf("invalid default selection of different kinds %+v", sel)
+	}
+	if _, err := reg.selection(nil, []int{5}); !errors.As(err, &qErr) {
+		t.Errorf("query collections with field filters cannot be excluded: %v", err)
+	}
+	// query collections without field filters are combined in the fulltext query
+	reg, err = newCollectionRegistry([]*CollFacetType{
+		{Id: 1, Title: "Tanz", Identifier: `query:tanz`},
+		{Id: 2, Title: "Theater", Identifier: `query:theater | bühne`},
+	}, nil, fieldMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel, err = reg.selection(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "(tanz) | (theater | bühne)"; sel.Query != want || len(sel.Filter) != 0 {
+		t.Errorf("invalid query selection '%s', want '%s'", sel.Query, want)
+	}
+
+	// without query collections, all collections of the same kind are a filter
+	reg, err = newCollectionRegistry([]*CollFacetType{
+		{Id: 1, Title: "ACT", Identifier: `cat:"zotero2!!ACT Performance Festival"`},
+		{Id: 2, Title: "Werke", Identifier: `cat:"zotero2!!Werke"`},
+	}, nil, fieldMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel, err = reg.selection(nil, []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	if vals := sel.Values["collections"]; len(vals) != 1 || vals[0] != "zotero2!!ACT Performance Festival" || sel.Query != "" {
+		t.Errorf("invalid default selection %+v", sel)
+	}
+
+	if _, err := newCollectionRegistry([]*CollFacetType{{Id: 1, Identifier: "year:1990"}}, nil, fieldMapping); err == nil {
+		t.Error("unknown identifier kind must fail")
+	}
+}
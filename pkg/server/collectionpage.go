@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// collectionPageTerms is the number of vocabulary terms on the collection pages
+const collectionPageTerms = 20
+
+// collectionPagePosters is the number of posters of the mosaic on the collection pages
+const collectionPagePosters int64 = 12
+
+// collectionPage shows a collection with its most frequent vocabulary terms and a poster mosaic.
+// The search box of the page searches in the collection
+func (ctrl *Controller) collectionPage(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("invalid collection id '%s'", idStr)
+		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("invalid collection id '%s': %v", idStr, err))
+		return
+	}
+	coll, ok := ctrl.collectionRegistry.get(id)
+	if !ok {
+		ctrl.logger.Error().Msgf("collection %d not found", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("collection %d not found", id))
+		return
+	}
+
+	templateName := "collection.gohtml"
+	collectionTemplate, err := ctrl.loadHTMLTemplate(templateName, []string{"head.gohtml", "footer.gohtml", "nav.gohtml", templateName})
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot load template '%s'", templateName)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot load template '%s': %v", templateName, err))
+		return
+	}
+
+	collections, err := ctrl.collectionsWithCounts(c)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msg("cannot count collections")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot count collections: %v", err))
+		return
+	}
+
+	user := GetUser(c)
+	query, filter, hasRecords, err := ctrl.collectionSearch(c, user.Groups, coll)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot resolve date ranges of collection %d", id)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot resolve date ranges of collection %d: %v", id, err))
+		return
+	}
+	facets := []*client.InFacet{}
+	vocFacet, hasVocabulary := ctrl.facetOfType(facetTypeVocabulary)
+	if hasVocabulary {
+		facets = append(facets, vocFacet.inFacet())
+	}
+	result := &client.Search{}
+	if hasRecords {
+		var size = collectionPagePosters
+		result, err = ctrl.client.Search(c, query, facets, append(searchFilter(user.Groups), filter...), nil, nil, &size, nil, nil)
+		if err != nil {
+			ctrl.logger.Error().Err(err).Msgf("cannot search collection %d", id)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search collection %d: %v", id, err))
+			return
+		}
+	}
+
+	terms := []*vocNode{}
+	if hasVocabulary {
+		for _, facet := range result.GetSearch().GetFacets() {
+			if facet.GetName() != vocFacet.Name {
+				continue
+			}
+			vocCounts := map[string]int{}
+			for _, val := range facet.GetValues() {
+				strVal := val.GetFacetValueString()
+				if strVal == nil || vocFacet.excluded(strVal.GetStrVal()) {
+					continue
+				}
+				vocCounts[strVal.GetStrVal()] = int(strVal.GetCount())
+			}
+			terms = topVocTerms(vocCounts, collectionPageTerms, func(key string) string {
+				return ctrl.localize(key, lang)
+			})
+		}
+	}
+	edges := []*searchEdge{}
+	for _, e := range result.GetSearch().GetEdges() {
+		edges = append(edges, newSearchEdge(e))
+	}
+
+	data := struct {
+		baseData
+		Collection      *CollFacetType `json:"collection"`
+		Terms           []*vocNode     `json:"terms"`
+		Edges           []*searchEdge  `json:"edges"`
+		MediaserverBase string         `json:"mediaserverBase"`
+	}{
+		baseData: baseData{
+			Lang:       lang,
+			RootPath:   "../../",
+			SearchAddr: ctrl.searchAddr,
+			DetailAddr: ctrl.detailAddr,
+			LoginURL:   ctrl.loginURL,
+			Self:       fmt.Sprintf("%s%s", ctrl.externalAddr, c.Request.URL.Path),
+			User:       user,
+			Mode:       ctrl.mode,
+		},
+		Collection:      collections[id],
+		Terms:           terms,
+		Edges:           edges,
+		MediaserverBase: ctrl.mediaserverBase,
+	}
+	if user.IsLoggedIn() {
+		data.DetailAddr = data.SearchAddr
+	}
+	if err := collectionTemplate.Execute(c.Writer, data); err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot execute template '%s': %v", templateName, err))
+		return
+	}
+}
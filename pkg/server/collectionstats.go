@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// collectionStatsInterval is the refresh interval of the collection counts
+const collectionStatsInterval = 10 * time.Minute
+
+// collectionStatsExpiry removes the counts of group sets, which have not been requested for a while
+const collectionStatsExpiry = 24 * time.Hour
+
+// groupStatsValue is the value of an acl group set. The struct is replaced on refresh and never changed afterwards
+type groupStatsValue[T any] struct {
+	Groups  []string
+	Value   T
+	Updated time.Time
+}
+
+type groupStatsEntry[T any] struct {
+	groups    []string
+	value     *groupStatsValue[T]
+	requested time.Time
+	// ready is closed, when the first calculation of the group set is finished
+	ready chan struct{}
+	err   error
+}
+
+// groupStats caches values per acl group set and refreshes them in the background.
+// Only the first request of a group set waits for revcat, concurrent first requests share the calculation
+type groupStats[T any] struct {
+	calc     func(ctx context.Context, groups []string) (T, error)
+	interval time.Duration
+	expiry   time.Duration
+	logger   zLogger.ZLogger
+	// trigger refreshes all group sets without waiting for the interval
+	trigger chan struct{}
+
+	mutex   sync.Mutex
+	entries map[string]*groupStatsEntry[T]
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newGroupStats[T any](calc func(ctx context.Context, groups []string) (T, error), interval, expiry time.Duration, logger zLogger.ZLogger) *groupStats[T] {
+	return &groupStats[T]{
+		calc:     calc,
+		interval: interval,
+		expiry:   expiry,
+		logger:   logger,
+		trigger:  make(chan struct{}),
+		entries:  map[string]*groupStatsEntry[T]{},
+	}
+}
+
+// groupSet returns the sorted groups without duplicates and their cache key
+func groupSet(groups []string) ([]string, string) {
+	set := slices.Clone(groups)
+	slices.Sort(set)
+	set = slices.Compact(set)
+	return set, strings.Join(set, "\n")
+}
+
+// groupsContext carries a user with the groups, the revcat client sends them with each request
+func groupsContext(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, "user", &User{Groups: groups})
+}
+
+// get returns the value for the groups, which is calculated on the first request of the group set
+func (gs *groupStats[T]) get(ctx context.Context, groups []string) (*groupStatsValue[T], error) {
+	set, key := groupSet(groups)
+	gs.mutex.Lock()
+	entry, ok := gs.entries[key]
+	if !ok {
+		entry = &groupStatsEntry[T]{groups: set, ready: make(chan struct{})}
+		gs.entries[key] = entry
+	}
+	entry.requested = time.Now()
+	gs.mutex.Unlock()
+	if !ok {
+		gs.first(key, entry)
+	}
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if entry.value == nil {
+		return nil, entry.err
+	}
+	return entry.value, nil
+}
+
+// first calculates the value of a new group set. On error the entry is removed, the next request tries again
+func (gs *groupStats[T]) first(key string, entry *groupStatsEntry[T]) {
+	value, err := gs.calc(groupsContext(context.Background(), entry.groups), entry.groups)
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if err != nil {
+		entry.err = errors.Wrapf(err, "cannot calculate value of %v", entry.groups)
+		if gs.entries[key] == entry {
+			delete(gs.entries, key)
+		}
+	} else {
+		entry.value = &groupStatsValue[T]{Groups: entry.groups, Value: value, Updated: time.Now()}
+	}
+	close(entry.ready)
+}
+
+// refresh calculates the value of the group set again, the requests use the old value meanwhile
+func (gs *groupStats[T]) refresh(ctx context.Context, groups []string) error {
+	set, key := groupSet(groups)
+	value, err := gs.calc(groupsContext(ctx, set), set)
+	if err != nil {
+		return errors.Wrapf(err, "cannot calculate value of %v", set)
+	}
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	entry, ok := gs.entries[key]
+	if !ok {
+		entry = &groupStatsEntry[T]{groups: set, requested: time.Now(), ready: make(chan struct{})}
+		close(entry.ready)
+		gs.entries[key] = entry
+	}
+	entry.value = &groupStatsValue[T]{Groups: set, Value: value, Updated: time.Now()}
+	return nil
+}
+
+// refreshAll updates the values of all group sets and removes the expired ones.
+// Group sets, whose first calculation is still running, are skipped
+func (gs *groupStats[T]) refreshAll(ctx context.Context) {
+	groupSets := [][]string{}
+	gs.mutex.Lock()
+	for key, entry := range gs.entries {
+		if time.Since(entry.requested) > gs.expiry {
+			delete(gs.entries, key)
+			continue
+		}
+		if entry.value != nil {
+			groupSets = append(groupSets, entry.groups)
+		}
+	}
+	gs.mutex.Unlock()
+	for _, groups := range groupSets {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := gs.refresh(ctx, groups); err != nil {
+			gs.logger.Error().Err(err).Msg("cannot refresh group statistics")
+		}
+	}
+}
+
+// Start calculates the value of the guests and refreshes all values in the background
+func (gs *groupStats[T]) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	gs.cancel = cancel
+	gs.wg.Add(1)
+	go func() {
+		defer gs.wg.Done()
+		if err := gs.refresh(ctx, []string{"global/guest"}); err != nil {
+			gs.logger.Error().Err(err).Msg("cannot calculate group statistics")
+		}
+		ticker := time.NewTicker(gs.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				gs.refreshAll(ctx)
+			case <-gs.trigger:
+				gs.refreshAll(ctx)
+			}
+		}
+	}()
+}
+
+func (gs *groupStats[T]) Stop() {
+	if gs.cancel != nil {
+		gs.cancel()
+	}
+	gs.wg.Wait()
+}
+
+// searchFilter restricts a search to the records with poster, which are visible for groups
+func searchFilter(groups []string) []*client.InFilter {
+	return []*client.InFilter{
+		{
+			ExistsTerm: &client.InFilterExistsTerm{
+				Field: "poster",
+			},
+		},
+		{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  "acl.content.keyword",
+				Values: groups,
+			},
+		},
+	}
+}
+
+// collectionSearch returns the fulltext query and the filters of the collection records visible for groups.
+// If the date ranges of the collection do not match any date, there are no records and ok is false
+func (ctrl *Controller) collectionSearch(ctx context.Context, groups []string, coll *collection) (query string, filter []*client.InFilter, ok bool, err error) {
+	query, filter = coll.search()
+	added, err := ctrl.resolveDateRanges(ctx, groups, filter...)
+	if err != nil {
+		return "", nil, false, errors.Wrapf(err, "cannot resolve date ranges of collection %d", coll.Id)
+	}
+	filter = append(filter, added...)
+	if slices.ContainsFunc(filter, matchesNothing) {
+		return "", nil, false, nil
+	}
+	return query, filter, true, nil
+}
+
+// countCollections counts the records of all collections visible for groups.
+// The collections with a field are counted by the facets of one search, each query collection needs a search of its own
+func (ctrl *Controller) countCollections(ctx context.Context, groups []string) (map[int64]int, error) {
+	var size int64 = 0
+	result, err := ctrl.client.Search(ctx, "", ctrl.collectionRegistry.facets(), searchFilter(groups), nil, nil, &size, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot search for collection facets")
+	}
+	counts := ctrl.collectionRegistry.counts(result.GetSearch().GetFacets())
+	for _, coll := range ctrl.collectionRegistry.collections {
+		if coll.Kind != collectionKindQuery {
+			continue
+		}
+		query, filter, ok, err := ctrl.collectionSearch(ctx, groups, coll)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !ok {
+			counts[coll.Id] = 0
+			continue
+		}
+		result, err := ctrl.client.Search(ctx, query, []*client.InFacet{}, append(searchFilter(groups), filter...), nil, nil, &size, nil, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot search for collection %d", coll.Id)
+		}
+		counts[coll.Id] = int(result.GetSearch().GetTotalCount())
+	}
+	return counts, nil
+}
+
+// collectionsWithCounts returns copies of the collections with the counts visible for the user
+func (ctrl *Controller) collectionsWithCounts(c *gin.Context) (map[int64]*CollFacetType, error) {
+	cc, err := ctrl.collectionStats.get(c, GetUser(c).Groups)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	result := map[int64]*CollFacetType{}
+	for _, coll := range ctrl.collections {
+		cft := *coll
+		cft.Count = cc.Value[coll.Id]
+		result[coll.Id] = &cft
+	}
+	return result, nil
+}
+
+// collectionStatsJSON returns the collections in configuration order with the counts visible for the user
+func (ctrl *Controller) collectionStatsJSON(c *gin.Context) {
+	cc, err := ctrl.collectionStats.get(c, GetUser(c).Groups)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msg("cannot get collection counts")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get collection counts: %v", err))
+		return
+	}
+	collections := []*CollFacetType{}
+	for _, coll := range ctrl.collections {
+		cft := *coll
+		cft.Count = cc.Value[coll.Id]
+		collections = append(collections, &cft)
+	}
+	c.JSON(http.StatusOK, struct {
+		Updated     time.Time        `json:"updated"`
+		Collections []*CollFacetType `json:"collections"`
+	}{
+		Updated:     cc.Updated,
+		Collections: collections,
+	})
+}
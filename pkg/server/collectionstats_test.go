@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestGroupStats(t *testing.T) {
+	var calls atomic.Int64
+	count := func(ctx context.Context, groups []string) (map[int64]int, error) {
+		calls.Add(1)
+		// the revcat client takes the groups from the user of the context
+		user, _ := ctx.Value("user").(*User)
+		if user == nil || strings.Join(user.Groups, ",") != strings.Join(groups, ",") {
+			t.Errorf("context without user of groups %v", groups)
+		}
+		return map[int64]int{1: len(groups), 2: int(calls.Load())}, nil
+	}
+	logger := zerolog.Nop()
+	cs := newGroupStats(count, time.Hour, time.Hour, &logger)
+
+	cc, err := cs.get(context.Background(), []string{"global/guest", "global/admin", "global/guest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cc.Groups, ",") != "global/admin,global/guest" || cc.Value[1] != 2 {
+		t.Errorf("invalid counts %+v", cc)
+	}
+	// the group set is counted only once
+	if cc, _ = cs.get(context.Background(), []string{"global/admin", "global/guest"}); cc.Value[2] != 1 || calls.Load() != 1 {
+		t.Errorf("counts of a known group set must be cached: %+v", cc)
+	}
+	cs.refreshAll(context.Background())
+	if cc, _ = cs.get(context.Background(), []string{"global/guest", "global/admin"}); cc.Value[2] != 2 {
+		t.Errorf("counts must be refreshed: %+v", cc)
+	}
+
+	// group sets, which are not requested anymore, are removed
+	cs.expiry = 0
+	cs.refreshAll(context.Background())
+	if len(cs.entries) != 0 {
+		t.Errorf("expired group sets must be removed: %v", cs.entries)
+	}
+
+	cs.expiry = time.Hour
+	cs.Start()
+	// the loop receives the triggers after the guests are counted, the second one after the first refresh is finished
+	cs.trigger <- struct{}{}
+	cs.trigger <- struct{}{}
+	cs.Stop()
+	if calls.Load() < 4 {
+		t.Errorf("guests must be counted on start and refreshed: %d calls", calls.Load())
+	}
+}
+
+func TestGroupStatsConcurrentFirst(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	count := func(ctx context.Context, groups []string) (map[int64]int, error) {
+		calls.Add(1)
+		<-release
+		return map[int64]int{1: 1}, nil
+	}
+	logger := zerolog.Nop()
+	cs := newGroupStats(count, time.Hour, time.Hour, &logger)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cc, err := cs.get(context.Background(), []string{"global/guest"}); err != nil || cc.Value[1] != 1 {
+				t.Errorf("invalid counts %+v: %v", cc, err)
+			}
+		}()
+	}
+	// a background refresh must not count the group set, which is not counted yet
+	cs.refreshAll(context.Background())
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("concurrent first requests must share the counting: %d calls", calls.Load())
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"image"
 	"io/fs"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -31,11 +33,8 @@ import (
 	"github.com/gosimple/slug"
 	"github.com/je4/basel-collections/v2/directus"
 	"github.com/je4/revcat/v2/tools/client"
-	"github.com/je4/utils/v2/pkg/openai"
 	"github.com/je4/utils/v2/pkg/zLogger"
-	"github.com/je4/zsearch/v2/pkg/translate"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
-	oai "github.com/sashabaranov/go-openai"
 	"github.com/yeqown/go-qrcode/v2"
 	"github.com/yeqown/go-qrcode/writer/standard"
 	"golang.org/x/net/html"
@@ -65,6 +64,8 @@ type baseData struct {
 	Self       string
 	User       *User
 	Mode       string
+	// Meta is the metadata of the page for search engines and social media, if there is any
+	Meta *pageMeta
 }
 
 type CollFacetType struct {
@@ -78,6 +79,46 @@ type CollFacetType struct {
 	Contact    string `toml:"contact" json:"contact"`
 }
 
+// FieldMapping maps a search field to the revcat field.
+// In toml it is either the field name or a table with field, and and suggest.
+// And controls, whether repeated search fields must all match.
+// Suggest enables the field for the type-ahead suggestions, revcat cannot aggregate nested fields for them
+type FieldMapping struct {
+	Field   string `toml:"field" json:"field"`
+	And     bool   `toml:"and" json:"and"`
+	Suggest bool   `toml:"suggest" json:"suggest"`
+}
+
+func (fm *FieldMapping) UnmarshalTOML(data any) error {
+	fm.And = true
+	switch d := data.(type) {
+	case string:
+		fm.Field = d
+	case map[string]any:
+		field, ok := d["field"].(string)
+		if !ok {
+			return errors.Errorf("field missing in field mapping %v", d)
+		}
+		fm.Field = field
+		if and, ok := d["and"]; ok {
+			if fm.And, ok = and.(bool); !ok {
+				return errors.Errorf("and must be boolean in field mapping %v", d)
+			}
+		}
+		if suggest, ok := d["suggest"]; ok {
+			if fm.Suggest, ok = suggest.(bool); !ok {
+				return errors.Errorf("suggest must be boolean in field mapping %v", d)
+			}
+			if fm.Suggest && aggregationField(fm.Field) != fm.Field {
+				return errors.Errorf("suggest is not supported for nested field in field mapping %v", d)
+			}
+		}
+	default:
+		return errors.Errorf("invalid field mapping %v", data)
+	}
+	return nil
+}
+
 func NewJWT(secret string, subject string, alg string, valid int64, domain string, issuer string, userId string) (tokenString string, err error) {
 
 	var signingMethod jwt.SigningMethod
@@ -220,18 +261,7 @@ func (ctrl *Controller) funcMap(name string) template.FuncMap {
 	fm["toJSStr"] = func(s string) template.JSStr {
 		return template.JSStr(s)
 	}
-	fm["localize"] = func(key, lang string) string {
-		localizer := i18n.NewLocalizer(ctrl.bundle, lang)
-
-		result, err := localizer.LocalizeMessage(&i18n.Message{
-			ID: key,
-		})
-		if err != nil {
-			return key
-			// return fmt.Sprintf("cannot localize '%s': %v", key, err)
-		}
-		return result // fmt.Sprintf("%s (%s)", result, lang)
-	}
+	fm["localize"] = ctrl.localize
 	fm["slug"] = func(s string, lang string) string {
 		return strings.Replace(slug.MakeLang(s, lang), "-", "_", -1)
 	}
@@ -246,14 +276,7 @@ func (ctrl *Controller) funcMap(name string) template.FuncMap {
 
 	fm["calcAspectSize"] = CalcAspectSize
 
-	fm["multiLang"] = func(mf []*client.MultiLangFragment) *translate.MultiLangString {
-		m := &translate.MultiLangString{}
-		for _, f := range mf {
-			lang, _ := language.Parse(f.Lang)
-			m.Set(f.Value, lang, f.Translated)
-		}
-		return m
-	}
+	fm["multiLang"] = multiLangString
 	fm["name"] = func() string { return name }
 	var checkHTMLRegexp = regexp.MustCompile(`<\/?[a-zA-Z][\s\S]*>`)
 	fm["nl2br"] = func(s string) string {
@@ -262,39 +285,81 @@ func (ctrl *Controller) funcMap(name string) template.FuncMap {
 		}
 		return strings.Replace(s, "\n", "<br>\n", -1)
 	}
-	mediaMatch := regexp.MustCompile(`^mediaserver:([^/]+)/([^/]+)$`)
-	fm["medialink"] = func(uri, action, param string, token bool) string {
-		matches := mediaMatch.FindStringSubmatch(uri)
-		params := strings.Split(param, "/")
-		sort.Strings(params)
-		// if not matching, just return the uri
-		if matches == nil {
-			return uri
-		}
-		collection := matches[1]
-		signature := matches[2]
-		urlstr := fmt.Sprintf("%s/%s/%s/%s/%s", ctrl.mediaserverBase, collection, signature, action, param)
-		if token {
-			jwt, err := NewJWT(
-				ctrl.mediaserverKey,
-				strings.TrimRight(fmt.Sprintf("mediaserver:%s/%s/%s/%s", collection, signature, action, strings.Join(params, "/")), "/"),
-				"HS256",
-				int64(ctrl.mediaserverTokenExp.Seconds()),
-				"mediaserver",
-				"mediathek",
-				"")
-			if err != nil {
-				return fmt.Sprintf("ERROR: %v", err)
-			}
-			urlstr = fmt.Sprintf("%s?token=%s", urlstr, jwt)
-		}
-		return urlstr
-	}
+	fm["medialink"] = ctrl.mediaLink
 
 	return fm
 }
 
-func NewController(localAddr, externalAddr, searchAddr, detailAddr string, protoHTTP bool, auth map[string]string, cert *tls.Certificate, templateFS, staticFS, dataFS fs.FS, client client.RevCatGraphQLClient, zoomPos map[string][]image.Rectangle, mediaserverBase, mediaserverKey string, mediaserverTokenExp time.Duration, bundle *i18n.Bundle, collections []*CollFacetType, fieldMapping map[string]string, embeddings *openai.ClientV2, templateDebug, zoomOnly bool, loginURL, loginIssuer, loginJWTKey string, loginJWTAlgs []string, locations map[string][]net.IPNet, facetInclude, facetExclude []string, mode string, logger zLogger.ZLogger) (*Controller, error) {
+// localize returns the message of key in lang or the key itself
+func (ctrl *Controller) localize(key, lang string) string {
+	localizer := i18n.NewLocalizer(ctrl.bundle, lang)
+
+	result, err := localizer.LocalizeMessage(&i18n.Message{
+		ID: key,
+	})
+	if err != nil {
+		return key
+		// return fmt.Sprintf("cannot localize '%s': %v", key, err)
+	}
+	return result // fmt.Sprintf("%s (%s)", result, lang)
+}
+
+var mediaMatch = regexp.MustCompile(`^mediaserver:([^/]+)/([^/]+)$`)
+
+// mediaLink creates the mediaserver url of uri, optionally with an access token
+func (ctrl *Controller) mediaLink(uri, action, param string, token bool) string {
+	matches := mediaMatch.FindStringSubmatch(uri)
+	params := strings.Split(param, "/")
+	sort.Strings(params)
+	// if not matching, just return the uri
+	if matches == nil {
+		return uri
+	}
+	collection := matches[1]
+	signature := matches[2]
+	urlstr := fmt.Sprintf("%s/%s/%s/%s/%s", ctrl.mediaserverBase, collection, signature, action, param)
+	if token {
+		jwt, err := NewJWT(
+			ctrl.mediaserverKey,
+			strings.TrimRight(fmt.Sprintf("mediaserver:%s/%s/%s/%s", collection, signature, action, strings.Join(params, "/")), "/"),
+			"HS256",
+			int64(ctrl.mediaserverTokenExp.Seconds()),
+			"mediaserver",
+			"mediathek",
+			"")
+		if err != nil {
+			return fmt.Sprintf("ERROR: %v", err)
+		}
+		urlstr = fmt.Sprintf("%s?token=%s", urlstr, jwt)
+	}
+	return urlstr
+}
+
+func NewController(localAddr, externalAddr, searchAddr, detailAddr string, protoHTTP bool, auth map[string]string, cert *tls.Certificate, templateFS, staticFS, dataFS fs.FS, client client.RevCatGraphQLClient, zoomPos map[string][]image.Rectangle, mediaserverBase, mediaserverKey string, mediaserverTokenExp time.Duration, bundle *i18n.Bundle, collections []*CollFacetType, fieldMapping map[string]*FieldMapping, embeddings EmbeddingProvider, feedTimes *FeedTimes, hybridWeight float64, hybridWindow int64, templateDebug, zoomOnly bool, loginURL, loginIssuer, loginJWTKey string, loginJWTAlgs []string, locations map[string][]net.IPNet, facets []*FacetConfig, sortOptions []*SortOption, oai *OAIConfig, mode string, logger zLogger.ZLogger) (*Controller, error) {
+	facets, err := initFacets(facets, fieldMapping)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid facet configuration")
+	}
+	sortOptions, err = initSortOptions(sortOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sort configuration")
+	}
+	if oai != nil && len(oai.AdminEmail) == 0 {
+		return nil, errors.New("oai configuration without admin email")
+	}
+	if feedTimes == nil {
+		feedTimes = NewFeedTimes(nil, 0, 0)
+	}
+
+	collFacet, _ := facetOfType(facets, facetTypeCollection)
+	collectionRegistry, err := newCollectionRegistry(collections, collFacet, fieldMapping)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid collection configuration")
+	}
+	gazetteer, err := loadGazetteer(dataFS)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load gazetteer")
+	}
 
 	ctrl := &Controller{
 		localAddr:           localAddr,
@@ -319,18 +384,27 @@ func NewController(localAddr, externalAddr, searchAddr, detailAddr string, proto
 		mediaserverTokenExp: mediaserverTokenExp,
 		bundle:              bundle,
 		embeddings:          embeddings,
+		feedTimes:           feedTimes,
+		hybridWeight:        hybridWeight,
+		hybridWindow:        hybridWindow,
 		zoomOnly:            zoomOnly,
 		languageMatcher:     language.NewMatcher(bundle.LanguageTags()),
 		collections:         collections,
+		collectionRegistry:  collectionRegistry,
+		gazetteer:           gazetteer,
 		loginURL:            loginURL,
 		loginIssuer:         loginIssuer,
 		loginJWTKey:         loginJWTKey,
 		loginJWTAlgs:        loginJWTAlgs,
 		locations:           locations,
-		facetInclude:        facetInclude,
-		facetExclude:        facetExclude,
+		facets:              facets,
+		sortOptions:         sortOptions,
+		oaiConfig:           oai,
 		mode:                mode,
 	}
+	ctrl.collectionStats = newGroupStats(ctrl.countCollections, collectionStatsInterval, collectionStatsExpiry, logger)
+	ctrl.dateStats = newGroupStats(ctrl.dateValues, collectionStatsInterval, collectionStatsExpiry, logger)
+	ctrl.placeStats = newGroupStats(ctrl.geocodedPlaces, collectionStatsInterval, collectionStatsExpiry, logger)
 	ctrl.logger.Info().Msgf("Zoom only: %v", ctrl.zoomOnly)
 	if err := ctrl.init(); err != nil {
 		return nil, errors.Wrap(err, "cannot initialize controller")
@@ -570,6 +644,7 @@ func (ctrl *Controller) init() error {
 		ctrl.kontaktPage(c)
 	})
 
+	router.GET("/collection/:id/:lang", ctrl.collectionPage)
 	router.GET("/zoom/signature/:PosX/:PosY", ctrl.zoomSignature)
 	router.GET("/zoom/:lang", ctrl.zoomPage)
 	router.GET("/zoom", func(c *gin.Context) {
@@ -659,6 +734,78 @@ func (ctrl *Controller) init() error {
 		ctrl.searchPage(c, "list")
 	})
 
+	router.GET("/map", func(c *gin.Context) {
+		cookieLang, _ := c.Request.Cookie("lang")
+		accept := c.Request.Header.Get("Accept-Language")
+		langTag, _ := language.MatchStrings(ctrl.languageMatcher, cookieLang.String(), accept)
+		langBase, _ := langTag.Base()
+		lang := langBase.String()
+		if !slices.Contains([]string{"de", "en", "fr", "it"}, lang) {
+			lang = "en"
+		}
+		newURL := "/map/" + lang
+		if c.Request.URL.RawQuery != "" {
+			newURL += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusTemporaryRedirect, newURL)
+	})
+	router.POST("/map/:lang", func(c *gin.Context) {
+		ctrl.searchPage(c, "map")
+	})
+	router.GET("/map/:lang", func(c *gin.Context) {
+		ctrl.searchPage(c, "map")
+	})
+
+	router.GET("/timeline", func(c *gin.Context) {
+		cookieLang, _ := c.Request.Cookie("lang")
+		accept := c.Request.Header.Get("Accept-Language")
+		langTag, _ := language.MatchStrings(ctrl.languageMatcher, cookieLang.String(), accept)
+		langBase, _ := langTag.Base()
+		lang := langBase.String()
+		if !slices.Contains([]string{"de", "en", "fr", "it"}, lang) {
+			lang = "en"
+		}
+		newURL := "/timeline/" + lang
+		if c.Request.URL.RawQuery != "" {
+			newURL += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusTemporaryRedirect, newURL)
+	})
+	router.POST("/timeline/:lang", func(c *gin.Context) {
+		ctrl.searchPage(c, "timeline")
+	})
+	router.GET("/timeline/:lang", func(c *gin.Context) {
+		ctrl.searchPage(c, "timeline")
+	})
+
+	router.GET("/api/search/:lang", func(c *gin.Context) {
+		ctrl.searchAPI(c)
+	})
+	router.POST("/api/search/:lang", func(c *gin.Context) {
+		ctrl.searchAPI(c)
+	})
+	router.GET("/api/collections", ctrl.collectionStatsJSON)
+	router.GET("/api/suggest/:lang", func(c *gin.Context) {
+		ctrl.suggest(c)
+	})
+	router.GET("/export/:format/:lang", func(c *gin.Context) {
+		ctrl.export(c)
+	})
+	router.GET("/feed/:format/:lang", func(c *gin.Context) {
+		ctrl.feed(c)
+	})
+	if ctrl.oaiConfig != nil {
+		router.GET("/oai", func(c *gin.Context) {
+			ctrl.oai(c)
+		})
+		router.POST("/oai", func(c *gin.Context) {
+			ctrl.oai(c)
+		})
+	}
+	router.GET("/opensearch/:lang", func(c *gin.Context) {
+		ctrl.openSearch(c)
+	})
+
 	router.GET("/detailtext/:signature/:lang", func(c *gin.Context) {
 		ctrl.detailText(c)
 	})
@@ -672,6 +819,21 @@ func (ctrl *Controller) init() error {
 	router.GET("/detail/:signature/:lang", func(c *gin.Context) {
 		ctrl.detail(c)
 	})
+	router.GET("/iiif/:signature/manifest.json", func(c *gin.Context) {
+		ctrl.iiifManifest(c)
+	})
+	router.GET("/cite/:signature/:lang/:format", func(c *gin.Context) {
+		ctrl.cite(c)
+	})
+	router.GET("/iiif/image/:id", func(c *gin.Context) {
+		c.Redirect(http.StatusSeeOther, ctrl.iiifImageBase(c.Param("id"))+"/info.json")
+	})
+	router.GET("/iiif/image/:id/info.json", func(c *gin.Context) {
+		ctrl.iiifImageInfo(c)
+	})
+	router.GET("/iiif/image/:id/:region/:size/:rotation/:file", func(c *gin.Context) {
+		ctrl.iiifImage(c)
+	})
 
 	router.GET("/detail/:signature", func(c *gin.Context) {
 		cookieLang, _ := c.Request.Cookie("lang")
@@ -734,6 +896,7 @@ type Controller struct {
 	templateDebug       bool
 	templateCache       map[string]any
 	templateMutex       sync.Mutex
+	feedTimes           *FeedTimes
 	client              client.RevCatGraphQLClient
 	mediaserverBase     string
 	bundle              *i18n.Bundle
@@ -741,12 +904,19 @@ type Controller struct {
 	searchAddr          string
 	detailAddr          string
 	zoomPos             map[string][]image.Rectangle
-	embeddings          *openai.ClientV2
+	embeddings          EmbeddingProvider
+	hybridWeight        float64
+	hybridWindow        int64
 	zoomOnly            bool
 	protoHTTP           bool
 	auth                map[string]string
 	collections         []*CollFacetType
-	fieldMapping        map[string]string
+	collectionRegistry  *collectionRegistry
+	collectionStats     *groupStats[map[int64]int]
+	dateStats           *groupStats[[]string]
+	placeStats          *groupStats[map[string]geoPoint]
+	gazetteer           *gazetteer
+	fieldMapping        map[string]*FieldMapping
 	loginURL            string
 	loginIssuer         string
 	loginJWTKey         string
@@ -754,8 +924,9 @@ type Controller struct {
 	locations           map[string][]net.IPNet
 	mediaserverKey      string
 	mediaserverTokenExp time.Duration
-	facetInclude        []string
-	facetExclude        []string
+	facets              []*FacetConfig
+	sortOptions         []*SortOption
+	oaiConfig           *OAIConfig
 	mode                string
 }
 
@@ -777,6 +948,9 @@ func (ctrl *Controller) locationGroups(ctx *gin.Context) []string {
 }
 
 func (ctrl *Controller) Start() error {
+	ctrl.dateStats.Start()
+	ctrl.placeStats.Start()
+	ctrl.collectionStats.Start()
 	go func() {
 		if ctrl.srv.TLSConfig == nil {
 			fmt.Printf("starting server at http://%s\n", ctrl.localAddr)
@@ -798,6 +972,9 @@ func (ctrl *Controller) Start() error {
 }
 
 func (ctrl *Controller) Stop() error {
+	defer ctrl.dateStats.Stop()
+	defer ctrl.placeStats.Stop()
+	defer ctrl.collectionStats.Stop()
 	return ctrl.srv.Shutdown(context.Background())
 }
 
@@ -823,7 +1000,6 @@ func (ctrl *Controller) impressumPage(c *gin.Context) {
 		Collections map[int64]*CollFacetType `json:"collections"`
 	}
 	var data = &tplData{
-		Collections: map[int64]*CollFacetType{},
 		baseData: baseData{
 			Lang:       lang,
 			RootPath:   "../../",
@@ -834,83 +1010,13 @@ func (ctrl *Controller) impressumPage(c *gin.Context) {
 			Mode:       ctrl.mode,
 		},
 	}
-	collFacet := &client.InFacet{
-		Term: &client.InFacetTerm{
-			Name:        "collections",
-			Field:       "category.keyword",
-			Size:        200,
-			MinDocCount: 0,
-			Include:     []string{},
-			Exclude:     []string{},
-		},
-		Query: &client.InFilter{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "tags.keyword",
-				Values: []string{},
-				And:    false,
-			},
-		},
-	}
-	for _, coll := range ctrl.collections {
-		parts := strings.SplitN(coll.Identifier, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		val := strings.Trim(parts[1], "\" ")
-		collFacet.Term.Include = append(collFacet.Term.Include, val)
-		switch parts[0] {
-		case "cat":
-			collFacet.Query.BoolTerm.Values = append(collFacet.Query.BoolTerm.Values, val)
-		default:
-			ctrl.logger.Error().Err(err).Msgf("unknown collection identifier '%s'", coll.Identifier)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown collection identifier '%s'", coll.Identifier))
-			return
-		}
-	}
-	var size int64 = 1
-	var sortField = c.Query("sortField")
-	var sortOrder = c.Query("sortOrder")
-	var sort = []*client.SortField{}
-	if sortField != "" {
-		sort = append(sort, &client.SortField{
-			Field: sortField,
-			Order: sortOrder,
-		})
-	}
-	result, err := ctrl.client.Search(c, "", []*client.InFacet{collFacet}, nil, nil, nil, &size, nil, sort)
+	collections, err := ctrl.collectionsWithCounts(c)
 	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", "")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", "", err))
+		ctrl.logger.Error().Err(err).Msg("cannot count collections")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot count collections: %v", err))
 		return
 	}
-
-	for _, coll := range ctrl.collections {
-		data.Collections[coll.Id] = coll
-	}
-
-	for _, facet := range result.GetSearch().GetFacets() {
-		switch facet.GetName() {
-		case "collections":
-			for _, val := range facet.GetValues() {
-				strVal := val.GetFacetValueString()
-				if strVal == nil {
-					continue
-				}
-				facetStr := strVal.GetStrVal()
-				colls := data.Collections
-				for _, coll := range colls {
-					parts := strings.SplitN(coll.Identifier, ":", 2)
-					if len(parts) != 2 {
-						continue
-					}
-					cVal := strings.Trim(parts[1], "\" ")
-					if cVal == facetStr {
-						coll.Count = int(strVal.GetCount())
-					}
-				}
-			}
-		}
-	}
+	data.Collections = collections
 
 	if err := impressumTemplate.Execute(c.Writer, data); err != nil {
 		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
@@ -941,7 +1047,6 @@ func (ctrl *Controller) kontaktPage(c *gin.Context) {
 		Collections map[int64]*CollFacetType `json:"collections"`
 	}
 	var data = &tplData{
-		Collections: map[int64]*CollFacetType{},
 		baseData: baseData{
 			Lang:       lang,
 			RootPath:   "../../",
@@ -952,83 +1057,13 @@ func (ctrl *Controller) kontaktPage(c *gin.Context) {
 			Mode:       ctrl.mode,
 		},
 	}
-	collFacet := &client.InFacet{
-		Term: &client.InFacetTerm{
-			Name:        "collections",
-			Field:       "category.keyword",
-			Size:        200,
-			MinDocCount: 0,
-			Include:     []string{},
-			Exclude:     []string{},
-		},
-		Query: &client.InFilter{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "tags.keyword",
-				Values: []string{},
-				And:    false,
-			},
-		},
-	}
-	for _, coll := range ctrl.collections {
-		parts := strings.SplitN(coll.Identifier, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		val := strings.Trim(parts[1], "\" ")
-		collFacet.Term.Include = append(collFacet.Term.Include, val)
-		switch parts[0] {
-		case "cat":
-			collFacet.Query.BoolTerm.Values = append(collFacet.Query.BoolTerm.Values, val)
-		default:
-			ctrl.logger.Error().Err(err).Msgf("unknown collection identifier '%s'", coll.Identifier)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown collection identifier '%s'", coll.Identifier))
-			return
-		}
-	}
-	var size int64 = 1
-	var sortField = c.Query("sortField")
-	var sortOrder = c.Query("sortOrder")
-	var sort = []*client.SortField{}
-	if sortField != "" {
-		sort = append(sort, &client.SortField{
-			Field: sortField,
-			Order: sortOrder,
-		})
-	}
-	result, err := ctrl.client.Search(c, "", []*client.InFacet{collFacet}, nil, nil, nil, &size, nil, sort)
+	collections, err := ctrl.collectionsWithCounts(c)
 	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", "")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", "", err))
+		ctrl.logger.Error().Err(err).Msg("cannot count collections")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot count collections: %v", err))
 		return
 	}
-
-	for _, coll := range ctrl.collections {
-		data.Collections[coll.Id] = coll
-	}
-
-	for _, facet := range result.GetSearch().GetFacets() {
-		switch facet.GetName() {
-		case "collections":
-			for _, val := range facet.GetValues() {
-				strVal := val.GetFacetValueString()
-				if strVal == nil {
-					continue
-				}
-				facetStr := strVal.GetStrVal()
-				colls := data.Collections
-				for _, coll := range colls {
-					parts := strings.SplitN(coll.Identifier, ":", 2)
-					if len(parts) != 2 {
-						continue
-					}
-					cVal := strings.Trim(parts[1], "\" ")
-					if cVal == facetStr {
-						coll.Count = int(strVal.GetCount())
-					}
-				}
-			}
-		}
-	}
+	data.Collections = collections
 
 	if err := impressumTemplate.Execute(c.Writer, data); err != nil {
 		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
@@ -1059,7 +1094,6 @@ func (ctrl *Controller) indexPage(ctx *gin.Context) {
 		Collections map[int64]*CollFacetType `json:"collections"`
 	}
 	var data = &tplData{
-		Collections: map[int64]*CollFacetType{},
 		baseData: baseData{
 			Lang:       lang,
 			RootPath:   "",
@@ -1072,111 +1106,13 @@ func (ctrl *Controller) indexPage(ctx *gin.Context) {
 		},
 	}
 
-	collFacet := &client.InFacet{
-		Term: &client.InFacetTerm{
-			Name:        "collections",
-			Field:       "category.keyword",
-			Size:        200,
-			MinDocCount: 0,
-			Include:     []string{},
-			Exclude:     []string{},
-		},
-		Query: &client.InFilter{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "tags.keyword",
-				Values: []string{},
-				And:    false,
-			},
-		},
-	}
-	for _, coll := range ctrl.collections {
-		parts := strings.SplitN(coll.Identifier, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		val := strings.Trim(parts[1], "\" ")
-		collFacet.Term.Include = append(collFacet.Term.Include, val)
-		switch parts[0] {
-		case "cat":
-			collFacet.Query.BoolTerm.Values = append(collFacet.Query.BoolTerm.Values, val)
-		default:
-			ctrl.logger.Error().Err(err).Msgf("unknown collection identifier '%s'", coll.Identifier)
-			ctx.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown collection identifier '%s'", coll.Identifier))
-			return
-		}
-	}
-	var size int64 = 1
-	var sortField = ctx.Query("sortField")
-	var sortOrder = ctx.Query("sortOrder")
-	var sort = []*client.SortField{}
-	if sortField != "" {
-		sort = append(sort, &client.SortField{
-			Field: sortField,
-			Order: sortOrder,
-		})
-	}
-	user := GetUser(ctx)
-	filter := []*client.InFilter{
-		{
-			ExistsTerm: &client.InFilterExistsTerm{
-				Field: "poster",
-			},
-		},
-		{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "acl.content.keyword",
-				Values: user.Groups,
-			},
-		},
-	}
-	facets := []*client.InFacet{}
-	if len(collFacet.Query.BoolTerm.Values) > 0 {
-		facets = append(facets, collFacet)
-	}
-	result, err := ctrl.client.Search(ctx, "", facets, filter, nil, nil, &size, nil, sort)
+	collections, err := ctrl.collectionsWithCounts(ctx)
 	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", "")
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", "", err))
+		ctrl.logger.Error().Err(err).Msg("cannot count collections")
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot count collections: %v", err))
 		return
 	}
-
-	//var str string
-	for _, coll := range ctrl.collections {
-		data.Collections[coll.Id] = coll
-		/*
-			str += fmt.Sprintf("[[collection]]\n")
-			str += fmt.Sprintf("id = %d\n", coll.Id)
-			str += fmt.Sprintf("identifier = \"%s\"\n", strings.Replace(coll.Identifier, "\"", "\\\"", -1))
-			str += fmt.Sprintf("title = \"%s\"\n", strings.Replace(coll.GetTitle(), "\"", "\\\"", -1))
-			str += fmt.Sprintf("url = \"%s\"\n", coll.GetUrl())
-			str += fmt.Sprintf("image = \"%s\"\n\n", coll.Image)
-		*/
-	}
-	//ctrl.logger.Debug().Msg(str)
-
-	for _, facet := range result.GetSearch().GetFacets() {
-		switch facet.GetName() {
-		case "collections":
-			for _, val := range facet.GetValues() {
-				strVal := val.GetFacetValueString()
-				if strVal == nil {
-					continue
-				}
-				facetStr := strVal.GetStrVal()
-				colls := data.Collections
-				for _, coll := range colls {
-					parts := strings.SplitN(coll.Identifier, ":", 2)
-					if len(parts) != 2 {
-						continue
-					}
-					cVal := strings.Trim(parts[1], "\" ")
-					if cVal == facetStr {
-						coll.Count = int(strVal.GetCount())
-					}
-				}
-			}
-		}
-	}
+	data.Collections = collections
 
 	if err := indexTemplate.Execute(ctx.Writer, data); err != nil {
 		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
@@ -1274,218 +1210,96 @@ func (ctrl *Controller) searchPage(c *gin.Context, page string) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot load template '%s': %v", templateName, err))
 		return
 	}
-	searchString := c.Query("search")
-	filterStrings, queryString, err := parseQuery(searchString)
+	params := newSearchParams(c.Request.URL.Query())
+	// the timeline keeps the sort of the search. The dates are free form strings, the hits of a page
+	// are placed in the buckets of their years, but a sort by date would not be chronological
+	sr, err := ctrl.search(c, params)
 	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot parse query '%s'", searchString)
-		// c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot parse query '%s': %v", searchString, err))
-		queryString = searchString
-	}
-
-	cursorString := c.Query("cursor")
-	ki := c.Request.URL.Query().Has("ki")
-	collectionsString := c.Query("collections")
-	parts := strings.Split(collectionsString, ",")
-	collectionIDs := []int{}
-	for _, part := range parts {
-		collID, err := strconv.Atoi(part)
-		if err != nil || collID == 0 {
-			continue
-		}
-		collectionIDs = append(collectionIDs, collID)
-	}
-	vocabularyString := c.Query("vocabulary")
-	parts = strings.Split(vocabularyString, ",")
-	vocabularyIDs := []string{}
-	for _, part := range parts {
-		vocabularyID := strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
-		vocabularyIDs = append(vocabularyIDs, vocabularyID)
-	}
-	vocFacet := &client.InFacet{
-		Term: &client.InFacetTerm{
-			Name:        "vocabulary",
-			Field:       "tags.keyword",
-			Size:        1200,
-			MinDocCount: 1,
-			Include:     []string{},
-			Exclude:     []string{},
-		},
-		Query: &client.InFilter{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "tags.keyword",
-				Values: vocabularyIDs,
-				And:    true,
-			},
-		},
-	}
-	if len(ctrl.facetInclude) > 0 {
-		vocFacet.Term.Include = append(vocFacet.Term.Include, ctrl.facetInclude...)
-	}
-	if len(ctrl.facetExclude) > 0 {
-		vocFacet.Term.Exclude = append(vocFacet.Term.Exclude, ctrl.facetExclude...)
-	}
-	collFacet := &client.InFacet{
-		Term: &client.InFacetTerm{
-			Name:        "collections",
-			Field:       "category.keyword",
-			Size:        200,
-			MinDocCount: 0,
-			Include:     []string{},
-			Exclude:     []string{},
-		},
-		Query: &client.InFilter{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "category.keyword",
-				Values: []string{},
-				And:    false,
-			},
-		},
+		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", params.Search)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", params.Search, err))
+		return
 	}
-	for _, coll := range ctrl.collections {
-		parts := strings.SplitN(coll.Identifier, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		val := strings.Trim(parts[1], "\" ")
-		collFacet.Term.Include = append(collFacet.Term.Include, val)
-		if len(collectionIDs) == 0 || slices.Contains(collectionIDs, int(coll.Id)) {
-			switch parts[0] {
-			case "cat":
-				collFacet.Query.BoolTerm.Values = append(collFacet.Query.BoolTerm.Values, val)
-			default:
-				ctrl.logger.Error().Err(err).Msgf("unknown collection identifier '%s'", coll.Identifier)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown collection identifier '%s'", coll.Identifier))
-				return
-			}
-		}
+	currentSearchURL := params.values()
+	var searchParams string
+	if len(currentSearchURL) > 0 {
+		searchParams = "?" + currentSearchURL.Encode()
 	}
-
-	var result *client.Search
-	var embedding64 = []float64{}
-	//queryString := searchString
-	if ki && searchString != "" {
-		embedding, err := ctrl.embeddings.CreateEmbedding(searchString, oai.SmallEmbedding3)
-		if err != nil {
-			ctrl.logger.Error().Err(err).Msgf("cannot create embedding for '%s'", searchString)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot create embedding for '%s': %v", searchString, err))
+	_, isExhibition := c.GetQuery("exhibition")
+	// the links of the sort options replace the current sort
+	sortParams := params.values()
+	sortParams.Del("sort")
+	sortParams.Del("sortOrder")
+	// the links of the page sizes start with the first page
+	pageSizeParams := params.values()
+	pageSizeParams.Del("size")
+	// the links of the map replace the bounding box
+	mapParams := params.values()
+	mapParams.Del("bbox")
+	var mapData *mapView
+	if page == "map" {
+		if mapData, err = ctrl.searchMap(c, sr); err != nil {
+			ctrl.logger.Error().Err(err).Msgf("cannot search places of '%s'", params.Search)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search places of '%s': %v", params.Search, err))
 			return
 		}
-		for _, v := range embedding.Embedding {
-			embedding64 = append(embedding64, float64(v))
-		}
-		queryString = ""
 	}
-	var sortField = c.Query("sortField")
-	var sortOrder = c.Query("sortOrder")
-	var sort = []*client.SortField{}
-	if sortField != "" {
-		sort = append(sort, &client.SortField{
-			Field: sortField,
-			Order: sortOrder,
-		})
+	edges := []*searchEdge{}
+	for _, e := range sr.Result.GetSearch().GetEdges() {
+		edges = append(edges, newSearchEdge(e))
 	}
-	user := GetUser(c)
-	filter := []*client.InFilter{
-		{
-			ExistsTerm: &client.InFilterExistsTerm{
-				Field: "poster",
-			},
-		},
-		{
-			BoolTerm: &client.InFilterBoolTerm{
-				Field:  "acl.content.keyword",
-				Values: user.Groups,
-			},
-		},
-	}
-	if len(filterStrings) > 0 {
-		for field, value := range filterStrings {
-			internalField, ok := ctrl.fieldMapping[field]
-			if !ok {
-				ctrl.logger.Error().Msgf("unknown field '%s'", field)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown field '%s'", field))
-				return
-			}
-			filter = append(filter, &client.InFilter{
-				BoolTerm: &client.InFilterBoolTerm{
-					Field:  internalField,
-					Values: []string{strings.Trim(value, "\" ")},
-					And:    true,
-				},
-			})
+	// the links of the timeline replace the date range
+	timelineParams := params.values()
+	timelineParams.Del("dates")
+	var timelineData *timeline
+	if page == "timeline" {
+		if timelineData, err = ctrl.searchTimeline(c, sr, edges); err != nil {
+			ctrl.logger.Error().Err(err).Msgf("cannot search dates of '%s'", params.Search)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search dates of '%s': %v", params.Search, err))
+			return
 		}
 	}
-	result, err = ctrl.client.Search(c, queryString, []*client.InFacet{collFacet, vocFacet}, filter, embedding64, nil, nil, &cursorString, sort)
-	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", searchString)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", searchString, err))
-		return
-	}
-
-	type vocFacetType struct {
-		Name    string `json:"name"`
-		Count   int    `json:"count"`
-		Checked bool   `json:"checked"`
-	}
-
-	type collFacetType struct {
-		ID      int    `json:"id"`
-		Name    string `json:"name"`
-		Count   int    `json:"count"`
-		Checked bool   `json:"checked"`
-	}
-	type edge struct {
-		Edge             *client.Search_Search_Edges `json:"edge"`
-		Title            *translate.MultiLangString  `json:"title"`
-		Persons          string                      `json:"persons"`
-		Type             string                      `json:"type"`
-		Date             string                      `json:"date"`
-		PersonRole       map[string][]string
-		ShowContent      bool
-		ProtectedContent bool
-	}
-	currentSearchURL := url.Values{}
-	if searchString != "" {
-		currentSearchURL.Set("search", searchString)
-	}
-	if collectionsString != "" {
-		currentSearchURL.Set("collections", collectionsString)
-	}
-	if vocabularyString != "" {
-		currentSearchURL.Set("vocabulary", vocabularyString)
-	}
-	var searchParams string
-	if len(currentSearchURL) > 0 {
-		searchParams = "?" + currentSearchURL.Encode()
-	}
-	_, isExhibition := c.GetQuery("exhibition")
 
+	facets := ctrl.searchFacets(sr, lang)
 	data := struct {
 		baseData
 		//Result           *client.Search_Search      `json:"result"`
-		TotalCount       int                        `json:"totalCount"`
-		PageInfo         *client.PageInfoFragment   `json:"pageInfo"`
-		Edges            []*edge                    `json:"edges"`
-		MediaserverBase  string                     `json:"mediaserverBase"`
-		RequestQuery     *queryData                 `json:"request"`
-		CollectionFacets []*collFacetType           `json:"collectionFacets"`
-		VocabularyFacets map[string][]*vocFacetType `json:"vocabularyFacets"`
+		TotalCount        int                      `json:"totalCount"`
+		PageInfo          *client.PageInfoFragment `json:"pageInfo"`
+		Edges             []*searchEdge            `json:"edges"`
+		MediaserverBase   string                   `json:"mediaserverBase"`
+		RequestQuery      *queryData               `json:"request"`
+		QueryError        string                   `json:"queryError,omitempty"`
+		CollectionFacets  []*collFacetType         `json:"collectionFacets"`
+		VocabularyFacets  []*vocNode               `json:"vocabularyFacets"`
+		VocabularyChecked []*vocNode               `json:"vocabularyChecked"`
+		Expand            string                   `json:"expand"`
+		DateFacets        []*dateFacetType         `json:"dateFacets"`
+		Facets            []*facetType             `json:"facets"`
+		SortOptions       []*SortOption            `json:"sortOptions"`
+		Sort              string                   `json:"sort"`
+		SortOrder         string                   `json:"sortOrder"`
+		SortParams        template.URL             `json:"-"`
+		Pagination        *pagination              `json:"pagination"`
+		PageSizeParams    template.URL             `json:"-"`
+		Map               *mapView                 `json:"map,omitempty"`
+		MapParams         template.URL             `json:"-"`
+		BBox              string                   `json:"bbox,omitempty"`
+		Timeline          *timeline                `json:"timeline,omitempty"`
+		TimelineParams    template.URL             `json:"-"`
 	}{
 		//Result:          result.GetSearch(),
 		MediaserverBase: ctrl.mediaserverBase,
-		PageInfo:        result.GetSearch().GetPageInfo(),
+		PageInfo:        sr.pageInfo(),
+		QueryError:      sr.QueryError,
 		baseData: baseData{
 			Mode:       ctrl.mode,
 			Lang:       lang,
 			Exhibition: isExhibition,
-			KI:         ki,
+			KI:         params.KI,
 			//Search:     template.URL(currentSearchURL.Encode()),
 			//			Search:       template.URL(fmt.Sprintf("%s/search/%s%s", ctrl.searchAddr, lang, searchParams)),
 			//			SearchParams: searchParams,
-			Cursor:     cursorString,
+			Cursor:     params.Cursor,
 			Params:     template.URL(strings.TrimLeft(searchParams, "?&	")),
 			RootPath:   "../",
 			SearchAddr: ctrl.searchAddr,
@@ -1495,133 +1309,32 @@ func (ctrl *Controller) searchPage(c *gin.Context, page string) {
 			Self:       fmt.Sprintf("%s%s", ctrl.externalAddr, c.Request.URL.Path),
 			User:       GetUser(c),
 		},
-		TotalCount: int(result.GetSearch().GetTotalCount()),
+		TotalCount: int(sr.Result.GetSearch().GetTotalCount()),
 		RequestQuery: &queryData{
-			Search: searchString,
+			Search: params.Search,
 		},
-		CollectionFacets: []*collFacetType{},
-		VocabularyFacets: map[string][]*vocFacetType{},
+		CollectionFacets:  facets.CollectionFacets,
+		VocabularyFacets:  facets.VocabularyFacets,
+		VocabularyChecked: facets.VocabularyChecked,
+		Expand:            params.Expand,
+		DateFacets:        facets.DateFacets,
+		Facets:            facets.Facets,
+		SortOptions:       ctrl.sortOptions,
+		Sort:              sr.Sort,
+		SortOrder:         sr.SortOrder,
+		SortParams:        template.URL(sortParams.Encode()),
+		Pagination:        sr.Pagination,
+		PageSizeParams:    template.URL(pageSizeParams.Encode()),
+		Map:               mapData,
+		MapParams:         template.URL(mapParams.Encode()),
+		BBox:              params.BBox,
+		Edges:             edges,
+		Timeline:          timelineData,
+		TimelineParams:    template.URL(timelineParams.Encode()),
 	}
 	if data.baseData.User.IsLoggedIn() {
 		data.baseData.DetailAddr = data.baseData.SearchAddr
 	}
-	for _, e := range result.GetSearch().GetEdges() {
-		ne := &edge{
-			Edge:       e,
-			Title:      &translate.MultiLangString{},
-			Type:       emptyIfNil(e.Base.GetType()),
-			Date:       emptyIfNil(e.Base.GetDate()),
-			PersonRole: map[string][]string{},
-			//ShowContent:      false,
-			//ProtectedContent: false,
-		}
-		for _, t := range e.Base.GetTitle() {
-			ne.Title.Set(t.Value, language.MustParse(t.Lang), t.Translated)
-		}
-		var firstPerson string
-		for _, p := range e.Base.GetPerson() {
-			if firstPerson == "" {
-				firstPerson = p.GetName()
-			}
-			if ne.Persons != "" {
-				ne.Persons += "; "
-			}
-			ne.Persons += p.GetName()
-			var role = "author"
-			if p.GetRole() != nil {
-				role = *p.GetRole()
-			}
-			if _, ok := ne.PersonRole[role]; !ok {
-				ne.PersonRole[role] = []string{}
-			}
-			ne.PersonRole[role] = append(ne.PersonRole[role], p.GetName())
-		}
-		if len(ne.Persons) > 30 && len(e.Base.GetPerson()) > 1 {
-			ne.Persons = firstPerson + " et al."
-		}
-		data.Edges = append(data.Edges, ne)
-	}
-	for _, facet := range result.GetSearch().GetFacets() {
-		switch facet.GetName() {
-		case "vocabulary":
-			for _, val := range facet.GetValues() {
-				strVal := val.GetFacetValueString()
-				if strVal == nil {
-					continue
-				}
-				facetStr := strVal.GetStrVal()
-				parts := strings.Split(facetStr, ":")
-				// 16:9  4:3
-				if len(parts) == 2 && len(parts[1]) < 3 {
-					parts = []string{facetStr}
-				}
-				var name string
-				var parent = "generic"
-				if len(parts) == 1 {
-					name = parts[0]
-				} else if len(parts) == 3 {
-
-					if val.GetFacetValueInt() == nil || val.GetFacetValueInt().GetIntVal() == 0 {
-						if !strings.HasPrefix(parts[1], "voc_") {
-							continue
-						}
-					}
-					parent = parts[1] // slug.MakeLang(parts[1], "de")
-					name = parts[2]
-					if _, ok := data.VocabularyFacets[parent]; !ok {
-						data.VocabularyFacets[parts[1]] = []*vocFacetType{}
-					}
-				} else {
-					continue
-				}
-				data.VocabularyFacets[parent] = append(data.VocabularyFacets[parent], &vocFacetType{
-					Count:   int(strVal.GetCount()),
-					Name:    name,
-					Checked: slices.Contains(vocabularyIDs, facetStr),
-				})
-			}
-
-		case "collections":
-			for _, val := range facet.GetValues() {
-				strVal := val.GetFacetValueString()
-				if strVal == nil {
-					continue
-				}
-				facetStr := strVal.GetStrVal()
-				cf := &collFacetType{
-					Count: int(strVal.GetCount()),
-				}
-				for _, coll := range ctrl.collections {
-					parts := strings.SplitN(coll.Identifier, ":", 2)
-					if len(parts) != 2 {
-						continue
-					}
-					cVal := strings.Trim(parts[1], "\" ")
-					if cVal == facetStr {
-						cf.ID = int(coll.Id)
-						cf.Name = coll.Title
-						cf.Checked = slices.Contains(collectionIDs, int(coll.Id))
-						data.CollectionFacets = append(data.CollectionFacets, cf)
-					}
-				}
-			}
-		}
-	}
-	var str string
-	/*
-		for _, vf := range data.VocabularyFacets {
-			for _, v := range vf {
-				str += fmt.Sprintf("\"%s\" = \"%s\"\n", v.Name, strings.TrimPrefix(v.Name, "voc_"))
-			}
-
-		}
-
-	*/
-	for v, _ := range data.VocabularyFacets {
-		str += fmt.Sprintf("\"%s\" = \"%s\"\n", v, strings.TrimPrefix(v, "voc_"))
-
-	}
-
 	if err := gridTemplate.Execute(c.Writer, data); err != nil {
 		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot execute template '%s': %v", templateName, err))
@@ -1660,7 +1373,6 @@ func (ctrl *Controller) detailText(c *gin.Context) {
 	if !ctrl.langAvailable(lang) {
 		lang = "de"
 	}
-	templateName := "detail_text.gotmpl"
 	id := c.Param("signature")
 	if id == "" {
 		ctrl.logger.Error().Msgf("id missing")
@@ -1679,14 +1391,19 @@ func (ctrl *Controller) detailText(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' not found", id))
 		return
 	}
+	ctrl.writeDetailText(c, source.MediathekEntries[0], lang)
+}
 
+// writeDetailText renders the markdown representation of an entry
+func (ctrl *Controller) writeDetailText(c *gin.Context, me *client.MediathekEntries_MediathekEntries, lang string) {
+	templateName := "detail_text.gotmpl"
 	type tplData struct {
 		baseData
 		Source          *client.MediathekEntries_MediathekEntries `json:"source"`
 		MediaserverBase string                                    `json:"mediaserverBase"`
 	}
 	var data = &tplData{
-		Source: source.MediathekEntries[0],
+		Source: me,
 		baseData: baseData{
 			Lang:       lang,
 			RootPath:   "../",
@@ -1744,6 +1461,76 @@ func (ctrl *Controller) foliateViewer(c *gin.Context) {
 	}
 }
 
+// representations of the detail page, which are selected with the accept header
+const (
+	detailFormatHTML     = "text/html"
+	detailFormatJSON     = "application/json"
+	detailFormatMarkdown = "text/markdown"
+	detailFormatJSONLD   = "application/ld+json"
+)
+
+// detailFormats are the offered representations of the detail page, html is the default
+var detailFormats = []string{detailFormatHTML, detailFormatJSON, detailFormatMarkdown, detailFormatJSONLD}
+
+// negotiateFormat returns the offered format with the highest quality in the accept header.
+// The quality of a format is taken from its most specific media range, formats of the same quality
+// are preferred in the order of offered. Without accept header the first format is returned,
+// the result is empty, if no format is acceptable
+func negotiateFormat(accept string, offered []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		mr := mediaRange{mediaType: mediaType, q: 1}
+		if qStr, ok := params["q"]; ok {
+			if mr.q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	var best string
+	var bestQ float64
+	for _, format := range offered {
+		mainType, _, _ := strings.Cut(format, "/")
+		q, specificity := 0.0, 0
+		for _, mr := range ranges {
+			var s int
+			switch mr.mediaType {
+			case format:
+				s = 3
+			case mainType + "/*":
+				s = 2
+			case "*/*":
+				s = 1
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// detailLink is the public url of the detail page of an entry
+func (ctrl *Controller) detailLink(signature, lang string) string {
+	return fmt.Sprintf("%s/detail/%s/%s", ctrl.detailAddr, signature, lang)
+}
+
 func (ctrl *Controller) detail(c *gin.Context) {
 	var lang = c.Param("lang")
 	if !ctrl.langAvailable(lang) {
@@ -1752,8 +1539,12 @@ func (ctrl *Controller) detail(c *gin.Context) {
 	sourceString := c.Query("source")
 	searchString := c.Query("search")
 	cursorString := c.Query("cursor")
+	pageString := c.Query("page")
+	sizeString := c.Query("size")
 	collectionsString := c.Query("collections")
 	vocabularyString := c.Query("vocabulary")
+	datesString := c.Query("dates")
+	bboxString := c.Query("bbox")
 	ki := c.Request.URL.Query().Has("ki")
 	query := url.Values{}
 	if searchString != "" {
@@ -1765,13 +1556,71 @@ func (ctrl *Controller) detail(c *gin.Context) {
 	if cursorString != "" {
 		query.Set("cursor", cursorString)
 	}
+	if pageString != "" {
+		query.Set("page", pageString)
+	}
+	if sizeString != "" {
+		query.Set("size", sizeString)
+	}
 	if vocabularyString != "" {
 		query.Set("vocabulary", vocabularyString)
 	}
+	if datesString != "" {
+		query.Set("dates", datesString)
+	}
+	if bboxString != "" {
+		query.Set("bbox", bboxString)
+	}
 	if ki {
 		query.Set("ki", "")
 
 	}
+	id := c.Param("signature")
+	if id == "" {
+		ctrl.logger.Error().Msgf("signature missing")
+		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("signature missing"))
+		return
+	}
+	c.Header("Vary", "Accept")
+	format := negotiateFormat(c.GetHeader("Accept"), detailFormats)
+	if format == "" {
+		ctrl.logger.Error().Msgf("no acceptable format in '%s'", c.GetHeader("Accept"))
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, fmt.Sprintf("no acceptable format in '%s', available are %s", c.GetHeader("Accept"), strings.Join(detailFormats, ", ")))
+		return
+	}
+
+	source, err := ctrl.client.MediathekEntries(c, []string{id})
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot get source '%s'", id)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get source '%s': %v", id, err))
+		return
+	}
+	if source == nil || len(source.MediathekEntries) == 0 {
+		ctrl.logger.Error().Err(err).Msgf("source '%s' not found", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' not found", id))
+		return
+	}
+
+	// all representations of the entry share the url of the detail page
+	c.Header("Link", fmt.Sprintf("<%s>; rel=\"canonical\"", ctrl.detailLink(id, lang)))
+	switch format {
+	case detailFormatJSON:
+		c.JSON(http.StatusOK, source.MediathekEntries[0])
+		return
+	case detailFormatMarkdown:
+		ctrl.writeDetailText(c, source.MediathekEntries[0], lang)
+		return
+	case detailFormatJSONLD:
+		data, err := json.Marshal(ctrl.detailJSONLD(source.MediathekEntries[0], lang))
+		if err != nil {
+			ctrl.logger.Error().Err(err).Msgf("cannot marshal json-ld of '%s'", id)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot marshal json-ld of '%s': %v", id, err))
+			return
+		}
+		c.Data(http.StatusOK, detailFormatJSONLD+"; charset=utf-8", data)
+		return
+	}
+
 	templateName := "detail.gohtml"
 	textTemplate, err := ctrl.loadHTMLTemplate(templateName, []string{
 		"head.gohtml",
@@ -1792,24 +1641,6 @@ func (ctrl *Controller) detail(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot load template '%s': %v", templateName, err))
 		return
 	}
-	id := c.Param("signature")
-	if id == "" {
-		ctrl.logger.Error().Err(err).Msgf("signature missing")
-		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("signature missing"))
-		return
-	}
-
-	source, err := ctrl.client.MediathekEntries(c, []string{id})
-	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot get source '%s'", id)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get source '%s': %v", id, err))
-		return
-	}
-	if source == nil || len(source.MediathekEntries) == 0 {
-		ctrl.logger.Error().Err(err).Msgf("source '%s' not found", id)
-		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' not found", id))
-		return
-	}
 
 	type tplData struct {
 		baseData
@@ -1817,6 +1648,10 @@ func (ctrl *Controller) detail(c *gin.Context) {
 		Source          *client.MediathekEntries_MediathekEntries `json:"source"`
 		MediaserverBase string                                    `json:"mediaserverBase"`
 		SearchSource    string                                    `json:"searchSource"`
+		// PlaceBBox links the place to the map, if it is found in the gazetteer
+		PlaceBBox string `json:"placeBBox,omitempty"`
+		// Citations are the formatted citations of the entry with the access date of today
+		Citations []*citation `json:"citations"`
 		//ShowContent      bool
 		//ProtectedContent bool
 	}
@@ -1869,7 +1704,19 @@ func (ctrl *Controller) detail(c *gin.Context) {
 		},
 		MediaserverBase: ctrl.mediaserverBase,
 	}
+	if p, ok := ctrl.gazetteer.lookup(emptyIfNil(me.GetBase().GetPlace())); ok {
+		data.PlaceBBox = pointBBox(p).String()
+	}
+	rec := ctrl.newExportRecord(me.GetBase(), me.GetAbstract(), lang)
+	rec.Accessed = time.Now()
+	data.Citations = ctrl.citations(rec, lang)
+	if data.Meta, err = ctrl.detailMeta(me, lang); err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot create metadata of '%s'", id)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot create metadata of '%s': %v", id, err))
+		return
+	}
 
+	c.Header("Content-Type", detailFormatHTML+"; charset=utf-8")
 	if err := textTemplate.Execute(c.Writer, data); err != nil {
 		ctrl.logger.Error().Err(err).Msgf("cannot execute template '%s'", templateName)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot execute template '%s': %v", templateName, err))
@@ -1901,63 +1748,35 @@ func (ctrl *Controller) detailTextList(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("cannot convert collection '%s' to int: %v", collectionStr, err))
 		return
 	}
-	colls, err := ctrl.dir.GetCollections()
-	if err != nil {
-		ctrl.logger.Error().Err(err).Msgf("cannot get collections")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get collections: %v", err))
-		return
-	}
-	var theColl *directus.Collection
-	for _, coll := range colls {
-		if coll.Id == int64(collectionId) {
-			theColl = coll
-			break
-		}
-	}
-	if theColl == nil {
-		ctrl.logger.Error().Err(err).Msgf("collection '%s' not found", collectionStr)
+	theColl, ok := ctrl.collectionRegistry.get(int64(collectionId))
+	if !ok {
+		ctrl.logger.Error().Msgf("collection '%s' not found", collectionStr)
 		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("collection '%s' not found", collectionStr))
 		return
 	}
-	parts := strings.SplitN(theColl.Identifier, ":", 2)
-	if len(parts) != 2 {
-		ctrl.logger.Error().Err(err).Msgf("unknown collection identifier '%s'", theColl.Identifier)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("unknown collection identifier '%s'", theColl.Identifier))
-		return
-	}
-	if parts[0] != "cat" {
-		ctrl.logger.Error().Err(err).Msgf("collection identifier not cat '%s'", theColl.Identifier)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("collection identifier not cat '%s'", theColl.Identifier))
+	var cursorString string
+	collQuery, collFilter, hasRecords, err := ctrl.collectionSearch(c, GetUser(c).Groups, theColl)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot resolve date ranges of collection '%s'", collectionStr)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot resolve date ranges of collection '%s': %v", collectionStr, err))
 		return
 	}
-	var cursorString string
-	cVal := strings.Trim(parts[1], "\" ")
 	var langs = []language.Tag{language.German, language.English, language.French, language.Italian}
 	var languageNamerEN = languageNamer["en"]
-	var sortField = c.Query("sortField")
-	var sortOrder = c.Query("sortOrder")
-	var sort = []*client.SortField{}
-	if sortField != "" {
-		sort = append(sort, &client.SortField{
-			Field: sortField,
-			Order: sortOrder,
-		})
+	sortOption, sortOrder, err := ctrl.searchSortOption(&searchParams{Sort: c.Query("sort"), SortOrder: c.Query("sortOrder"), SortField: c.Query("sortField")})
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("invalid sort of collection '%s'", collectionStr)
+		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("invalid sort of collection '%s': %v", collectionStr, err))
+		return
 	}
+	sort := sortOption.sort(sortOrder)
 	c.Header("Content-Type", "text/plain; charset=utf-8")
-	for {
+	for hasRecords {
 		result, err := ctrl.client.Search(
 			c,
-			"",
+			collQuery,
 			[]*client.InFacet{},
-			[]*client.InFilter{
-				&client.InFilter{
-					BoolTerm: &client.InFilterBoolTerm{
-						Field:  "category.keyword",
-						And:    false,
-						Values: []string{cVal},
-					},
-				},
-			},
+			collFilter,
 			nil,
 			nil,
 			nil,
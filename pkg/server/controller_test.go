@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/rs/zerolog"
+	"golang.org/x/text/language"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                               detailFormatHTML,
+		"*/*":                            detailFormatHTML,
+		"application/json":               detailFormatJSON,
+		"text/markdown;q=0.1, text/html": detailFormatHTML,
+		"text/html;q=0.5, text/markdown": detailFormatMarkdown,
+		"application/*, text/html;q=0.9": detailFormatJSON,
+		"application/ld+json, */*;q=0.1": detailFormatJSONLD,
+		"text/*;q=0.5, text/html;q=0":    detailFormatMarkdown,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": detailFormatHTML,
+		"image/png":              "",
+		"text/html;q=0, */*;q=0": "",
+	} {
+		if got := negotiateFormat(accept, detailFormats); got != want {
+			t.Errorf("accept '%s' selects '%s', want '%s'", accept, got, want)
+		}
+	}
+}
+
+func TestDetailFormats(t *testing.T) {
+	tc := &testClient{entries: func(signatures []string) (*client.MediathekEntries, error) {
+		return &client.MediathekEntries{MediathekEntries: []*client.MediathekEntries_MediathekEntries{
+			{Base: &client.MediathekBaseFragment{Signature: signatures[0]}},
+		}}, nil
+	}}
+	templates := fstest.MapFS{
+		"detail.gohtml":      {Data: []byte(`<html>{{ .Source.Base.Signature }}</html>`)},
+		"detail_text.gotmpl": {Data: []byte(`# {{ .Source.Base.Signature }}`)},
+	}
+	for _, name := range []string{"head", "footer", "nav", "detail_image", "detail_video", "detail_audio", "detail_pdf_dflip", "detail_verovio", "detail_webrecorder", "detail_epub_foliate"} {
+		templates[name+".gohtml"] = &fstest.MapFile{Data: []byte(`{{ define "` + name + `.gohtml" }}{{ end }}`)}
+	}
+	logger := zerolog.Nop()
+	ctrl := &Controller{
+		logger:        &logger,
+		client:        tc,
+		bundle:        i18n.NewBundle(language.German),
+		templateFS:    templates,
+		templateCache: map[string]any{},
+		gazetteer:     &gazetteer{},
+		detailAddr:    "https://detail.example",
+	}
+	for accept, want := range map[string]string{
+		"":                               "text/html",
+		"text/markdown;q=0.1, text/html": "text/html",
+		"application/json":               "application/json",
+		"text/markdown":                  "text/markdown",
+		"application/ld+json":            "application/ld+json",
+		"image/png":                      "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/detail/zotero2-1.1/de", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := testRequest(ctrl.detail, req, gin.Param{Key: "signature", Value: "zotero2-1.1"}, gin.Param{Key: "lang", Value: "de"})
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("accept '%s': missing vary header", accept)
+		}
+		if want == "" {
+			if w.Code != http.StatusNotAcceptable {
+				t.Errorf("accept '%s': status %d, want %d", accept, w.Code, http.StatusNotAcceptable)
+			}
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("accept '%s': status %d: %s", accept, w.Code, w.Body.String())
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, want) {
+			t.Errorf("accept '%s': content type '%s', want '%s'", accept, got, want)
+		}
+		if got := w.Header().Get("Link"); got != `<https://detail.example/detail/zotero2-1.1/de>; rel="canonical"` {
+			t.Errorf("accept '%s': invalid link header '%s'", accept, got)
+		}
+		if !strings.Contains(w.Body.String(), "zotero2-1.1") {
+			t.Errorf("accept '%s': invalid body %s", accept, w.Body.String())
+		}
+	}
+}
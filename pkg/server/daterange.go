@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// noMatchValue is used as filter value, if a filter must not match any record.
+// revcat ignores filters without values
+const noMatchValue = "\u0000"
+
+// matchesNothing checks, whether f is a filter with noMatchValue
+func matchesNothing(f *client.InFilter) bool {
+	return f != nil && f.BoolTerm != nil && slices.Equal(f.BoolTerm.Values, []string{noMatchValue})
+}
+
+var yearRegexp = regexp.MustCompile(`(?:^|\D)(\d{4})(?:\D|$)`)
+
+// parseYear extracts the first four digit year from a free form date like "ca. 1990" or "1995-03-12"
+func parseYear(date string) (int, bool) {
+	matches := yearRegexp.FindStringSubmatch(date)
+	if matches == nil {
+		return 0, false
+	}
+	year, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, false
+	}
+	return year, true
+}
+
+// parseYearRange parses "1990..2005", "1990..", "..2005" or "1990"
+func parseYearRange(str string) (int, int, error) {
+	str = strings.Trim(str, "\" ")
+	var fromStr, toStr = str, str
+	if parts := strings.SplitN(str, "..", 2); len(parts) == 2 {
+		fromStr, toStr = parts[0], parts[1]
+	}
+	var from, to = 0, 9999
+	var err error
+	if fromStr != "" {
+		if from, err = strconv.Atoi(fromStr); err != nil {
+			return 0, 0, errors.Errorf("invalid year '%s' in date range '%s'", fromStr, str)
+		}
+	}
+	if toStr != "" {
+		if to, err = strconv.Atoi(toStr); err != nil {
+			return 0, 0, errors.Errorf("invalid year '%s' in date range '%s'", toStr, str)
+		}
+	}
+	if from > to {
+		return 0, 0, errors.Errorf("invalid date range '%s'", str)
+	}
+	return from, to, nil
+}
+
+// dateValues returns all date values of the catalogue visible for groups.
+// The values are cached per group set in dateStats. Catalogues with more than termCountsSize
+// date values return nil, the ranges are resolved by an aggregation per range then
+func (ctrl *Controller) dateValues(ctx context.Context, groups []string) ([]string, error) {
+	mapping, ok := ctrl.fieldMapping["date"]
+	if !ok {
+		return []string{}, nil
+	}
+	counts, err := ctrl.termCounts(ctx, "", searchFilter(groups), "date", mapping.Field, "")
+	if err != nil {
+		var qErr *QueryError
+		if errors.As(err, &qErr) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	values := []string{}
+	for date := range counts {
+		values = append(values, date)
+	}
+	slices.Sort(values)
+	return values, nil
+}
+
+// yearPatterns returns regular expressions of four digits, which match the years from..to
+func yearPatterns(from, to int) []string {
+	return digitPatterns(fmt.Sprintf("%04d", from), fmt.Sprintf("%04d", to))
+}
+
+// digitPatterns returns regular expressions, which match the numbers lo..hi of the same number of digits
+func digitPatterns(lo, hi string) []string {
+	if lo == hi {
+		return []string{lo}
+	}
+	if len(lo) == 1 {
+		return []string{"[" + lo + "-" + hi + "]"}
+	}
+	if lo[0] == hi[0] {
+		patterns := []string{}
+		for _, p := range digitPatterns(lo[1:], hi[1:]) {
+			patterns = append(patterns, lo[:1]+p)
+		}
+		return patterns
+	}
+	zeros, nines := strings.Repeat("0", len(lo)-1), strings.Repeat("9", len(lo)-1)
+	patterns := []string{}
+	first, last := lo[0], hi[0]
+	if lo[1:] != zeros {
+		for _, p := range digitPatterns(lo[1:], nines) {
+			patterns = append(patterns, lo[:1]+p)
+		}
+		first++
+	}
+	if hi[1:] != nines {
+		last--
+	}
+	if first <= last {
+		patterns = append(patterns, "["+string(first)+"-"+string(last)+"]"+strings.Repeat("[0-9]", len(lo)-1))
+	}
+	if hi[1:] != nines {
+		for _, p := range digitPatterns(zeros, hi[1:]) {
+			patterns = append(patterns, hi[:1]+p)
+		}
+	}
+	return patterns
+}
+
+// rangeDates returns the date values visible for groups with a year in from..to.
+// Without cached values, the dates are aggregated with a pattern of the years
+func (ctrl *Controller) rangeDates(ctx context.Context, groups []string, field string, from, to int) ([]string, error) {
+	cached, err := ctrl.dateStats.get(ctx, groups)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dates := cached.Value
+	if dates == nil {
+		include := ".*(" + strings.Join(yearPatterns(from, to), "|") + ").*"
+		counts, err := ctrl.termCounts(ctx, "", searchFilter(groups), "date", field, include)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for date := range counts {
+			dates = append(dates, date)
+		}
+		slices.Sort(dates)
+	}
+	values := []string{}
+	for _, d := range dates {
+		if year, ok := parseYear(d); ok && year >= from && year <= to {
+			values = append(values, d)
+		}
+	}
+	return values, nil
+}
+
+// resolveDateRanges replaces year ranges in filters on the date field with the matching date values.
+// The ranges of an OR filter are merged into one filter. The ranges of an AND filter must all match,
+// each one gets an OR filter of its own. These additional filters are returned and must be added to the search.
+// Ranges without matching dates get a filter, which matches no record
+func (ctrl *Controller) resolveDateRanges(ctx context.Context, groups []string, filters ...*client.InFilter) ([]*client.InFilter, error) {
+	added := []*client.InFilter{}
+	mapping, ok := ctrl.fieldMapping["date"]
+	if !ok {
+		return added, nil
+	}
+	for _, f := range filters {
+		if f == nil || f.BoolTerm == nil || f.BoolTerm.Field != mapping.Field || len(f.BoolTerm.Values) == 0 {
+			continue
+		}
+		ranges := [][]string{}
+		for _, v := range f.BoolTerm.Values {
+			from, to, err := parseYearRange(v)
+			if err != nil {
+				return nil, &QueryError{Msg: err.Error()}
+			}
+			values, err := ctrl.rangeDates(ctx, groups, mapping.Field, from, to)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			ranges = append(ranges, values)
+		}
+		if !f.BoolTerm.And {
+			values := slices.Concat(ranges...)
+			slices.Sort(values)
+			ranges = [][]string{slices.Compact(values)}
+		}
+		for i, values := range ranges {
+			if len(values) == 0 {
+				values = []string{noMatchValue}
+			}
+			if i == 0 {
+				f.BoolTerm.Values = values
+				f.BoolTerm.And = false
+				continue
+			}
+			added = append(added, &client.InFilter{
+				BoolTerm: &client.InFilterBoolTerm{
+					Field:  f.BoolTerm.Field,
+					Values: values,
+				},
+			})
+		}
+	}
+	return added, nil
+}
+
+type dateFacetType struct {
+	Decade  int    `json:"decade"`
+	Value   string `json:"value"`
+	Count   int    `json:"count"`
+	Height  int    `json:"height"`
+	Checked bool   `json:"checked"`
+}
+
+// decadeHistogram aggregates the counts of the date facet into decades
+func decadeHistogram(counts map[string]int64, selected []string) []*dateFacetType {
+	decades := map[int]*dateFacetType{}
+	for date, count := range counts {
+		year, ok := parseYear(date)
+		if !ok {
+			continue
+		}
+		decade := year - year%10
+		df, ok := decades[decade]
+		if !ok {
+			value := fmt.Sprintf("%d..%d", decade, decade+9)
+			df = &dateFacetType{
+				Decade:  decade,
+				Value:   value,
+				Checked: slices.Contains(selected, value),
+			}
+			decades[decade] = df
+		}
+		df.Count += int(count)
+	}
+	result := []*dateFacetType{}
+	var maxCount int
+	for _, df := range decades {
+		result = append(result, df)
+		maxCount = max(maxCount, df.Count)
+	}
+	slices.SortFunc(result, func(a, b *dateFacetType) int {
+		return a.Decade - b.Decade
+	})
+	for _, df := range result {
+		df.Height = max(1, df.Count*100/maxCount)
+	}
+	return result
+}
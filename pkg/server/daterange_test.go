@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/rs/zerolog"
+)
+
+func TestParseYearRange(t *testing.T) {
+	tests := []struct {
+		str      string
+		from, to int
+		err      bool
+	}{
+		{str: "1990..2005", from: 1990, to: 2005},
+		{str: "1990..", from: 1990, to: 9999},
+		{str: "..2005", from: 0, to: 2005},
+		{str: "1990", from: 1990, to: 1990},
+		{str: "2005..1990", err: true},
+		{str: "abc", err: true},
+	}
+	for _, tc := range tests {
+		from, to, err := parseYearRange(tc.str)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: error expected", tc.str)
+			}
+			continue
+		}
+		if err != nil || from != tc.from || to != tc.to {
+			t.Errorf("%s: %d..%d (%v), expected %d..%d", tc.str, from, to, err, tc.from, tc.to)
+		}
+	}
+	for date, year := range map[string]int{"ca. 1990": 1990, "1995-03-12": 1995, "12.03.1995": 1995, "1990er": 1990, "undatiert": 0} {
+		if y, _ := parseYear(date); y != year {
+			t.Errorf("%s: year %d, expected %d", date, y, year)
+		}
+	}
+}
+
+func TestDecadeHistogram(t *testing.T) {
+	hist := decadeHistogram(map[string]int64{"1985": 2, "1987-02-01": 2, "ca. 1992": 1, "unknown": 5}, []string{"1990..1999"})
+	if len(hist) != 2 {
+		t.Fatalf("%d decades, expected 2", len(hist))
+	}
+	if hist[0].Decade != 1980 || hist[0].Count != 4 || hist[0].Height != 100 || hist[0].Checked {
+		t.Errorf("invalid decade %+v", hist[0])
+	}
+	if hist[1].Decade != 1990 || hist[1].Value != "1990..1999" || !hist[1].Checked {
+		t.Errorf("invalid decade %+v", hist[1])
+	}
+}
+
+func TestResolveDateRanges(t *testing.T) {
+	tc := &testClient{search: termSearch(map[string]int{"1985": 1, "ca. 1992": 2, "2001-03-12": 1, "undatiert": 1})}
+	ctrl := &Controller{client: tc, fieldMapping: map[string]*FieldMapping{"date": {Field: "date.keyword"}}}
+	logger := zerolog.Nop()
+	ctrl.dateStats = newGroupStats(ctrl.dateValues, time.Hour, time.Hour, &logger)
+
+	// the ranges of an AND filter must all match
+	filter := &client.InFilter{BoolTerm: &client.InFilterBoolTerm{Field: "date.keyword", Values: []string{"1990..1999", "2001"}, And: true}}
+	added, err := ctrl.resolveDateRanges(context.Background(), []string{"global/guest"}, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(filter.BoolTerm.Values, ",") != "ca. 1992" || filter.BoolTerm.And {
+		t.Errorf("invalid values %v", filter.BoolTerm.Values)
+	}
+	if len(added) != 1 || strings.Join(added[0].BoolTerm.Values, ",") != "2001-03-12" || added[0].BoolTerm.And {
+		t.Errorf("invalid additional filters %v", added)
+	}
+	// the ranges of an OR filter are merged
+	filter = &client.InFilter{BoolTerm: &client.InFilterBoolTerm{Field: "date.keyword", Values: []string{"1990..1999", "2001", "1992..2005"}}}
+	if added, err = ctrl.resolveDateRanges(context.Background(), []string{"global/guest"}, filter); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(filter.BoolTerm.Values, ",") != "2001-03-12,ca. 1992" || len(added) != 0 {
+		t.Errorf("invalid values %v, %d additional filters", filter.BoolTerm.Values, len(added))
+	}
+	// a range without dates matches no record
+	filter = &client.InFilter{BoolTerm: &client.InFilterBoolTerm{Field: "date.keyword", Values: []string{"1950..1959"}}}
+	if _, err := ctrl.resolveDateRanges(context.Background(), []string{"global/guest"}, filter); err != nil {
+		t.Fatal(err)
+	}
+	if !matchesNothing(filter) {
+		t.Errorf("range without dates must not match: %v", filter.BoolTerm.Values)
+	}
+	// the dates of a group set are searched only once
+	if len(tc.searches) != 1 {
+		t.Errorf("%d searches for the dates", len(tc.searches))
+	}
+}
+
+func TestResolveDateRangesLimit(t *testing.T) {
+	tc := &testClient{search: func(req *testSearch) (*client.Search, error) {
+		values := map[string]int{"ca. 1992": 1, "1889": 1, "2001-03-12": 1}
+		if include := req.Facets[0].Term.Include; len(include) == 0 {
+			for i := 0; i <= termCountsSize; i++ {
+				values[fmt.Sprintf("%d-%05d", 1000+i%1000, i)] = 1
+			}
+		} else {
+			// revcat matches the whole value
+			re := regexp.MustCompile("^(?:" + include[0] + ")$")
+			for val := range values {
+				if !re.MatchString(val) {
+					delete(values, val)
+				}
+			}
+		}
+		return termSearch(values)(req)
+	}}
+	ctrl := &Controller{client: tc, fieldMapping: map[string]*FieldMapping{"date": {Field: "date.keyword"}}}
+	logger := zerolog.Nop()
+	ctrl.dateStats = newGroupStats(ctrl.dateValues, time.Hour, time.Hour, &logger)
+
+	filter := &client.InFilter{BoolTerm: &client.InFilterBoolTerm{Field: "date.keyword", Values: []string{"1890..1999"}}}
+	if _, err := ctrl.resolveDateRanges(context.Background(), []string{"global/guest"}, filter); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(filter.BoolTerm.Values, ",") != "ca. 1992" {
+		t.Errorf("invalid values %v", filter.BoolTerm.Values)
+	}
+}
+
+func TestYearPatterns(t *testing.T) {
+	for _, r := range [][2]int{{1990, 2005}, {0, 9999}, {1995, 1995}, {1899, 1900}, {123, 4567}, {1990, 1999}} {
+		re := regexp.MustCompile("^(?:" + strings.Join(yearPatterns(r[0], r[1]), "|") + ")$")
+		for year := 0; year <= 9999; year++ {
+			if match := re.MatchString(fmt.Sprintf("%04d", year)); match != (year >= r[0] && year <= r[1]) {
+				t.Errorf("%d..%d: year %d matches %v", r[0], r[1], year, match)
+				break
+			}
+		}
+	}
+}
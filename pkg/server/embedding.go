@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/openai"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	oai "github.com/sashabaranov/go-openai"
+)
+
+// EmbeddingProvider creates the query vector for the ki search.
+// The model must be the same as the one used for the vectors in the index
+type EmbeddingProvider interface {
+	CreateEmbedding(ctx context.Context, input string) ([]float64, error)
+}
+
+// NewOpenAIEmbeddings creates a provider for the OpenAI API or any OpenAI compatible endpoint (config.BaseURL)
+func NewOpenAIEmbeddings(config oai.ClientConfig, model string, cache openai.KVStore, logger zLogger.ZLogger) *OpenAIEmbeddings {
+	return &OpenAIEmbeddings{
+		client: oai.NewClientWithConfig(config),
+		model:  oai.EmbeddingModel(model),
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+type OpenAIEmbeddings struct {
+	client *oai.Client
+	model  oai.EmbeddingModel
+	cache  openai.KVStore
+	logger zLogger.ZLogger
+}
+
+func (e *OpenAIEmbeddings) CreateEmbedding(ctx context.Context, input string) ([]float64, error) {
+	key := embeddingKey(string(e.model), input)
+	embedding, err := e.cache.Get(key)
+	if err != nil {
+		if !errors.Is(err, openai.ErrNotExists) {
+			return nil, errors.Wrapf(err, "cannot get embedding %s from cache", key)
+		}
+		e.logger.Debug().Msgf("embedding cache miss for '%s'", input)
+		resp, err := e.client.CreateEmbeddings(ctx, oai.EmbeddingRequest{
+			Input: []string{input},
+			Model: e.model,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create embedding with model %s", e.model)
+		}
+		if len(resp.Data) == 0 {
+			return nil, errors.Errorf("no embedding returned for model %s", e.model)
+		}
+		embedding = &resp.Data[0]
+		if err := e.cache.Set(key, embedding); err != nil {
+			return nil, errors.Wrapf(err, "cannot store embedding %s in cache", key)
+		}
+	}
+	result := make([]float64, 0, len(embedding.Embedding))
+	for _, v := range embedding.Embedding {
+		result = append(result, float64(v))
+	}
+	return result, nil
+}
+
+var _ EmbeddingProvider = (*OpenAIEmbeddings)(nil)
+
+// embeddingKey is the cache key of the embedding of input, the separator keeps model and input apart
+func embeddingKey(model, input string) string {
+	return fmt.Sprintf("embedding-%x", sha1.Sum([]byte(model+"\x00"+input)))
+}
+
+// NewEmbeddingCache combines a fast (memory) cache with a persistent (disk) cache
+func NewEmbeddingCache(mem, disk openai.KVStore) *EmbeddingCache {
+	return &EmbeddingCache{
+		mem:  mem,
+		disk: disk,
+	}
+}
+
+type EmbeddingCache struct {
+	mem  openai.KVStore
+	disk openai.KVStore
+}
+
+func (c *EmbeddingCache) Get(key string) (*oai.Embedding, error) {
+	embedding, err := c.mem.Get(key)
+	if err == nil || !errors.Is(err, openai.ErrNotExists) {
+		return embedding, err
+	}
+	embedding, err = c.disk.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return embedding, c.mem.Set(key, embedding)
+}
+
+func (c *EmbeddingCache) Set(key string, value *oai.Embedding) error {
+	if err := c.disk.Set(key, value); err != nil {
+		return err
+	}
+	return c.mem.Set(key, value)
+}
+
+var _ openai.KVStore = (*EmbeddingCache)(nil)
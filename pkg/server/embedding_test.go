@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluele/gcache"
+	"github.com/je4/utils/v2/pkg/openai"
+	"github.com/rs/zerolog"
+	oai "github.com/sashabaranov/go-openai"
+)
+
+func TestOpenAIEmbeddingsLocal(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(oai.EmbeddingResponse{
+			Object: "list",
+			Data:   []oai.Embedding{{Object: "embedding", Embedding: []float32{0.5, -1}}},
+		})
+	}))
+	defer srv.Close()
+
+	config := oai.DefaultConfig("")
+	config.BaseURL = srv.URL + "/v1"
+	disk := openai.NewKVGCache(gcache.New(10).Build())
+	cache := NewEmbeddingCache(openai.NewKVGCache(gcache.New(10).Build()), disk)
+	logger := zerolog.Nop()
+	provider := NewOpenAIEmbeddings(config, "nomic-embed-text", cache, &logger)
+
+	for i := 0; i < 2; i++ {
+		vector, err := provider.CreateEmbedding(context.Background(), "performance art")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vector) != 2 || vector[0] != 0.5 || vector[1] != -1 {
+			t.Errorf("unexpected vector %v", vector)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+
+	// a new memory cache is filled from disk
+	cache = NewEmbeddingCache(openai.NewKVGCache(gcache.New(10).Build()), disk)
+	provider = NewOpenAIEmbeddings(config, "nomic-embed-text", cache, &logger)
+	if _, err := provider.CreateEmbedding(context.Background(), "performance art"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+}
+
+func TestEmbeddingKey(t *testing.T) {
+	// input and model must not run into each other
+	if embeddingKey("model", "ab") == embeddingKey("modela", "b") {
+		t.Error("different models and inputs share a cache key")
+	}
+	if embeddingKey("model", "ab") != embeddingKey("model", "ab") {
+		t.Error("cache key is not stable")
+	}
+}
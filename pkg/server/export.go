@@ -0,0 +1,537 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"golang.org/x/text/language"
+)
+
+type exportPerson struct {
+	Name string
+	Role string
+}
+
+// exportRecord is the format independent view of an entry for exports and citations
+type exportRecord struct {
+	Signature  string
+	Title      string
+	Persons    []*exportPerson
+	Date       string
+	Year       int
+	Place      string
+	Collection string
+	Publisher  string
+	Type       string
+	URL        string
+	Link       string
+	Abstract   string
+	// Accessed is the access date of citations, exports of search results have none
+	Accessed time.Time
+}
+
+// creators returns the persons, which are cited as authors
+func (rec *exportRecord) creators() []*exportPerson {
+	result := []*exportPerson{}
+	for _, p := range rec.Persons {
+		if creatorRoles[p.Role] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (rec *exportRecord) personsWithRole(role string) []*exportPerson {
+	result := []*exportPerson{}
+	for _, p := range rec.Persons {
+		if p.Role == role {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// contributors returns all persons, which are neither creators nor editors
+func (rec *exportRecord) contributors() []*exportPerson {
+	result := []*exportPerson{}
+	for _, p := range rec.Persons {
+		if !creatorRoles[p.Role] && p.Role != "editor" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// creatorRoles are the roles, which are cited as authors
+var creatorRoles = map[string]bool{
+	"author":    true,
+	"artist":    true,
+	"performer": true,
+	"director":  true,
+}
+
+func multiLangString(mf []*client.MultiLangFragment) *translate.MultiLangString {
+	m := &translate.MultiLangString{}
+	for _, f := range mf {
+		lang, _ := language.Parse(f.Lang)
+		m.Set(f.Value, lang, f.Translated)
+	}
+	return m
+}
+
+func (ctrl *Controller) newExportRecord(base *client.MediathekBaseFragment, abstract []*client.MultiLangFragment, lang string) *exportRecord {
+	rec := &exportRecord{
+		Signature:  base.GetSignature(),
+		Title:      localTitle(multiLangString(base.GetTitle()), lang),
+		Persons:    []*exportPerson{},
+		Date:       emptyIfNil(base.GetDate()),
+		Place:      emptyIfNil(base.GetPlace()),
+		Collection: emptyIfNil(base.GetCollectionTitle()),
+		Publisher:  emptyIfNil(base.GetPublisher()),
+		Type:       emptyIfNil(base.GetType()),
+		URL:        emptyIfNil(base.GetURL()),
+		Link:       ctrl.detailLink(base.GetSignature(), lang),
+	}
+	if len(abstract) > 0 {
+		rec.Abstract = localTitle(multiLangString(abstract), lang)
+	}
+	rec.Year, _ = parseYear(rec.Date)
+	for _, p := range base.GetPerson() {
+		role := "author"
+		if p.GetRole() != nil && *p.GetRole() != "" {
+			role = *p.GetRole()
+		}
+		rec.Persons = append(rec.Persons, &exportPerson{Name: p.GetName(), Role: role})
+	}
+	return rec
+}
+
+// exportWriter writes records in a specific format
+type exportWriter interface {
+	Write(rec *exportRecord) error
+	Close() error
+}
+
+const (
+	// totalCountHeader reports the total count of hits of an export
+	totalCountHeader = "X-Total-Count"
+	// exportTruncatedHeader reports the count of exported hits, if the export is cut at maxResultWindow
+	exportTruncatedHeader = "X-Export-Truncated"
+)
+
+type exportFormat struct {
+	ContentType string
+	Extension   string
+	NewWriter   func(w io.Writer) (exportWriter, error)
+}
+
+var exportFormats = map[string]*exportFormat{
+	"csv": {
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		NewWriter:   newCSVWriter,
+	},
+	"bibtex": {
+		ContentType: "application/x-bibtex; charset=utf-8",
+		Extension:   "bib",
+		NewWriter:   func(w io.Writer) (exportWriter, error) { return &bibTeXWriter{w: w}, nil },
+	},
+	"ris": {
+		ContentType: "application/x-research-info-systems; charset=utf-8",
+		Extension:   "ris",
+		NewWriter:   func(w io.Writer) (exportWriter, error) { return &risWriter{w: w}, nil },
+	},
+	"csl": {
+		ContentType: "application/vnd.citationstyles.csl+json; charset=utf-8",
+		Extension:   "json",
+		NewWriter:   newCSLWriter,
+	},
+}
+
+func joinPersons(persons []*exportPerson, sep string, withRole bool) string {
+	names := []string{}
+	for _, p := range persons {
+		if withRole {
+			names = append(names, fmt.Sprintf("%s (%s)", p.Name, p.Role))
+		} else {
+			names = append(names, p.Name)
+		}
+	}
+	return strings.Join(names, sep)
+}
+
+/*
+ * CSV
+ */
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (exportWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write([]string{"signature", "title", "persons", "date", "place", "collection", "publisher", "type", "url", "link"}); err != nil {
+		return nil, errors.Wrap(err, "cannot write csv header")
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(rec *exportRecord) error {
+	defer cw.w.Flush()
+	return errors.WithStack(cw.w.Write([]string{
+		rec.Signature,
+		rec.Title,
+		joinPersons(rec.Persons, "; ", true),
+		rec.Date,
+		rec.Place,
+		rec.Collection,
+		rec.Publisher,
+		rec.Type,
+		rec.URL,
+		rec.Link,
+	}))
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return errors.WithStack(cw.w.Error())
+}
+
+/*
+ * BibTeX
+ */
+
+var bibTeXTypes = map[string]string{
+	"book":           "book",
+	"bookSection":    "incollection",
+	"journalArticle": "article",
+	"thesis":         "phdthesis",
+	"report":         "techreport",
+}
+
+var bibTeXKeyRegexp = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+var bibTeXEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+type bibTeXWriter struct {
+	w io.Writer
+}
+
+func (bw *bibTeXWriter) Write(rec *exportRecord) error {
+	entryType, ok := bibTeXTypes[rec.Type]
+	if !ok {
+		entryType = "misc"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@%s{%s,\n", entryType, bibTeXKeyRegexp.ReplaceAllString(rec.Signature, "_"))
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "  %s = {%s},\n", name, bibTeXEscaper.Replace(value))
+		}
+	}
+	field("title", rec.Title)
+	field("author", joinPersons(rec.creators(), " and ", false))
+	field("editor", joinPersons(rec.personsWithRole("editor"), " and ", false))
+	if rec.Year > 0 {
+		field("year", strconv.Itoa(rec.Year))
+	}
+	field("date", rec.Date)
+	field("address", rec.Place)
+	field("publisher", rec.Publisher)
+	field("series", rec.Collection)
+	field("url", rec.URL)
+	field("note", joinPersons(rec.contributors(), "; ", true))
+	field("howpublished", rec.Link)
+	if !rec.Accessed.IsZero() {
+		field("urldate", rec.Accessed.Format("2006-01-02"))
+	}
+	sb.WriteString("}\n\n")
+	_, err := io.WriteString(bw.w, sb.String())
+	return errors.WithStack(err)
+}
+
+func (bw *bibTeXWriter) Close() error {
+	return nil
+}
+
+/*
+ * RIS
+ */
+
+var risTypes = map[string]string{
+	"book":           "BOOK",
+	"bookSection":    "CHAP",
+	"journalArticle": "JOUR",
+	"thesis":         "THES",
+	"report":         "RPRT",
+	"videoRecording": "VIDEO",
+	"audioRecording": "SOUND",
+	"artwork":        "ART",
+	"interview":      "GEN",
+	"webpage":        "ELEC",
+}
+
+type risWriter struct {
+	w io.Writer
+}
+
+func (rw *risWriter) Write(rec *exportRecord) error {
+	risType, ok := risTypes[rec.Type]
+	if !ok {
+		risType = "GEN"
+	}
+	var sb strings.Builder
+	tag := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "%s  - %s\r\n", name, strings.ReplaceAll(value, "\n", " "))
+		}
+	}
+	tag("TY", risType)
+	tag("ID", rec.Signature)
+	tag("TI", rec.Title)
+	for _, p := range rec.creators() {
+		tag("AU", p.Name)
+	}
+	for _, p := range rec.personsWithRole("editor") {
+		tag("ED", p.Name)
+	}
+	for _, p := range rec.contributors() {
+		tag("A2", p.Name)
+	}
+	if rec.Year > 0 {
+		tag("PY", strconv.Itoa(rec.Year))
+	}
+	tag("DA", rec.Date)
+	tag("CY", rec.Place)
+	tag("PB", rec.Publisher)
+	tag("T3", rec.Collection)
+	tag("AB", rec.Abstract)
+	tag("UR", rec.URL)
+	tag("UR", rec.Link)
+	if !rec.Accessed.IsZero() {
+		tag("Y2", rec.Accessed.Format("2006/01/02"))
+	}
+	sb.WriteString("ER  - \r\n\r\n")
+	_, err := io.WriteString(rw.w, sb.String())
+	return errors.WithStack(err)
+}
+
+func (rw *risWriter) Close() error {
+	return nil
+}
+
+/*
+ * CSL-JSON
+ */
+
+var cslTypes = map[string]string{
+	"book":           "book",
+	"bookSection":    "chapter",
+	"journalArticle": "article-journal",
+	"thesis":         "thesis",
+	"report":         "report",
+	"videoRecording": "motion_picture",
+	"audioRecording": "song",
+	"artwork":        "graphic",
+	"interview":      "interview",
+	"webpage":        "webpage",
+}
+
+// cslRoles are the roles, which are csl name variables
+var cslRoles = map[string]bool{
+	"author":      true,
+	"composer":    true,
+	"contributor": true,
+	"curator":     true,
+	"director":    true,
+	"editor":      true,
+	"illustrator": true,
+	"interviewer": true,
+	"narrator":    true,
+	"organizer":   true,
+	"performer":   true,
+	"producer":    true,
+	"translator":  true,
+}
+
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Literal string `json:"literal,omitempty"`
+}
+
+func newCSLName(name string) *cslName {
+	parts := strings.SplitN(name, ",", 2)
+	if len(parts) != 2 {
+		return &cslName{Literal: strings.TrimSpace(name)}
+	}
+	return &cslName{Family: strings.TrimSpace(parts[0]), Given: strings.TrimSpace(parts[1])}
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts,omitempty"`
+	Raw       string  `json:"raw,omitempty"`
+}
+
+// cslItem creates the csl-json representation of rec
+func cslItem(rec *exportRecord) map[string]any {
+	cslType, ok := cslTypes[rec.Type]
+	if !ok {
+		cslType = "document"
+	}
+	item := map[string]any{
+		"id":   rec.Signature,
+		"type": cslType,
+	}
+	set := func(name, value string) {
+		if value != "" {
+			item[name] = value
+		}
+	}
+	set("title", rec.Title)
+	set("publisher", rec.Publisher)
+	set("publisher-place", rec.Place)
+	set("collection-title", rec.Collection)
+	set("abstract", rec.Abstract)
+	set("URL", rec.Link)
+	set("source", rec.URL)
+	for _, p := range rec.Persons {
+		role := p.Role
+		switch {
+		case role == "artist":
+			role = "author"
+		case !cslRoles[role]:
+			role = "contributor"
+		}
+		names, _ := item[role].([]*cslName)
+		item[role] = append(names, newCSLName(p.Name))
+	}
+	if rec.Date != "" {
+		date := &cslDate{Raw: rec.Date}
+		if rec.Year > 0 {
+			date.DateParts = [][]int{{rec.Year}}
+		}
+		item["issued"] = date
+	}
+	if !rec.Accessed.IsZero() {
+		item["accessed"] = &cslDate{DateParts: [][]int{{rec.Accessed.Year(), int(rec.Accessed.Month()), rec.Accessed.Day()}}}
+	}
+	return item
+}
+
+type cslWriter struct {
+	w     io.Writer
+	first bool
+}
+
+func newCSLWriter(w io.Writer) (exportWriter, error) {
+	if _, err := io.WriteString(w, "[\n"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &cslWriter{w: w, first: true}, nil
+}
+
+func (cw *cslWriter) Write(rec *exportRecord) error {
+	data, err := json.Marshal(cslItem(rec))
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal csl item '%s'", rec.Signature)
+	}
+	if !cw.first {
+		if _, err := io.WriteString(cw.w, ",\n"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	cw.first = false
+	_, err = cw.w.Write(data)
+	return errors.WithStack(err)
+}
+
+func (cw *cslWriter) Close() error {
+	_, err := io.WriteString(cw.w, "\n]\n")
+	return errors.WithStack(err)
+}
+
+// export streams all results of the search in the requested format
+func (ctrl *Controller) export(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	formatName := c.Param("format")
+	format, ok := exportFormats[formatName]
+	if !ok {
+		ctrl.logger.Error().Msgf("unknown export format '%s'", formatName)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("unknown export format '%s'", formatName))
+		return
+	}
+	params := newSearchParams(c.Request.URL.Query())
+	sr, err := ctrl.prepareSearch(c, params)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", params.Search)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", params.Search, err))
+		return
+	}
+	if sr.QueryError != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, sr.QueryError)
+		return
+	}
+
+	// the response is started with the first page, so a failing search can still be reported
+	var wr exportWriter
+	err = ctrl.searchAll(c, sr, func(edges []*client.Search_Search_Edges, total int64) error {
+		if wr == nil {
+			c.Header("Content-Type", format.ContentType)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"export.%s\"", format.Extension))
+			c.Header(totalCountHeader, strconv.FormatInt(total, 10))
+			if total > maxResultWindow {
+				c.Header(exportTruncatedHeader, strconv.FormatInt(maxResultWindow, 10))
+			}
+			c.Status(http.StatusOK)
+			var err error
+			if wr, err = format.NewWriter(c.Writer); err != nil {
+				return errors.Wrapf(err, "cannot create %s writer", formatName)
+			}
+		}
+		for _, e := range edges {
+			if err := wr.Write(ctrl.newExportRecord(e.GetBase(), e.GetAbstract(), lang)); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if wr == nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot export '%s' as %s", params.Search, formatName)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot export '%s' as %s: %v", params.Search, formatName, err))
+		return
+	}
+	// the response is already sent, errors can only be logged
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot export '%s' as %s", params.Search, formatName)
+	}
+	if err := wr.Close(); err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot close %s export", formatName)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func testRecord() *exportRecord {
+	return &exportRecord{
+		Signature: "zotero2-1.AB C",
+		Title:     "50% & more {sic}",
+		Persons: []*exportPerson{
+			{Name: "Doe, John", Role: "artist"},
+			{Name: "Smith, Ann", Role: "editor"},
+			{Name: "Studio X", Role: "camera"},
+		},
+		Date:       "ca. 1995",
+		Year:       1995,
+		Place:      "Basel",
+		Collection: "Performance Chronik",
+		Type:       "videoRecording",
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	for name, want := range map[string][]string{
+		"csv":    {"signature,title,persons", `"Doe, John (artist); Smith, Ann (editor); Studio X (camera)"`},
+		"bibtex": {"@misc{zotero2-1.AB_C,", `title = {50\% \& more \{sic\}}`, "author = {Doe, John}", "editor = {Smith, Ann}", "year = {1995}", "note = {Studio X (camera)}"},
+		"ris":    {"TY  - VIDEO\r\n", "AU  - Doe, John\r\n", "ED  - Smith, Ann\r\n", "A2  - Studio X\r\n", "ER  - \r\n"},
+	} {
+		buf := &bytes.Buffer{}
+		wr, err := exportFormats[name].NewWriter(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Write(testRecord()); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(buf.String(), w) {
+				t.Errorf("%s: '%s' missing in\n%s", name, w, buf.String())
+			}
+		}
+	}
+}
+
+func TestExportCSL(t *testing.T) {
+	buf := &bytes.Buffer{}
+	wr, err := exportFormats["csl"].NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := wr.Write(testRecord()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatalf("invalid csl-json: %v\n%s", err, buf.String())
+	}
+	if len(items) != 2 {
+		t.Fatalf("%d items, want 2", len(items))
+	}
+	item := items[0]
+	if item["type"] != "motion_picture" {
+		t.Errorf("type is %v", item["type"])
+	}
+	if authors, _ := item["author"].([]any); len(authors) != 1 || authors[0].(map[string]any)["family"] != "Doe" {
+		t.Errorf("invalid author %v", item["author"])
+	}
+	if contributors, _ := item["contributor"].([]any); len(contributors) != 1 || contributors[0].(map[string]any)["literal"] != "Studio X" {
+		t.Errorf("invalid contributor %v", item["contributor"])
+	}
+}
+
+func TestExportPages(t *testing.T) {
+	sortOptions, err := initSortOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, total := range []int64{0, 450, maxResultWindow + 5} {
+		tc := &testClient{search: func(req *testSearch) (*client.Search, error) {
+			result := &client.Search{}
+			result.Search.TotalCount = total
+			result.Search.Edges = edges()
+			for i := *req.First; i < min(*req.First+*req.Size, total); i++ {
+				result.Search.Edges = append(result.Search.Edges, edges(fmt.Sprintf("zotero2-1.%05d", i))...)
+			}
+			return result, nil
+		}}
+		ctrl := &Controller{client: tc, bundle: i18n.NewBundle(language.German), sortOptions: sortOptions, collectionRegistry: &collectionRegistry{}}
+		w := testRequest(ctrl.export, httptest.NewRequest(http.MethodGet, "/export/de/csv?search=test", nil), gin.Param{Key: "lang", Value: "de"}, gin.Param{Key: "format", Value: "csv"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		// the pages need no aggregations
+		for _, req := range tc.searches {
+			if len(req.Facets) > 0 {
+				t.Errorf("export page searched with %d facets", len(req.Facets))
+			}
+		}
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := min(total, maxResultWindow) + 1; int64(len(rows)) != want {
+			t.Errorf("%d hits: %d rows exported, want %d", total, len(rows), want)
+		}
+		if got := w.Header().Get(totalCountHeader); got != fmt.Sprint(total) {
+			t.Errorf("%d hits: invalid total count header %q", total, got)
+		}
+		truncated := w.Header().Get(exportTruncatedHeader)
+		if (total > maxResultWindow) != (truncated == fmt.Sprint(maxResultWindow)) {
+			t.Errorf("%d hits: invalid truncation header %q", total, truncated)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+const (
+	facetTypeCollection = "collection"
+	facetTypeVocabulary = "vocabulary"
+	facetTypeDate       = "date"
+	facetTypeTerm       = "term"
+)
+
+// facetParamPrefix is the url parameter prefix of the term facets
+const facetParamPrefix = "facet_"
+
+var facetDefaultSize = map[string]int64{
+	facetTypeCollection: 200,
+	facetTypeVocabulary: 1200,
+	facetTypeDate:       10000,
+	facetTypeTerm:       50,
+}
+
+// FacetConfig declares a facet of the search pages.
+// Type is collection, vocabulary, date or term. There may be only one facet of the first three types.
+// Include and Exclude are regular expressions for the values, And combines selected values with AND instead of OR.
+// Exclude is applied to the Size most frequent values, the excluded ones are not replaced by less frequent values.
+// Label is the i18n key of the heading, facets are displayed in ascending Order
+type FacetConfig struct {
+	Name        string   `toml:"name" json:"name"`
+	Type        string   `toml:"type" json:"type"`
+	Field       string   `toml:"field" json:"field"`
+	Size        int64    `toml:"size" json:"size"`
+	MinDocCount int64    `toml:"mindoccount" json:"minDocCount"`
+	Include     []string `toml:"include" json:"include"`
+	Exclude     []string `toml:"exclude" json:"exclude"`
+	And         bool     `toml:"and" json:"and"`
+	Label       string   `toml:"label" json:"label"`
+	Order       int      `toml:"order" json:"order"`
+
+	excludeRegexps []*regexp.Regexp
+}
+
+// DefaultFacets are the facets of the search pages without facet configuration
+func DefaultFacets(vocabularyInclude, vocabularyExclude []string) []*FacetConfig {
+	return []*FacetConfig{
+		{Name: "date", Type: facetTypeDate, MinDocCount: 1, Label: "date", Order: 10},
+		{Name: "collections", Type: facetTypeCollection, Field: "category.keyword", Label: "collection", Order: 20},
+		{Name: "vocabulary", Type: facetTypeVocabulary, Field: vocabularyField, MinDocCount: 1, Include: vocabularyInclude, Exclude: vocabularyExclude, And: true, Label: "vocabulary", Order: 30},
+	}
+}
+
+// Param returns the url parameter of the facet selection
+func (fc *FacetConfig) Param() string {
+	switch fc.Type {
+	case facetTypeCollection:
+		return "collections"
+	case facetTypeVocabulary:
+		return "vocabulary"
+	case facetTypeDate:
+		return "dates"
+	default:
+		return facetParamPrefix + fc.Name
+	}
+}
+
+// excluded checks the value against the exclude expressions, which are not supported by revcat.
+// The aggregation is limited to Size values before, excluded values reduce the number of values shown
+func (fc *FacetConfig) excluded(value string) bool {
+	for _, re := range fc.excludeRegexps {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludable is true, if values of the facet can be excluded from the search.
+// The exclusions are negated phrases of the fulltext query, they are exact for vocabulary ids and signatures only,
+// other values may also occur in free text
+func (fc *FacetConfig) excludable() bool {
+	return fc.Type == facetTypeVocabulary || aggregationField(fc.Field) == signatureField
+}
+
+// aggregationField removes the nested path syntax of field, which is only supported in filters
+func aggregationField(field string) string {
+	return strings.NewReplacer("[", "", "]", "").Replace(field)
+}
+
+func (fc *FacetConfig) aggregationField() string {
+	return aggregationField(fc.Field)
+}
+
+// inFacet creates the revcat facet without selected values
+func (fc *FacetConfig) inFacet() *client.InFacet {
+	include := []string{}
+	// revcat uses a single include as regexp, several includes are exact values
+	switch len(fc.Include) {
+	case 0:
+	case 1:
+		include = append(include, fc.Include[0])
+	default:
+		include = append(include, "("+strings.Join(fc.Include, ")|(")+")")
+	}
+	return &client.InFacet{
+		Term: &client.InFacetTerm{
+			Name:        fc.Name,
+			Field:       fc.aggregationField(),
+			Size:        fc.Size,
+			MinDocCount: fc.MinDocCount,
+			Include:     include,
+			Exclude:     []string{},
+		},
+		Query: &client.InFilter{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  fc.Field,
+				Values: []string{},
+				And:    fc.And,
+			},
+		},
+	}
+}
+
+// termCountsSize is the maximum number of values of termCounts
+const termCountsSize = 10000
+
+// termCounts returns the number of hits per value of field of a search.
+// Fields with more values than termCountsSize are reported as QueryError, the counts would be incomplete.
+// A non-empty include restricts the aggregation to the values matching the regular expression
+func (ctrl *Controller) termCounts(ctx context.Context, query string, filter []*client.InFilter, name, field, include string) (map[string]int, error) {
+	var size int64 = 0
+	facet := &client.InFacet{
+		Term: &client.InFacetTerm{
+			Name:        name,
+			Field:       aggregationField(field),
+			Size:        termCountsSize + 1,
+			MinDocCount: 1,
+			Include:     []string{},
+			Exclude:     []string{},
+		},
+		Query: &client.InFilter{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  field,
+				Values: []string{},
+			},
+		},
+	}
+	if include != "" {
+		facet.Term.Include = []string{include}
+	}
+	result, err := ctrl.client.Search(ctx, query, []*client.InFacet{facet}, filter, nil, nil, &size, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search for values of '%s'", field)
+	}
+	counts := map[string]int{}
+	for _, f := range result.GetSearch().GetFacets() {
+		for _, val := range f.GetValues() {
+			if strVal := val.GetFacetValueString(); strVal != nil {
+				counts[strVal.GetStrVal()] = int(strVal.GetCount())
+			}
+		}
+	}
+	if len(counts) > termCountsSize {
+		return nil, &QueryError{Msg: fmt.Sprintf("more than %d values of '%s'", termCountsSize, field)}
+	}
+	return counts, nil
+}
+
+// initFacets checks the facet configuration and sorts the facets by order.
+// The date facet needs the date field mapping for resolving the year ranges
+func initFacets(facets []*FacetConfig, fieldMapping map[string]*FieldMapping) ([]*FacetConfig, error) {
+	result := []*FacetConfig{}
+	names := map[string]bool{}
+	types := map[string]bool{}
+	for _, fc := range facets {
+		if fc.Name == "" {
+			return nil, errors.Errorf("facet without name: %+v", fc)
+		}
+		if names[fc.Name] {
+			return nil, errors.Errorf("duplicate facet '%s'", fc.Name)
+		}
+		names[fc.Name] = true
+		if _, ok := facetDefaultSize[fc.Type]; !ok {
+			return nil, errors.Errorf("unknown type '%s' of facet '%s'", fc.Type, fc.Name)
+		}
+		if fc.Type != facetTypeTerm {
+			if types[fc.Type] {
+				return nil, errors.Errorf("more than one %s facet", fc.Type)
+			}
+			types[fc.Type] = true
+		}
+		if fc.Type == facetTypeDate {
+			dateMapping, ok := fieldMapping["date"]
+			if !ok {
+				if fc.Field != "" {
+					return nil, errors.Errorf("date facet '%s' needs a date field mapping", fc.Name)
+				}
+				// no date search, no date facet
+				continue
+			}
+			if fc.Field != "" && fc.Field != dateMapping.Field {
+				return nil, errors.Errorf("field '%s' of date facet '%s' differs from date field mapping '%s'", fc.Field, fc.Name, dateMapping.Field)
+			}
+			fc.Field = dateMapping.Field
+		}
+		if fc.Field == "" {
+			return nil, errors.Errorf("facet '%s' without field", fc.Name)
+		}
+		if fc.Size == 0 {
+			fc.Size = facetDefaultSize[fc.Type]
+		}
+		if fc.Label == "" {
+			fc.Label = fc.Name
+		}
+		fc.excludeRegexps = []*regexp.Regexp{}
+		for _, ex := range fc.Exclude {
+			re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", ex))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid exclude '%s' of facet '%s'", ex, fc.Name)
+			}
+			fc.excludeRegexps = append(fc.excludeRegexps, re)
+		}
+		result = append(result, fc)
+	}
+	slices.SortStableFunc(result, func(a, b *FacetConfig) int { return a.Order - b.Order })
+	return result, nil
+}
+
+// facetConfig returns the facet with the given name
+func (ctrl *Controller) facetConfig(name string) (*FacetConfig, bool) {
+	for _, fc := range ctrl.facets {
+		if fc.Name == name {
+			return fc, true
+		}
+	}
+	return nil, false
+}
+
+// facetOfType returns the collection, vocabulary or date facet
+func (ctrl *Controller) facetOfType(facetType string) (*FacetConfig, bool) {
+	return facetOfType(ctrl.facets, facetType)
+}
+
+func facetOfType(facets []*FacetConfig, facetType string) (*FacetConfig, bool) {
+	for _, fc := range facets {
+		if fc.Type == facetType {
+			return fc, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+func TestInitFacets(t *testing.T) {
+	fieldMapping := map[string]*FieldMapping{"date": {Field: "date.keyword"}}
+	facets, err := initFacets(append(DefaultFacets([]string{"voc:.*", "vww:.*"}, []string{"voc:voc_intern:.*"}),
+		&FacetConfig{Name: "place", Type: facetTypeTerm, Field: "place.keyword", MinDocCount: 1, Order: 15},
+		&FacetConfig{Name: "role", Type: facetTypeTerm, Field: "[persons].role.keyword", Order: 40},
+	), fieldMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fc := range facets {
+		names = append(names, fc.Name)
+	}
+	if want := "date place collections vocabulary role"; strings.Join(names, " ") != want {
+		t.Errorf("order is '%s', want '%s'", strings.Join(names, " "), want)
+	}
+	if facets[0].Field != "date.keyword" || facets[0].Size != 10000 {
+		t.Errorf("date facet not initialized: %+v", facets[0])
+	}
+	if facets[1].Param() != "facet_place" || facets[1].Label != "place" || facets[1].Size != 50 {
+		t.Errorf("term facet not initialized: %+v", facets[1])
+	}
+	voc := facets[3].inFacet()
+	if len(voc.Term.Include) != 1 || voc.Term.Include[0] != "(voc:.*)|(vww:.*)" {
+		t.Errorf("includes not combined: %v", voc.Term.Include)
+	}
+	if !voc.Query.BoolTerm.And {
+		t.Error("vocabulary facet must combine values with and")
+	}
+	if !facets[3].excluded("voc:voc_intern:voc_x") || facets[3].excluded("voc:voc_tanzen:voc_wild") {
+		t.Error("invalid exclude")
+	}
+	if role := facets[4].inFacet(); role.Term.Field != "persons.role.keyword" || role.Query.BoolTerm.Field != "[persons].role.keyword" {
+		t.Errorf("invalid nested field: %s / %s", role.Term.Field, role.Query.BoolTerm.Field)
+	}
+
+	// without date mapping the default date facet is skipped
+	facets, err = initFacets(DefaultFacets(nil, nil), map[string]*FieldMapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facets) != 2 {
+		t.Errorf("%d facets, want 2", len(facets))
+	}
+
+	for _, invalid := range [][]*FacetConfig{
+		{{Name: "a", Type: facetTypeTerm}},
+		{{Name: "a", Type: "unknown", Field: "a"}},
+		{{Name: "a", Type: facetTypeTerm, Field: "a"}, {Name: "a", Type: facetTypeTerm, Field: "b"}},
+		{{Name: "a", Type: facetTypeVocabulary, Field: "a"}, {Name: "b", Type: facetTypeVocabulary, Field: "b"}},
+		{{Name: "a", Type: facetTypeDate, Field: "other.keyword"}},
+		{{Name: "a", Type: facetTypeTerm, Field: "a", Exclude: []string{"("}}},
+	} {
+		if _, err := initFacets(invalid, fieldMapping); err == nil {
+			t.Errorf("no error for invalid facets %+v", invalid[0])
+		}
+	}
+}
+
+func TestExcludedFacetValues(t *testing.T) {
+	params := newSearchParams(map[string][]string{"collections": {"3,-5,x,-"}})
+	selected, excluded := params.collectionIDs()
+	if len(selected) != 1 || selected[0] != 3 || len(excluded) != 1 || excluded[0] != 5 {
+		t.Errorf("invalid collections %v, excluded %v", selected, excluded)
+	}
+	vals, exVals := splitExcluded([]string{"Basel", "-Bern", "-"})
+	if strings.Join(vals, ",") != "Basel" || strings.Join(exVals, ",") != "Bern" {
+		t.Errorf("invalid values %v, excluded %v", vals, exVals)
+	}
+	for _, tc := range []struct{ query, want string }{
+		{"", `+-"voc:voc_tanzen" +-"say \"hi\""`},
+		{"tanz | theater", `(tanz | theater) +-"voc:voc_tanzen" +-"say \"hi\""`},
+	} {
+		if got := excludeQuery(tc.query, []string{"voc:voc_tanzen", `say "hi"`}); got != tc.want {
+			t.Errorf("excludeQuery(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+	if got := excludeQuery("tanz", nil); got != "tanz" {
+		t.Errorf("query without exclusions changed to %q", got)
+	}
+}
+
+// termSearch answers each search with a facet of the values and their count
+func termSearch(values map[string]int) func(req *testSearch) (*client.Search, error) {
+	return func(req *testSearch) (*client.Search, error) {
+		result := &client.Search{}
+		for _, facet := range req.Facets {
+			ff := &client.FacetFragment{Name: facet.Term.Name}
+			for val, count := range values {
+				ff.Values = append(ff.Values, &client.FacetValueFragment{FacetValueString: client.FacetValueStringFragment{StrVal: val, Count: int64(count)}})
+			}
+			result.Search.Facets = append(result.Search.Facets, ff)
+		}
+		return result, nil
+	}
+}
+
+func TestTermCounts(t *testing.T) {
+	tc := &testClient{search: termSearch(map[string]int{"1995": 2, "ca. 2001": 1})}
+	ctrl := &Controller{client: tc, fieldMapping: map[string]*FieldMapping{"date": {Field: "[dates].date.keyword"}}}
+	dates, err := ctrl.dateValues(context.Background(), []string{"global/guest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(dates, ",") != "1995,ca. 2001" {
+		t.Errorf("invalid dates %v", dates)
+	}
+	req := tc.searches[0]
+	if req.Facets[0].Term.Field != "dates.date.keyword" || req.Facets[0].Query.BoolTerm.Field != "[dates].date.keyword" {
+		t.Errorf("invalid facet fields %+v", req.Facets[0].Term)
+	}
+	// the dates are restricted like the search pages
+	if len(req.Filter) != 2 || req.Filter[0].ExistsTerm == nil || req.Filter[1].BoolTerm.Field != "acl.content.keyword" {
+		t.Errorf("invalid filter %+v", req.Filter)
+	}
+
+	values := map[string]int{}
+	for i := range termCountsSize + 1 {
+		values[fmt.Sprint(i)] = 1
+	}
+	tc.search = termSearch(values)
+	_, err = ctrl.termCounts(context.Background(), "", nil, "place", "place.keyword", "")
+	var qErr *QueryError
+	if !errors.As(err, &qErr) {
+		t.Errorf("incomplete counts must fail: %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/bluele/gcache"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const feedSize int64 = 50
+
+// feedSortField is the indexing timestamp, which puts the newest entries first
+const feedSortField = "timestamp"
+
+const feedPosterParam = "size240x240/formatPNG/autorotate"
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string        `xml:"title"`
+	ID      string        `xml:"id"`
+	Updated string        `xml:"updated"`
+	Authors []*atomPerson `xml:"author"`
+	Links   []*atomLink   `xml:"link"`
+	Summary string        `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string       `xml:"xml:lang,attr"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []*atomLink  `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        *rssGUID      `xml:"guid"`
+	Description string        `xml:"description,omitempty"`
+	Creators    []string      `xml:"dc:creator"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	Language      string     `xml:"language"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	AtomLink      *atomLink  `xml:"atom:link"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name    `xml:"rss"`
+	Version string      `xml:"version,attr"`
+	NSAtom  string      `xml:"xmlns:atom,attr"`
+	NSDC    string      `xml:"xmlns:dc,attr"`
+	Channel *rssChannel `xml:"channel"`
+}
+
+// feedItem is an entry of the atom or rss feed
+type feedItem struct {
+	*exportRecord
+	Poster  string
+	Updated time.Time
+}
+
+// feedTimesPrefix is the key prefix of the feed times in the database
+const feedTimesPrefix = "feedtime:"
+
+const (
+	defaultFeedTimesSize = 10000
+	defaultFeedTimesTTL  = 90 * 24 * time.Hour
+)
+
+// FeedTimes keeps the time, when an entry is part of a feed for the first time.
+// revcat does not return the indexing timestamp, which sorts the feeds, so the first appearance stands in for it.
+// Without database, the times of the size last entries are kept in memory and change with a restart.
+// The database keeps the times over restarts, an entry which is not part of a feed for ttl is removed
+// and gets a new time with its next appearance. Replicas have databases of their own and may differ
+type FeedTimes struct {
+	mutex sync.Mutex
+	mem   gcache.Cache
+	db    *badger.DB
+	ttl   time.Duration
+}
+
+// NewFeedTimes keeps the feed times in db or in memory, if db is nil
+func NewFeedTimes(db *badger.DB, size int, ttl time.Duration) *FeedTimes {
+	if size <= 0 {
+		size = defaultFeedTimesSize
+	}
+	if ttl <= 0 {
+		ttl = defaultFeedTimesTTL
+	}
+	return &FeedTimes{
+		mem: gcache.New(size).LRU().Build(),
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// get returns the first time of the signature, now for a new one
+func (ft *FeedTimes) get(signature string, now time.Time) (time.Time, error) {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+	if ft.db == nil {
+		if t, err := ft.mem.Get(signature); err == nil {
+			return t.(time.Time), nil
+		}
+		if err := ft.mem.Set(signature, now); err != nil {
+			return now, errors.Wrapf(err, "cannot store feed time of '%s'", signature)
+		}
+		return now, nil
+	}
+	t := now
+	if err := ft.db.Update(func(txn *badger.Txn) error {
+		key := []byte(feedTimesPrefix + signature)
+		item, err := txn.Get(key)
+		switch {
+		case err == nil:
+			if err := item.Value(t.UnmarshalBinary); err != nil {
+				return errors.Wrapf(err, "cannot decode feed time of '%s'", signature)
+			}
+			// the expiry is extended, when half of the ttl has passed
+			if time.Until(time.Unix(int64(item.ExpiresAt()), 0)) > ft.ttl/2 {
+				return nil
+			}
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return errors.Wrapf(err, "cannot read feed time of '%s'", signature)
+		}
+		val, err := t.MarshalBinary()
+		if err != nil {
+			return errors.Wrapf(err, "cannot encode feed time of '%s'", signature)
+		}
+		if err := txn.SetEntry(badger.NewEntry(key, val).WithTTL(ft.ttl)); err != nil {
+			return errors.Wrapf(err, "cannot store feed time of '%s'", signature)
+		}
+		return nil
+	}); err != nil {
+		return now, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+// feedUpdated returns the newest updated time of the items, empty is the time of a feed without items
+func feedUpdated(items []*feedItem, empty time.Time) time.Time {
+	if len(items) == 0 {
+		return empty
+	}
+	updated := items[0].Updated
+	for _, item := range items[1:] {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+	}
+	return updated
+}
+
+// summary contains persons, date and place followed by the abstract
+func (item *feedItem) summary() string {
+	parts := []string{}
+	for _, part := range []string{joinPersons(item.Persons, "; ", false), item.Date, item.Place} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	result := strings.Join(parts, ", ")
+	if item.Abstract != "" {
+		if result != "" {
+			result += "\n\n"
+		}
+		result += item.Abstract
+	}
+	return result
+}
+
+func newAtomFeed(title, self, alternate, lang string, updated time.Time, items []*feedItem) *atomFeed {
+	feed := &atomFeed{
+		Lang:    lang,
+		Title:   title,
+		ID:      self,
+		Updated: updated.Format(time.RFC3339),
+		Links: []*atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: alternate},
+		},
+		Entries: []*atomEntry{},
+	}
+	for _, item := range items {
+		entry := &atomEntry{
+			Title:   item.Title,
+			ID:      item.Link,
+			Updated: item.Updated.Format(time.RFC3339),
+			Authors: []*atomPerson{},
+			Links: []*atomLink{
+				{Rel: "alternate", Type: "text/html", Href: item.Link},
+			},
+			Summary: item.summary(),
+		}
+		for _, p := range item.creators() {
+			entry.Authors = append(entry.Authors, &atomPerson{Name: p.Name})
+		}
+		if item.Poster != "" {
+			entry.Links = append(entry.Links, &atomLink{Rel: "enclosure", Type: "image/png", Href: item.Poster})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func newRSSFeed(title, self, alternate, lang string, updated time.Time, items []*feedItem) *rssFeed {
+	feed := &rssFeed{
+		Version: "2.0",
+		NSAtom:  "http://www.w3.org/2005/Atom",
+		NSDC:    "http://purl.org/dc/elements/1.1/",
+		Channel: &rssChannel{
+			Title:         title,
+			Link:          alternate,
+			Description:   title,
+			Language:      lang,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			AtomLink:      &atomLink{Rel: "self", Type: "application/rss+xml", Href: self},
+			Items:         []*rssItem{},
+		},
+	}
+	for _, item := range items {
+		rItem := &rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        &rssGUID{IsPermaLink: true, Value: item.Link},
+			Description: item.summary(),
+			Creators:    []string{},
+		}
+		for _, p := range item.creators() {
+			rItem.Creators = append(rItem.Creators, p.Name)
+		}
+		if item.Poster != "" {
+			rItem.Enclosure = &rssEnclosure{URL: item.Poster, Type: "image/png"}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rItem)
+	}
+	return feed
+}
+
+// feed returns the newest entries of a search as atom or rss feed.
+// The ki ranking is not used, feeds are sorted by date unless there is a sort option
+func (ctrl *Controller) feed(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	format := c.Param("format")
+	var contentType string
+	switch format {
+	case "atom":
+		contentType = "application/atom+xml; charset=utf-8"
+	case "rss":
+		contentType = "application/rss+xml; charset=utf-8"
+	default:
+		ctrl.logger.Error().Msgf("unknown feed format '%s'", format)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("unknown feed format '%s'", format))
+		return
+	}
+	params := newSearchParams(c.Request.URL.Query())
+	params.KI = false
+	sr, err := ctrl.prepareSearch(c, params)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", params.Search)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", params.Search, err))
+		return
+	}
+	if sr.QueryError != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, sr.QueryError)
+		return
+	}
+	// the relevance ranking is replaced by the newest entries
+	if sr.Sort == sortRelevance {
+		sr.sort = []*client.SortField{{Field: feedSortField, Order: sortOrderDesc}}
+	}
+	var first, size int64 = 0, feedSize
+	result, err := ctrl.client.Search(c, sr.queryString, sr.facets, sr.filter, nil, &first, &size, nil, sr.sort)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot search for '%s'", params.Search)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot search for '%s': %v", params.Search, err))
+		return
+	}
+
+	now := time.Now()
+	items := []*feedItem{}
+	for _, e := range result.GetSearch().GetEdges() {
+		item := &feedItem{
+			exportRecord: ctrl.newExportRecord(e.GetBase(), e.GetAbstract(), lang),
+		}
+		if item.Updated, err = ctrl.feedTimes.get(e.GetBase().GetSignature(), now); err != nil {
+			ctrl.logger.Error().Err(err).Msgf("cannot get feed time of '%s'", e.GetBase().GetSignature())
+		}
+		if poster := e.GetBase().GetPoster(); poster != nil {
+			se := newSearchEdge(e)
+			item.Poster = ctrl.mediaLink(poster.GetURI(), "resize", feedPosterParam, e.GetBase().GetMediaVisible() && se.ProtectedContent)
+		}
+		items = append(items, item)
+	}
+
+	localizer := i18n.NewLocalizer(ctrl.bundle, lang)
+	title, err := localizer.LocalizeMessage(&i18n.Message{ID: "title"})
+	if err != nil {
+		title = "title"
+	}
+	if params.Search != "" {
+		title = fmt.Sprintf("%s: %s", title, params.Search)
+	}
+	var query string
+	if values := params.values(); len(values) > 0 {
+		query = "?" + values.Encode()
+	}
+	self := fmt.Sprintf("%s/feed/%s/%s%s", ctrl.searchAddr, format, lang, query)
+	alternate := fmt.Sprintf("%s/grid/%s%s", ctrl.searchAddr, lang, query)
+
+	var feed any
+	updated := feedUpdated(items, now)
+	if format == "atom" {
+		feed = newAtomFeed(title, self, alternate, lang, updated, items)
+	} else {
+		feed = newRSSFeed(title, self, alternate, lang, updated, items)
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if _, err := c.Writer.WriteString(xml.Header); err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot write %s feed", format)
+		return
+	}
+	enc := xml.NewEncoder(c.Writer)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot write %s feed", format)
+	}
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchDescription struct {
+	XMLName       xml.Name         `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string           `xml:"ShortName"`
+	Description   string           `xml:"Description"`
+	InputEncoding string           `xml:"InputEncoding"`
+	Language      string           `xml:"Language"`
+	URLs          []*openSearchURL `xml:"Url"`
+}
+
+// openSearch returns the opensearch description document for browsers and aggregators
+func (ctrl *Controller) openSearch(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	localizer := i18n.NewLocalizer(ctrl.bundle, lang)
+	title, err := localizer.LocalizeMessage(&i18n.Message{ID: "title"})
+	if err != nil {
+		title = "title"
+	}
+	shortName, err := localizer.LocalizeMessage(&i18n.Message{ID: "shorttitle"})
+	if err != nil {
+		shortName = title
+	}
+	desc := &openSearchDescription{
+		ShortName:     shortName,
+		Description:   title,
+		InputEncoding: "UTF-8",
+		Language:      lang,
+		URLs: []*openSearchURL{
+			{Type: "text/html", Template: fmt.Sprintf("%s/grid/%s?search={searchTerms}", ctrl.searchAddr, lang)},
+			{Type: "application/atom+xml", Template: fmt.Sprintf("%s/feed/atom/%s?search={searchTerms}", ctrl.searchAddr, lang)},
+			{Type: "application/rss+xml", Template: fmt.Sprintf("%s/feed/rss/%s?search={searchTerms}", ctrl.searchAddr, lang)},
+			{Type: "application/x-suggestions+json", Template: fmt.Sprintf("%s/api/suggest/%s?format=opensearch&q={searchTerms}", ctrl.searchAddr, lang)},
+			{Type: "application/opensearchdescription+xml", Rel: "self", Template: fmt.Sprintf("%s/opensearch/%s", ctrl.searchAddr, lang)},
+		},
+	}
+	data, err := xml.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msg("cannot create opensearch description")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot create opensearch description: %v", err))
+		return
+	}
+	c.Data(http.StatusOK, "application/opensearchdescription+xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
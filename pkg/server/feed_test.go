@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestFeeds(t *testing.T) {
+	items := []*feedItem{{exportRecord: testRecord(), Poster: "https://media.example/poster"}}
+	items[0].Link = "https://detail.example/detail/sig/de"
+	items[0].Updated = time.Date(2024, 4, 2, 8, 30, 0, 0, time.UTC)
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	data, err := xml.Marshal(newAtomFeed("feed", "https://self", "https://alternate", "de", updated, items))
+	if err != nil {
+		t.Fatal(err)
+	}
+	atom := string(data)
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="de">`,
+		`<updated>2024-05-01T12:00:00Z</updated>`,
+		`<id>https://detail.example/detail/sig/de</id><updated>2024-04-02T08:30:00Z</updated>`,
+		`<author><name>Doe, John</name></author><link rel="alternate"`,
+		`<link rel="enclosure" type="image/png" href="https://media.example/poster">`,
+		`<summary>Doe, John; Smith, Ann; Studio X, ca. 1995, Basel</summary>`,
+	} {
+		if !strings.Contains(atom, want) {
+			t.Errorf("atom: '%s' missing in\n%s", want, atom)
+		}
+	}
+
+	data, err = xml.Marshal(newRSSFeed("feed", "https://self", "https://alternate", "de", updated, items))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rss := string(data)
+	for _, want := range []string{
+		`<lastBuildDate>Wed, 01 May 2024 12:00:00 +0000</lastBuildDate>`,
+		`<guid isPermaLink="true">https://detail.example/detail/sig/de</guid>`,
+		`<dc:creator>Doe, John</dc:creator><enclosure`,
+	} {
+		if !strings.Contains(rss, want) {
+			t.Errorf("rss: '%s' missing in\n%s", want, rss)
+		}
+	}
+}
+
+func TestFeedTimes(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for name, ft := range map[string]*FeedTimes{"memory": NewFeedTimes(nil, 10, 0), "badger": NewFeedTimes(db, 10, 0)} {
+		first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		later := first.Add(time.Hour)
+		if got, err := ft.get("sig1", first); err != nil || !got.Equal(first) {
+			t.Errorf("%s: new entry has time %v (%v), want %v", name, got, err, first)
+		}
+		// the time of an entry does not change with the next request
+		items := []*feedItem{{exportRecord: testRecord()}, {exportRecord: testRecord()}}
+		for i, sig := range []string{"sig1", "sig2"} {
+			if items[i].Updated, err = ft.get(sig, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !items[0].Updated.Equal(first) || !items[1].Updated.Equal(later) {
+			t.Errorf("%s: invalid times %v and %v", name, items[0].Updated, items[1].Updated)
+		}
+		if got := feedUpdated(items, time.Time{}); !got.Equal(later) {
+			t.Errorf("%s: feed is updated %v, want the newest entry %v", name, got, later)
+		}
+		if got := feedUpdated(nil, first); !got.Equal(first) {
+			t.Errorf("%s: empty feed is updated %v, want %v", name, got, first)
+		}
+	}
+	// the times survive a restart with the same database
+	if got, err := NewFeedTimes(db, 10, 0).get("sig1", time.Now()); err != nil || !got.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("time %v (%v) after restart", got, err)
+	}
+	// the memory keeps the last entries only
+	ft := NewFeedTimes(nil, 2, 0)
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, sig := range []string{"sig1", "sig2", "sig3"} {
+		if _, err := ft.get(sig, first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := ft.get("sig1", first.Add(time.Hour)); got.Equal(first) {
+		t.Errorf("removed entry has old time %v", got)
+	}
+}
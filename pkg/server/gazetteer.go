@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// gazetteerFile is the gazetteer in the data folder.
+// Each line contains name;latitude;longitude, further columns are ignored and lines starting with # are comments
+const gazetteerFile = "gazetteer.csv"
+
+// defaultPlaceField is the place field of the index, if there is no field mapping for place
+const defaultPlaceField = "place.keyword"
+
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// gazetteer geocodes the places of the records, the names are compared case-insensitive
+type gazetteer struct {
+	places map[string]geoPoint
+}
+
+func normalizePlace(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// loadGazetteer reads the gazetteer from the data folder, without gazetteer file no place is found
+func loadGazetteer(fsys fs.FS) (*gazetteer, error) {
+	g := &gazetteer{places: map[string]geoPoint{}}
+	if fsys == nil {
+		return g, nil
+	}
+	fp, err := fsys.Open(gazetteerFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return g, nil
+		}
+		return nil, errors.Wrapf(err, "cannot open '%s'", gazetteerFile)
+	}
+	defer fp.Close()
+	r := csv.NewReader(fp)
+	r.Comma = ';'
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read '%s'", gazetteerFile)
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) < 3 {
+			return nil, errors.Errorf("%s:%d: name, latitude and longitude expected", gazetteerFile, line)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, errors.Errorf("%s:%d: invalid latitude '%s'", gazetteerFile, line, record[1])
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil || lon < -180 || lon > 180 {
+			return nil, errors.Errorf("%s:%d: invalid longitude '%s'", gazetteerFile, line, record[2])
+		}
+		g.places[normalizePlace(record[0])] = geoPoint{Lat: lat, Lon: lon}
+	}
+	return g, nil
+}
+
+// lookup geocodes a place. Places like "Basel, Kaserne" fall back to the part before the first comma
+func (g *gazetteer) lookup(place string) (geoPoint, bool) {
+	if p, ok := g.places[normalizePlace(place)]; ok {
+		return p, true
+	}
+	if before, _, ok := strings.Cut(place, ","); ok {
+		p, ok := g.places[normalizePlace(before)]
+		return p, ok
+	}
+	return geoPoint{}, false
+}
+
+// bbox is a bounding box in degrees, boxes across the antimeridian are not supported
+type bbox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// parseBBox parses the url parameter bbox with west,south,east,north
+func parseBBox(str string) (*bbox, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 4 {
+		return nil, &QueryError{Msg: fmt.Sprintf("invalid bounding box '%s', west,south,east,north expected", str)}
+	}
+	coords := make([]float64, 4)
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, &QueryError{Msg: fmt.Sprintf("invalid coordinate '%s' in bounding box '%s'", part, str)}
+		}
+		coords[i] = f
+	}
+	bb := &bbox{West: coords[0], South: coords[1], East: coords[2], North: coords[3]}
+	if bb.West < -180 || bb.East > 180 || bb.South < -90 || bb.North > 90 || bb.West > bb.East || bb.South > bb.North {
+		return nil, &QueryError{Msg: fmt.Sprintf("invalid bounding box '%s'", str)}
+	}
+	return bb, nil
+}
+
+func (bb *bbox) contains(p geoPoint) bool {
+	return p.Lon >= bb.West && p.Lon <= bb.East && p.Lat >= bb.South && p.Lat <= bb.North
+}
+
+// String returns the url parameter of the bounding box
+func (bb *bbox) String() string {
+	coords := []string{}
+	for _, f := range []float64{bb.West, bb.South, bb.East, bb.North} {
+		coords = append(coords, strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return strings.Join(coords, ",")
+}
+
+// pointBBox is the bounding box of all places at the position of p
+func pointBBox(p geoPoint) *bbox {
+	return &bbox{West: p.Lon, South: p.Lat, East: p.Lon, North: p.Lat}
+}
+
+// placeField is the field of Base.Place in the index
+func (ctrl *Controller) placeField() string {
+	if mapping, ok := ctrl.fieldMapping["place"]; ok {
+		return mapping.Field
+	}
+	return defaultPlaceField
+}
+
+// geocodedPlaces returns the places of the catalogue visible for groups, which are in the gazetteer.
+// The places are cached per group set in placeStats
+func (ctrl *Controller) geocodedPlaces(ctx context.Context, groups []string) (map[string]geoPoint, error) {
+	counts, err := ctrl.termCounts(ctx, "", searchFilter(groups), "place", ctrl.placeField(), "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	places := map[string]geoPoint{}
+	for place := range counts {
+		if p, ok := ctrl.gazetteer.lookup(place); ok {
+			places[place] = p
+		}
+	}
+	return places, nil
+}
+
+// bboxFilter restricts the search to the places inside the bounding box.
+// revcat has no geo search, the places of the catalogue visible for groups are geocoded with the gazetteer.
+// A bounding box without places gets a filter, which matches no record
+func (ctrl *Controller) bboxFilter(ctx context.Context, groups []string, bb *bbox) (*client.InFilter, error) {
+	places, err := ctrl.placeStats.get(ctx, groups)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	values := []string{}
+	for place, p := range places.Value {
+		if bb.contains(p) {
+			values = append(values, place)
+		}
+	}
+	if len(values) == 0 {
+		values = []string{noMatchValue}
+	}
+	slices.Sort(values)
+	return &client.InFilter{
+		BoolTerm: &client.InFilterBoolTerm{
+			Field:  ctrl.placeField(),
+			Values: values,
+		},
+	}, nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLoadGazetteer(t *testing.T) {
+	fsys := fstest.MapFS{gazetteerFile: &fstest.MapFile{Data: []byte("# name;lat;lon\nBasel;47.5596;7.5886;CH\nZürich; 47.3769; 8.5417\n")}}
+	g, err := loadGazetteer(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for place, lon := range map[string]float64{"Basel": 7.5886, "BASEL ": 7.5886, "Basel, Kaserne": 7.5886, "zürich": 8.5417} {
+		if p, ok := g.lookup(place); !ok || p.Lon != lon {
+			t.Errorf("%s: %v (%v), expected longitude %v", place, p, ok, lon)
+		}
+	}
+	if _, ok := g.lookup("Bern"); ok {
+		t.Error("Bern must not be found")
+	}
+
+	if g, err := loadGazetteer(fstest.MapFS{}); err != nil || len(g.places) != 0 {
+		t.Errorf("missing gazetteer must be empty: %v", err)
+	}
+	if _, err := loadGazetteer(fstest.MapFS{gazetteerFile: &fstest.MapFile{Data: []byte("Basel;147.5;7.5\n")}}); err == nil {
+		t.Error("invalid latitude must fail")
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	bb, err := parseBBox("7.5, 47.5,7.6,47.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bb.contains(geoPoint{Lat: 47.5596, Lon: 7.5886}) || bb.contains(geoPoint{Lat: 47.3769, Lon: 8.5417}) {
+		t.Errorf("invalid bounding box %+v", bb)
+	}
+	if bb.String() != "7.5,47.5,7.6,47.6" {
+		t.Errorf("bounding box is '%s'", bb.String())
+	}
+	p := geoPoint{Lat: 47.5596, Lon: 7.5886}
+	point, err := parseBBox(pointBBox(p).String())
+	if err != nil || !point.contains(p) {
+		t.Errorf("point %v not in %+v: %v", p, point, err)
+	}
+	var qErr *QueryError
+	for _, str := range []string{"7.5,47.5", "a,47.5,7.6,47.6", "7.6,47.5,7.5,47.6", "7.5,-91,7.6,47.6"} {
+		if _, err := parseBBox(str); !errors.As(err, &qErr) {
+			t.Errorf("%s: query error expected, got %v", str, err)
+		}
+	}
+}
+
+func TestBBoxFilter(t *testing.T) {
+	g, err := loadGazetteer(fstest.MapFS{gazetteerFile: &fstest.MapFile{Data: []byte("Basel;47.5596;7.5886\nZürich;47.3769;8.5417\nRoma;41.8933;12.4829\n")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{search: termSearch(map[string]int{"Basel, Kaserne": 3, "Zürich": 1, "Roma": 2, "Atlantis": 1})}
+	ctrl := &Controller{client: tc, gazetteer: g, fieldMapping: map[string]*FieldMapping{"place": {Field: "[places].name.keyword"}}}
+	logger := zerolog.Nop()
+	ctrl.placeStats = newGroupStats(ctrl.geocodedPlaces, time.Hour, time.Hour, &logger)
+
+	filter, err := ctrl.bboxFilter(context.Background(), []string{"global/guest"}, &bbox{West: 5.9, South: 45.8, East: 10.5, North: 47.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.BoolTerm.Field != "[places].name.keyword" || strings.Join(filter.BoolTerm.Values, ";") != "Basel, Kaserne;Zürich" {
+		t.Errorf("invalid filter %+v", filter.BoolTerm)
+	}
+	filter, err = ctrl.bboxFilter(context.Background(), []string{"global/guest"}, &bbox{West: -10, South: 0, East: 0, North: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchesNothing(filter) {
+		t.Errorf("bounding box without places must not match: %v", filter.BoolTerm.Values)
+	}
+	// the places of a group set are searched and geocoded only once
+	if len(tc.searches) != 1 || tc.searches[0].Facets[0].Term.Field != "places.name.keyword" {
+		t.Errorf("%d searches for the places", len(tc.searches))
+	}
+
+	values := map[string]int{}
+	for i := range termCountsSize + 1 {
+		values[fmt.Sprintf("Ort %d", i)] = 1
+	}
+	tc.search = termSearch(values)
+	var qErr *QueryError
+	if _, err := ctrl.bboxFilter(context.Background(), []string{"global/admin"}, &bbox{West: -10, South: 0, East: 0, North: 10}); !errors.As(err, &qErr) {
+		t.Errorf("too many places must fail: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// rrfK is the rank constant of reciprocal rank fusion
+const rrfK = 60
+
+const hybridCursorPrefix = "hybrid:"
+
+func hybridCursor(offset int) string {
+	return fmt.Sprintf("%s%d", hybridCursorPrefix, offset)
+}
+
+func parseHybridCursor(cursor string) int {
+	offset, err := strconv.Atoi(strings.TrimPrefix(cursor, hybridCursorPrefix))
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// fuseRRF combines ranked result lists with weighted reciprocal rank fusion.
+// Entries are identified by signature, ties keep the order of the first occurrence
+func fuseRRF(lists [][]*client.Search_Search_Edges, weights []float64) []*client.Search_Search_Edges {
+	type scored struct {
+		edge  *client.Search_Search_Edges
+		score float64
+		pos   int
+	}
+	entries := map[string]*scored{}
+	result := []*scored{}
+	for i, list := range lists {
+		for rank, edge := range list {
+			id := edge.GetBase().GetSignature()
+			s, ok := entries[id]
+			if !ok {
+				s = &scored{edge: edge, pos: len(result)}
+				entries[id] = s
+				result = append(result, s)
+			}
+			s.score += weights[i] / float64(rrfK+rank+1)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b *scored) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		default:
+			return a.pos - b.pos
+		}
+	})
+	edges := make([]*client.Search_Search_Edges, 0, len(result))
+	for _, s := range result {
+		edges = append(edges, s.edge)
+	}
+	return edges
+}
+
+// hybridSearch runs the fulltext and the vector search and fuses the top hybridWindow results of both.
+// The vector search uses vectorQuery, which must not change the scores of the hits,
+// its hits are restricted to the fulltext query restriction afterwards.
+// The result is paged locally, the page info contains hybrid cursors. Facets are taken from the fulltext search
+func (ctrl *Controller) hybridSearch(ctx context.Context, queryString, vectorQuery, restriction string, embedding []float64, facets []*client.InFacet, filter []*client.InFilter, first, pageSize int64) (*client.Search, error) {
+	size := ctrl.hybridWindow
+	textResult, err := ctrl.client.Search(ctx, queryString, facets, filter, nil, nil, &size, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search for '%s'", queryString)
+	}
+	vectorResult, err := ctrl.client.Search(ctx, vectorQuery, facets, filter, embedding, nil, &size, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot search for embedding")
+	}
+	vectorEdges := vectorResult.GetSearch().GetEdges()
+	if restriction != "" {
+		if vectorEdges, err = ctrl.restrictEdges(ctx, restriction, filter, vectorEdges); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	edges := fuseRRF(
+		[][]*client.Search_Search_Edges{textResult.GetSearch().GetEdges(), vectorEdges},
+		[]float64{1 - ctrl.hybridWeight, ctrl.hybridWeight},
+	)
+
+	offset := min(int(first), len(edges))
+	end := min(offset+int(pageSize), len(edges))
+	result := &client.Search{}
+	result.Search.Edges = edges[offset:end]
+	result.Search.Facets = textResult.GetSearch().GetFacets()
+	result.Search.TotalCount = int64(len(edges))
+	result.Search.PageInfo = &client.PageInfoFragment{
+		HasNextPage:     end < len(edges),
+		HasPreviousPage: offset > 0,
+		CurrentCursor:   hybridCursor(offset),
+		StartCursor:     hybridCursor(max(0, offset-int(pageSize))),
+		EndCursor:       hybridCursor(end),
+	}
+	return result, nil
+}
+
+// restrictEdges removes the hits, which do not match the fulltext query restriction.
+// A required clause in the vector search would add its score to the similarity
+func (ctrl *Controller) restrictEdges(ctx context.Context, restriction string, filter []*client.InFilter, edges []*client.Search_Search_Edges) ([]*client.Search_Search_Edges, error) {
+	if len(edges) == 0 {
+		return edges, nil
+	}
+	signatures := []string{}
+	for _, edge := range edges {
+		signatures = append(signatures, edge.GetBase().GetSignature())
+	}
+	filter = append(slices.Clone(filter), &client.InFilter{
+		BoolTerm: &client.InFilterBoolTerm{Field: signatureField, Values: signatures},
+	})
+	size := int64(len(signatures))
+	result, err := ctrl.client.Search(ctx, restriction, nil, filter, nil, nil, &size, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot restrict hits to '%s'", restriction)
+	}
+	matching := map[string]bool{}
+	for _, edge := range result.GetSearch().GetEdges() {
+		matching[edge.GetBase().GetSignature()] = true
+	}
+	return slices.DeleteFunc(slices.Clone(edges), func(edge *client.Search_Search_Edges) bool {
+		return !matching[edge.GetBase().GetSignature()]
+	}), nil
+}
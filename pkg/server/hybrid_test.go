@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+func edges(signatures ...string) []*client.Search_Search_Edges {
+	result := []*client.Search_Search_Edges{}
+	for _, s := range signatures {
+		result = append(result, &client.Search_Search_Edges{Base: &client.MediathekBaseFragment{Signature: s}})
+	}
+	return result
+}
+
+func TestFuseRRF(t *testing.T) {
+	text := edges("a", "b", "c")
+	vector := edges("c", "d", "a")
+	for _, tc := range []struct {
+		weight float64
+		want   []string
+	}{
+		{0.5, []string{"a", "c", "b", "d"}},
+		{0, []string{"a", "b", "c", "d"}},
+		{1, []string{"c", "d", "a", "b"}},
+	} {
+		result := fuseRRF([][]*client.Search_Search_Edges{text, vector}, []float64{1 - tc.weight, tc.weight})
+		if len(result) != len(tc.want) {
+			t.Fatalf("weight %v: got %d entries, want %d", tc.weight, len(result), len(tc.want))
+		}
+		for i, e := range result {
+			if e.GetBase().GetSignature() != tc.want[i] {
+				t.Errorf("weight %v: position %d is '%s', want '%s'", tc.weight, i, e.GetBase().GetSignature(), tc.want[i])
+			}
+		}
+	}
+}
+
+// testEmbeddings returns the same embedding for all inputs
+type testEmbeddings struct{}
+
+func (testEmbeddings) CreateEmbedding(ctx context.Context, input string) ([]float64, error) {
+	return []float64{1, 0}, nil
+}
+
+func TestHybridSearchExclusions(t *testing.T) {
+	facets, err := initFacets(append(DefaultFacets(nil, nil),
+		&FacetConfig{Name: "type", Type: facetTypeTerm, Field: "type.keyword"},
+		&FacetConfig{Name: "signature", Type: facetTypeTerm, Field: "signature.keyword"},
+	), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := newCollectionRegistry([]*CollFacetType{
+		{Id: 1, Title: "ACT", Identifier: `cat:"zotero2!!ACT"`},
+		{Id: 2, Title: "Tanz", Identifier: `query:tanz`},
+	}, facets[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortOptions, err := initSortOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(query string) (*testClient, *searchResult) {
+		tc := &testClient{search: func(req *testSearch) (*client.Search, error) {
+			result := &client.Search{}
+			switch {
+			case len(req.Vector) > 0:
+				result.Search.Edges = edges("v1", "v2", "v3")
+			case req.Query == "tanz":
+				// the restriction search gets the signatures of the vector hits
+				if f := req.Filter[len(req.Filter)-1].BoolTerm; f.Field == signatureField && len(f.Values) == 3 {
+					result.Search.Edges = edges("v2")
+				}
+			default:
+				result.Search.Edges = edges("t1")
+			}
+			return result, nil
+		}}
+		ctrl := &Controller{client: tc, embeddings: testEmbeddings{}, hybridWindow: 10, facets: facets, sortOptions: sortOptions, collectionRegistry: reg}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/grid/de?"+query, nil)
+		sr, err := ctrl.search(c, newSearchParams(c.Request.URL.Query()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tc, sr
+	}
+
+	tc, sr := search(url.Values{"search": {"performance"}, "ki": {"true"}, "vocabulary": {"-voc:1"}, "facet_signature": {"-zotero2-1.1"}}.Encode())
+	// without selection, collections of different kinds do not restrict the search
+	if sr.QueryError != "" || len(tc.searches) != 2 {
+		t.Fatalf("%d searches: %s", len(tc.searches), sr.QueryError)
+	}
+	// the vector search gets the exclusions of the fulltext search without its terms
+	text, vector := tc.searches[0], tc.searches[1]
+	if want := `+-"voc:1" +-"zotero2-1.1"`; vector.Query != want || len(vector.Vector) == 0 {
+		t.Errorf("vector query is '%s', want '%s'", vector.Query, want)
+	}
+	if want := `(performance) ` + vector.Query; text.Query != want {
+		t.Errorf("fulltext query is '%s', want '%s'", text.Query, want)
+	}
+
+	// the values of other term facets may occur in free text
+	if tc, sr = search(url.Values{"search": {"performance"}, "facet_type": {"-video"}}.Encode()); sr.QueryError == "" || len(tc.searches) != 0 {
+		t.Errorf("exclusion of type values must be rejected")
+	}
+	// the required clauses of a query collection would change the ranking of the vector search,
+	// its hits are restricted by a third search
+	tc, sr = search(url.Values{"search": {"performance"}, "ki": {"true"}, "collections": {"2"}}.Encode())
+	if sr.QueryError != "" || len(tc.searches) != 3 {
+		t.Fatalf("%d searches: %s", len(tc.searches), sr.QueryError)
+	}
+	if text, vector, restriction := tc.searches[0], tc.searches[1], tc.searches[2]; text.Query != "(performance) + (tanz)" || vector.Query != "" || restriction.Query != "tanz" {
+		t.Errorf("invalid queries '%s', '%s' and '%s'", text.Query, vector.Query, restriction.Query)
+	}
+	for i, want := range []string{"t1", "v2"} {
+		if e := sr.Result.GetSearch().GetEdges(); len(e) != 2 || e[i].GetBase().GetSignature() != want {
+			t.Errorf("vector hits outside of the collection must be removed: %v", e)
+		}
+	}
+	if tc, sr = search(url.Values{"search": {"performance"}, "collections": {"2"}}.Encode()); sr.QueryError != "" || len(tc.searches) != 1 {
+		t.Errorf("search in query collection failed: %s", sr.QueryError)
+	}
+}
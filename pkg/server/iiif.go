@@ -0,0 +1,396 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+const iiifPresentationContext = "http://iiif.io/api/presentation/3/context.json"
+
+// iiifImageSize is the largest size of the images on the canvases
+const iiifImageSize int64 = 2000
+
+const iiifThumbnailParam = "size240x240/formatJPEG/autorotate"
+
+// iiifUnknownDuration is the duration of audio and video canvases without duration in the metadata.
+// The presentation api requires a duration for timed canvases, the viewers play the media until its real end
+const iiifUnknownDuration = 3600.0
+
+// iiifMetadataExtra are the fields of Extra, which are shown on the detail page, with their i18n keys
+var iiifMetadataExtra = []struct{ Key, Label string }{
+	{Key: "festival", Label: "event"},
+	{Key: "eventcurator", Label: "eventcurator"},
+	{Key: "doctype", Label: "doctype"},
+	{Key: "medium", Label: "medium"},
+	{Key: "dauer", Label: "duration"},
+}
+
+// iiifLangMap is a language map of the presentation api, values without language use the key "none"
+type iiifLangMap map[string][]string
+
+func iiifNone(values ...string) iiifLangMap {
+	return iiifLangMap{"none": values}
+}
+
+// newIIIFLangMap creates a language map from the multilingual fields of revcat
+func newIIIFLangMap(mf []*client.MultiLangFragment) iiifLangMap {
+	m := iiifLangMap{}
+	for _, f := range mf {
+		if f.GetValue() == "" {
+			continue
+		}
+		lang := f.GetLang()
+		if lang == "" {
+			lang = "none"
+		}
+		m[lang] = append(m[lang], f.GetValue())
+	}
+	return m
+}
+
+// iiifResource is a content resource, a thumbnail or an external link
+type iiifResource struct {
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Format   string         `json:"format,omitempty"`
+	Label    iiifLangMap    `json:"label,omitempty"`
+	Profile  string         `json:"profile,omitempty"`
+	Width    int64          `json:"width,omitempty"`
+	Height   int64          `json:"height,omitempty"`
+	Duration float64        `json:"duration,omitempty"`
+	Service  []*iiifService `json:"service,omitempty"`
+}
+
+// iiifService is a service of a content resource like the image api
+type iiifService struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Profile string `json:"profile"`
+}
+
+type iiifMetadata struct {
+	Label iiifLangMap `json:"label"`
+	Value iiifLangMap `json:"value"`
+}
+
+type iiifAnnotation struct {
+	ID         string        `json:"id"`
+	Type       string        `json:"type"`
+	Motivation string        `json:"motivation"`
+	Body       *iiifResource `json:"body"`
+	Target     string        `json:"target"`
+}
+
+type iiifAnnotationPage struct {
+	ID    string            `json:"id"`
+	Type  string            `json:"type"`
+	Items []*iiifAnnotation `json:"items"`
+}
+
+type iiifCanvas struct {
+	ID        string                `json:"id"`
+	Type      string                `json:"type"`
+	Label     iiifLangMap           `json:"label,omitempty"`
+	Width     int64                 `json:"width,omitempty"`
+	Height    int64                 `json:"height,omitempty"`
+	Duration  float64               `json:"duration,omitempty"`
+	Thumbnail []*iiifResource       `json:"thumbnail,omitempty"`
+	Items     []*iiifAnnotationPage `json:"items"`
+}
+
+type iiifManifest struct {
+	Context           string          `json:"@context"`
+	ID                string          `json:"id"`
+	Type              string          `json:"type"`
+	Label             iiifLangMap     `json:"label"`
+	Summary           iiifLangMap     `json:"summary,omitempty"`
+	Metadata          []*iiifMetadata `json:"metadata,omitempty"`
+	RequiredStatement *iiifMetadata   `json:"requiredStatement,omitempty"`
+	Rights            string          `json:"rights,omitempty"`
+	Thumbnail         []*iiifResource `json:"thumbnail,omitempty"`
+	Homepage          []*iiifResource `json:"homepage,omitempty"`
+	SeeAlso           []*iiifResource `json:"seeAlso,omitempty"`
+	Rendering         []*iiifResource `json:"rendering,omitempty"`
+	Items             []*iiifCanvas   `json:"items"`
+}
+
+// addCanvas paints body on a new canvas with the size and duration of body
+func (m *iiifManifest) addCanvas(label string, body *iiifResource, thumbnail *iiifResource) {
+	id := fmt.Sprintf("%s/canvas/%d", strings.TrimSuffix(m.ID, "/manifest.json"), len(m.Items)+1)
+	canvas := &iiifCanvas{
+		ID:       id,
+		Type:     "Canvas",
+		Width:    body.Width,
+		Height:   body.Height,
+		Duration: body.Duration,
+		Items: []*iiifAnnotationPage{{
+			ID:   id + "/page",
+			Type: "AnnotationPage",
+			Items: []*iiifAnnotation{{
+				ID:         id + "/annotation",
+				Type:       "Annotation",
+				Motivation: "painting",
+				Body:       body,
+				Target:     id,
+			}},
+		}},
+	}
+	if label != "" {
+		canvas.Label = iiifNone(label)
+	}
+	if thumbnail != nil {
+		canvas.Thumbnail = []*iiifResource{thumbnail}
+	}
+	m.Items = append(m.Items, canvas)
+}
+
+var durationRegexp = regexp.MustCompile(`^(?:(\d+):)?(\d+):(\d+)$`)
+var durationUnitRegexp = regexp.MustCompile(`(\d+)\s*(h|std|min|m|'|s|sec|sek|")`)
+
+// parseDuration parses free form durations like "1:02:03", "12:30", "12 min" or "5'30\"" to seconds
+func parseDuration(str string) (float64, bool) {
+	str = strings.ToLower(strings.TrimSpace(str))
+	if matches := durationRegexp.FindStringSubmatch(str); matches != nil {
+		h, _ := strconv.Atoi(matches[1])
+		m, _ := strconv.Atoi(matches[2])
+		s, _ := strconv.Atoi(matches[3])
+		seconds := float64(h*3600 + m*60 + s)
+		return seconds, seconds > 0
+	}
+	var seconds float64
+	for _, matches := range durationUnitRegexp.FindAllStringSubmatch(str, -1) {
+		n, _ := strconv.Atoi(matches[1])
+		switch matches[2] {
+		case "h", "std":
+			seconds += float64(n * 3600)
+		case "min", "m", "'":
+			seconds += float64(n * 60)
+		default:
+			seconds += float64(n)
+		}
+	}
+	return seconds, seconds > 0
+}
+
+// imageSize returns the size of the image after autorotate, which fits into the iiif image size
+func imageSize(item *client.MediaItemFragment) (int64, int64) {
+	width, height := item.GetWidth(), item.GetHeight()
+	// exif orientations 5 to 8 are rotated by 90 degrees
+	if item.GetOrientation() >= 5 {
+		width, height = height, width
+	}
+	if width <= iiifImageSize && height <= iiifImageSize {
+		return width, height
+	}
+	s := CalcAspectSize(width, height, iiifImageSize, iiifImageSize)
+	return s.Width, s.Height
+}
+
+// iiifLabel localizes the i18n key in all languages
+func (ctrl *Controller) iiifLabel(key string) iiifLangMap {
+	m := iiifLangMap{}
+	for _, tag := range ctrl.bundle.LanguageTags() {
+		m[tag.String()] = []string{ctrl.localize(key, tag.String())}
+	}
+	return m
+}
+
+// iiifMetadata creates the metadata rows of the detail page, the labels are localized in all languages
+func (ctrl *Controller) iiifMetadata(me *client.MediathekEntries_MediathekEntries) []*iiifMetadata {
+	metadata := []*iiifMetadata{}
+	add := func(key string, values ...string) {
+		nonEmpty := []string{}
+		for _, v := range values {
+			if v != "" {
+				nonEmpty = append(nonEmpty, v)
+			}
+		}
+		if len(nonEmpty) > 0 {
+			metadata = append(metadata, &iiifMetadata{Label: ctrl.iiifLabel(key), Value: iiifNone(nonEmpty...)})
+		}
+	}
+	base := me.GetBase()
+	add("signature", base.GetSignature())
+	add("collection", emptyIfNil(base.GetCollectionTitle()))
+	add("date", emptyIfNil(base.GetDate()))
+	add("place", emptyIfNil(base.GetPlace()))
+	// persons are grouped by role in the order of their first appearance
+	roles := []string{}
+	persons := map[string][]string{}
+	for _, p := range base.GetPerson() {
+		role := "author"
+		if p.GetRole() != nil && *p.GetRole() != "" {
+			role = strings.TrimPrefix(*p.GetRole(), "performer:")
+		}
+		if _, ok := persons[role]; !ok {
+			roles = append(roles, role)
+		}
+		persons[role] = append(persons[role], p.GetName())
+	}
+	for _, role := range roles {
+		add(role, persons[role]...)
+	}
+	for _, extra := range iiifMetadataExtra {
+		for _, kv := range me.GetExtra() {
+			if kv.GetKey() == extra.Key {
+				add(extra.Label, kv.GetValue())
+			}
+		}
+	}
+	add("publisher", emptyIfNil(base.GetPublisher()))
+	if len(base.GetTags()) > 0 {
+		tags := iiifLangMap{}
+		for _, tag := range ctrl.bundle.LanguageTags() {
+			lang := tag.String()
+			for _, t := range base.GetTags() {
+				if parts := strings.Split(strings.TrimPrefix(t, "voc:"), ":"); strings.HasPrefix(t, "voc:") && len(parts) == 2 {
+					tags[lang] = append(tags[lang], fmt.Sprintf("%s - %s", ctrl.localize(parts[0], lang), ctrl.localize(parts[1], lang)))
+				}
+			}
+		}
+		if len(tags) > 0 {
+			metadata = append(metadata, &iiifMetadata{Label: iiifNone("Tags"), Value: tags})
+		}
+	}
+	return metadata
+}
+
+// newIIIFManifest creates the presentation api 3 manifest of an entry.
+// Images and the posters of pdfs are painted on canvases, audio and video on timed canvases and pdfs are renderings
+func (ctrl *Controller) newIIIFManifest(me *client.MediathekEntries_MediathekEntries, lang string) *iiifManifest {
+	base := me.GetBase()
+	manifestBase := fmt.Sprintf("%s/iiif/%s", ctrl.externalAddr, url.PathEscape(base.GetSignature()))
+	m := &iiifManifest{
+		Context:  iiifPresentationContext,
+		ID:       manifestBase + "/manifest.json",
+		Type:     "Manifest",
+		Label:    newIIIFLangMap(base.GetTitle()),
+		Summary:  newIIIFLangMap(me.GetAbstract()),
+		Metadata: ctrl.iiifMetadata(me),
+		Homepage: []*iiifResource{{
+			ID:     ctrl.detailLink(base.GetSignature(), lang),
+			Type:   "Text",
+			Format: "text/html",
+			Label:  newIIIFLangMap(base.GetTitle()),
+		}},
+		SeeAlso: []*iiifResource{{
+			ID:      ctrl.detailLink(base.GetSignature(), lang),
+			Type:    "Dataset",
+			Format:  detailFormatJSONLD,
+			Profile: "https://schema.org/",
+		}},
+		Items: []*iiifCanvas{},
+	}
+	if len(m.Label) == 0 {
+		m.Label = iiifNone(base.GetSignature())
+	}
+	if rights := emptyIfNil(base.GetRights()); rights != "" {
+		m.RequiredStatement = &iiifMetadata{Label: ctrl.iiifLabel("rights"), Value: iiifNone(rights)}
+	}
+	if license := emptyIfNil(base.GetLicense()); strings.Contains(license, "creativecommons.org/") || strings.Contains(license, "rightsstatements.org/") {
+		m.Rights = strings.Replace(license, "https://", "http://", 1)
+	}
+	if !base.GetMediaVisible() {
+		return m
+	}
+	token := base.GetMediaVisible() && base.GetMediaProtected()
+	if poster := base.GetPoster(); poster != nil {
+		m.Thumbnail = []*iiifResource{{ID: ctrl.mediaLink(poster.GetURI(), "resize", iiifThumbnailParam, token), Type: "Image", Format: "image/jpeg"}}
+	}
+	var duration float64
+	for _, kv := range me.GetExtra() {
+		if kv.GetKey() == "dauer" {
+			duration, _ = parseDuration(kv.GetValue())
+		}
+	}
+	if duration == 0 {
+		duration = iiifUnknownDuration
+	}
+	for _, media := range me.GetMedia() {
+		for _, item := range media.GetItems() {
+			switch media.GetType() {
+			case "image":
+				width, height := imageSize(item)
+				m.addCanvas(item.GetName(), &iiifResource{
+					ID:      ctrl.mediaLink(item.GetURI(), "resize", fmt.Sprintf("size%dx%d/formatJPEG/autorotate", iiifImageSize, iiifImageSize), token),
+					Type:    "Image",
+					Format:  "image/jpeg",
+					Width:   width,
+					Height:  height,
+					Service: ctrl.iiifImageService(base.GetSignature(), item.GetURI()),
+				}, &iiifResource{ID: ctrl.mediaLink(item.GetURI(), "resize", iiifThumbnailParam, token), Type: "Image", Format: "image/jpeg"})
+			case "video":
+				m.addCanvas(item.GetName(), &iiifResource{
+					ID:       ctrl.mediaLink(item.GetURI()+"$$web", "master", "", token),
+					Type:     "Video",
+					Format:   "video/mp4",
+					Width:    item.GetWidth(),
+					Height:   item.GetHeight(),
+					Duration: duration,
+				}, &iiifResource{ID: ctrl.mediaLink(item.GetURI()+"$$timeshot$$3", "resize", iiifThumbnailParam, token), Type: "Image", Format: "image/jpeg"})
+			case "audio":
+				m.addCanvas(item.GetName(), &iiifResource{
+					ID:       ctrl.mediaLink(item.GetURI(), "master", "", token),
+					Type:     "Sound",
+					Format:   item.GetMimetype(),
+					Duration: duration,
+				}, nil)
+			case "pdf":
+				m.Rendering = append(m.Rendering, &iiifResource{
+					ID:     ctrl.mediaLink(item.GetURI(), "master", "", token),
+					Type:   "Text",
+					Format: "application/pdf",
+					Label:  iiifNone(item.GetName()),
+				})
+			}
+		}
+	}
+	// viewers need a canvas, entries with pdfs only show their poster
+	if poster := base.GetPoster(); len(m.Items) == 0 && poster != nil {
+		width, height := imageSize(poster)
+		m.addCanvas("", &iiifResource{
+			ID:      ctrl.mediaLink(poster.GetURI(), "resize", fmt.Sprintf("size%dx%d/formatJPEG/autorotate", iiifImageSize, iiifImageSize), token),
+			Type:    "Image",
+			Format:  "image/jpeg",
+			Width:   width,
+			Height:  height,
+			Service: ctrl.iiifImageService(base.GetSignature(), poster.GetURI()),
+		}, nil)
+	}
+	return m
+}
+
+// iiifManifest returns the iiif presentation api 3 manifest of an entry
+func (ctrl *Controller) iiifManifest(c *gin.Context) {
+	lang := c.Query("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	id := c.Param("signature")
+	source, err := ctrl.client.MediathekEntries(c, []string{id})
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot get source '%s'", id)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get source '%s': %v", id, err))
+		return
+	}
+	if source == nil || len(source.MediathekEntries) == 0 {
+		ctrl.logger.Error().Msgf("source '%s' not found", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' not found", id))
+		return
+	}
+	manifest := ctrl.newIIIFManifest(source.MediathekEntries[0], lang)
+	if len(manifest.Items) == 0 {
+		ctrl.logger.Error().Msgf("source '%s' has no visible media", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("source '%s' has no visible media", id))
+		return
+	}
+	c.Header("Content-Type", fmt.Sprintf("application/ld+json;profile=\"%s\"", iiifPresentationContext))
+	c.JSON(http.StatusOK, manifest)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+func TestParseDuration(t *testing.T) {
+	for str, want := range map[string]float64{
+		"1:02:03":     3723,
+		"12:30":       750,
+		"ca. 20 Min.": 1200,
+		"5'30\"":      330,
+		"1h 5min":     3900,
+	} {
+		if d, ok := parseDuration(str); !ok || d != want {
+			t.Errorf("%s: %v (%v), expected %v", str, d, ok, want)
+		}
+	}
+	if _, ok := parseDuration("unbekannt"); ok {
+		t.Error("unknown duration must fail")
+	}
+}
+
+func TestNewIIIFManifest(t *testing.T) {
+	ctrl := &Controller{
+		externalAddr:    "https://ext.example",
+		detailAddr:      "https://detail.example",
+		mediaserverBase: "https://media.example",
+		bundle:          i18n.NewBundle(language.German),
+	}
+	date := "1995"
+	role := "camera"
+	me := &client.MediathekEntries_MediathekEntries{
+		Base: &client.MediathekBaseFragment{
+			Signature:    "zotero2-1.SIG",
+			Title:        []*client.MultiLangFragment{{Lang: "de", Value: "Titel"}, {Lang: "en", Value: "Title", Translated: true}},
+			Date:         &date,
+			Person:       []*client.PersonFragment{{Name: "Doe, John"}, {Name: "Studio X", Role: &role}},
+			MediaVisible: true,
+		},
+		Extra: []*client.KeyValueFragment{{Key: "dauer", Value: "12:30"}},
+		Media: []*client.MediaListFragment{
+			{Type: "image", Items: []*client.MediaItemFragment{{Name: "img", URI: "mediaserver:coll/img", Width: 4000, Height: 3000, Orientation: 6}}},
+			{Type: "video", Items: []*client.MediaItemFragment{{Name: "vid", URI: "mediaserver:coll/vid", Width: 1920, Height: 1080}}},
+			{Type: "pdf", Items: []*client.MediaItemFragment{{Name: "doc", URI: "mediaserver:coll/doc"}}},
+		},
+	}
+	m := ctrl.newIIIFManifest(me, "de")
+	if m.ID != "https://ext.example/iiif/zotero2-1.SIG/manifest.json" || m.Label["en"][0] != "Title" {
+		t.Errorf("invalid manifest %s %v", m.ID, m.Label)
+	}
+	if len(m.Items) != 2 || len(m.Rendering) != 1 {
+		t.Fatalf("%d canvases and %d renderings", len(m.Items), len(m.Rendering))
+	}
+	image := m.Items[0]
+	if image.Width != 1500 || image.Height != 2000 || image.Duration != 0 {
+		t.Errorf("image canvas %dx%d", image.Width, image.Height)
+	}
+	body := image.Items[0].Items[0].Body
+	if body.ID != "https://media.example/coll/img/resize/size2000x2000/formatJPEG/autorotate" || image.Items[0].Items[0].Target != image.ID {
+		t.Errorf("invalid image body %s", body.ID)
+	}
+	if len(body.Service) != 1 || body.Service[0].ID != "https://ext.example/iiif/image/zotero2-1.SIG~img" {
+		t.Errorf("invalid image service %+v", body.Service)
+	}
+	if video := m.Items[1]; video.Duration != 750 || video.Items[0].Items[0].Body.Type != "Video" || !strings.HasSuffix(video.ID, "/canvas/2") {
+		t.Errorf("invalid video canvas %+v", video)
+	}
+	rows := map[string]string{}
+	for _, md := range m.Metadata {
+		rows[md.Label["de"][0]] = strings.Join(md.Value["none"], "; ")
+	}
+	if rows["date"] != "1995" || rows["author"] != "Doe, John" || rows["camera"] != "Studio X" || rows["duration"] != "12:30" {
+		t.Errorf("invalid metadata %v", rows)
+	}
+
+	me.Base.MediaVisible = false
+	if m := ctrl.newIIIFManifest(me, "de"); len(m.Items) != 0 || len(m.Rendering) != 0 {
+		t.Error("invisible media must not be in the manifest")
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+const (
+	iiifImageContext  = "http://iiif.io/api/image/3/context.json"
+	iiifImageProtocol = "http://iiif.io/api/image"
+	iiifImageProfile  = "level0"
+)
+
+// iiifImageFeatures are the features beyond level 0, which can be translated into mediaserver resize parameters
+var iiifImageFeatures = []string{"regionSquare", "sizeByW", "sizeByH", "sizeByPct", "sizeByConfinedWh"}
+
+// iiifImageFormats maps the formats of the image api to the mediaserver formats
+var iiifImageFormats = map[string]string{
+	"jpg": "JPEG",
+	"png": "PNG",
+}
+
+// iiifImageMinSize is the smallest size in the sizes of info.json
+const iiifImageMinSize = 128
+
+// iiifImageIDSeparator separates the signature of the entry from the mediaserver signature of the image
+const iiifImageIDSeparator = "~"
+
+// IIIFError is an image api request, which is invalid or cannot be translated into a mediaserver request
+type IIIFError struct {
+	Status int
+	Msg    string
+}
+
+func (e *IIIFError) Error() string {
+	return e.Msg
+}
+
+func iiifBadRequest(format string, args ...any) error {
+	return &IIIFError{Status: http.StatusBadRequest, Msg: fmt.Sprintf(format, args...)}
+}
+
+func iiifNotImplemented(format string, args ...any) error {
+	return &IIIFError{Status: http.StatusNotImplemented, Msg: fmt.Sprintf(format, args...)}
+}
+
+// iiifImageID returns the image api identifier of the image with the mediaserver uri in the entry with signature
+func iiifImageID(signature, uri string) (string, bool) {
+	matches := mediaMatch.FindStringSubmatch(uri)
+	if matches == nil {
+		return "", false
+	}
+	return signature + iiifImageIDSeparator + matches[2], true
+}
+
+// iiifImageService is the image api service of the image with the mediaserver uri in the entry with signature
+func (ctrl *Controller) iiifImageService(signature, uri string) []*iiifService {
+	id, ok := iiifImageID(signature, uri)
+	if !ok {
+		return nil
+	}
+	return []*iiifService{{ID: ctrl.iiifImageBase(id), Type: "ImageService3", Profile: iiifImageProfile}}
+}
+
+func (ctrl *Controller) iiifImageBase(id string) string {
+	return fmt.Sprintf("%s/iiif/image/%s", ctrl.externalAddr, url.PathEscape(id))
+}
+
+// iiifImageRequest is a parsed image request, the region is the full image or the centered square
+type iiifImageRequest struct {
+	Square bool
+	Width  int64
+	Height int64
+	Format string
+}
+
+// param returns the mediaserver resize parameters of the request
+func (req *iiifImageRequest) param() string {
+	params := []string{fmt.Sprintf("size%dx%d", req.Width, req.Height), "format" + iiifImageFormats[req.Format], "autorotate"}
+	if req.Square {
+		params = append(params, "crop")
+	}
+	return strings.Join(params, "/")
+}
+
+// parseIIIFImageRequest parses region, size, rotation and quality.format of an image of width x height.
+// Only the transformations of the mediaserver are supported: full or square regions, scaling without distortion and no rotation
+func parseIIIFImageRequest(width, height int64, region, size, rotation, file string) (*iiifImageRequest, error) {
+	req := &iiifImageRequest{}
+	rw, rh := width, height
+	switch region {
+	case "full":
+	case "square":
+		req.Square = true
+		rw = min(width, height)
+		rh = rw
+	default:
+		return nil, iiifNotImplemented("region '%s' not supported", region)
+	}
+
+	upscale := strings.HasPrefix(size, "^")
+	sizeStr := strings.TrimPrefix(size, "^")
+	scaled := func(v int64, f float64) int64 {
+		return max(1, int64(math.Round(float64(v)*f)))
+	}
+	switch {
+	case sizeStr == "max":
+		req.Width, req.Height = rw, rh
+	case strings.HasPrefix(sizeStr, "pct:"):
+		pct, err := strconv.ParseFloat(strings.TrimPrefix(sizeStr, "pct:"), 64)
+		if err != nil || pct <= 0 {
+			return nil, iiifBadRequest("invalid size '%s'", size)
+		}
+		req.Width, req.Height = scaled(rw, pct/100), scaled(rh, pct/100)
+	default:
+		confined := strings.HasPrefix(sizeStr, "!")
+		wStr, hStr, ok := strings.Cut(strings.TrimPrefix(sizeStr, "!"), ",")
+		if !ok || (wStr == "" && hStr == "") || (confined && (wStr == "" || hStr == "")) {
+			return nil, iiifBadRequest("invalid size '%s'", size)
+		}
+		var w, h int64
+		var err error
+		if wStr != "" {
+			if w, err = strconv.ParseInt(wStr, 10, 64); err != nil || w <= 0 {
+				return nil, iiifBadRequest("invalid width in size '%s'", size)
+			}
+		}
+		if hStr != "" {
+			if h, err = strconv.ParseInt(hStr, 10, 64); err != nil || h <= 0 {
+				return nil, iiifBadRequest("invalid height in size '%s'", size)
+			}
+		}
+		switch {
+		case h == 0:
+			req.Width, req.Height = w, scaled(rh, float64(w)/float64(rw))
+		case w == 0:
+			req.Width, req.Height = scaled(rw, float64(h)/float64(rh)), h
+		default:
+			s := CalcAspectSize(rw, rh, w, h)
+			req.Width, req.Height = max(1, s.Width), max(1, s.Height)
+			// the mediaserver keeps the aspect ratio, rounding differences are accepted
+			if !confined && (req.Width < w-1 || req.Height < h-1) {
+				return nil, iiifNotImplemented("distorted size '%s' not supported", size)
+			}
+		}
+	}
+	if req.Width > rw || req.Height > rh {
+		if upscale {
+			return nil, iiifNotImplemented("upscaling not supported")
+		}
+		return nil, iiifBadRequest("size '%s' is larger than the region", size)
+	}
+
+	switch rotation {
+	case "0":
+	case "!0":
+		return nil, iiifNotImplemented("mirroring not supported")
+	default:
+		if _, err := strconv.ParseFloat(strings.TrimPrefix(rotation, "!"), 64); err != nil {
+			return nil, iiifBadRequest("invalid rotation '%s'", rotation)
+		}
+		return nil, iiifNotImplemented("rotation '%s' not supported", rotation)
+	}
+
+	quality, format, ok := strings.Cut(file, ".")
+	if !ok {
+		return nil, iiifBadRequest("invalid quality and format '%s'", file)
+	}
+	switch quality {
+	case "default", "color":
+	case "gray", "bitonal":
+		return nil, iiifNotImplemented("quality '%s' not supported", quality)
+	default:
+		return nil, iiifBadRequest("invalid quality '%s'", quality)
+	}
+	if _, ok := iiifImageFormats[format]; !ok {
+		return nil, iiifNotImplemented("format '%s' not supported", format)
+	}
+	req.Format = format
+	return req, nil
+}
+
+// iiifImageSizes are the sizes of info.json, which halve the image down to the minimal size
+func iiifImageSizes(width, height int64) []*size {
+	sizes := []*size{}
+	for w, h := width, height; ; w, h = w/2, h/2 {
+		sizes = append([]*size{{Width: w, Height: h}}, sizes...)
+		if w/2 < iiifImageMinSize && h/2 < iiifImageMinSize {
+			break
+		}
+	}
+	return sizes
+}
+
+// iiifImageItem resolves the identifier to the image of the entry. The entry is loaded with the groups of the caller,
+// revcat only marks the media as visible, if the content acl contains one of the groups
+func (ctrl *Controller) iiifImageItem(c *gin.Context, id string) (*client.MediaItemFragment, bool, error) {
+	signature, mediaSignature, ok := strings.Cut(id, iiifImageIDSeparator)
+	if !ok || signature == "" || mediaSignature == "" {
+		return nil, false, iiifBadRequest("invalid identifier '%s'", id)
+	}
+	source, err := ctrl.client.MediathekEntries(c, []string{signature})
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "cannot get source '%s'", signature)
+	}
+	if source == nil || len(source.MediathekEntries) == 0 {
+		return nil, false, &IIIFError{Status: http.StatusNotFound, Msg: fmt.Sprintf("source '%s' not found", signature)}
+	}
+	base := source.MediathekEntries[0].GetBase()
+	if !base.GetMediaVisible() {
+		return nil, false, &IIIFError{Status: http.StatusForbidden, Msg: fmt.Sprintf("no access to the media of '%s'", signature)}
+	}
+	items := []*client.MediaItemFragment{base.GetPoster()}
+	for _, media := range source.MediathekEntries[0].GetMedia() {
+		if media.GetType() == "image" {
+			items = append(items, media.GetItems()...)
+		}
+	}
+	for _, item := range items {
+		if itemID, ok := iiifImageID(signature, item.GetURI()); ok && itemID == id {
+			if item.GetWidth() <= 0 || item.GetHeight() <= 0 {
+				return nil, false, &IIIFError{Status: http.StatusNotFound, Msg: fmt.Sprintf("size of image '%s' unknown", id)}
+			}
+			return item, base.GetMediaProtected(), nil
+		}
+	}
+	return nil, false, &IIIFError{Status: http.StatusNotFound, Msg: fmt.Sprintf("image '%s' not found", id)}
+}
+
+// abortIIIF aborts with the status of an IIIFError or an internal server error
+func (ctrl *Controller) abortIIIF(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var iErr *IIIFError
+	if errors.As(err, &iErr) {
+		status = iErr.Status
+	}
+	ctrl.logger.Error().Err(err).Msgf("cannot process iiif request '%s'", c.Request.URL.Path)
+	c.AbortWithStatusJSON(status, fmt.Sprintf("cannot process iiif request '%s': %v", c.Request.URL.Path, err))
+}
+
+// iiifImageInfo returns the info.json of an image
+func (ctrl *Controller) iiifImageInfo(c *gin.Context) {
+	id := c.Param("id")
+	item, _, err := ctrl.iiifImageItem(c, id)
+	if err != nil {
+		ctrl.abortIIIF(c, err)
+		return
+	}
+	width, height := item.GetWidth(), item.GetHeight()
+	if item.GetOrientation() >= 5 {
+		width, height = height, width
+	}
+	contentType := "application/json"
+	if c.NegotiateFormat(contentType, "application/ld+json") == "application/ld+json" {
+		contentType = fmt.Sprintf("application/ld+json;profile=\"%s\"", iiifImageContext)
+	}
+	c.Header("Content-Type", contentType)
+	c.JSON(http.StatusOK, map[string]any{
+		"@context":         iiifImageContext,
+		"id":               ctrl.iiifImageBase(id),
+		"type":             "ImageService3",
+		"protocol":         iiifImageProtocol,
+		"profile":          iiifImageProfile,
+		"width":            width,
+		"height":           height,
+		"sizes":            iiifImageSizes(width, height),
+		"extraFeatures":    iiifImageFeatures,
+		"preferredFormats": []string{"jpg"},
+		"extraFormats":     []string{"png"},
+	})
+}
+
+// iiifImage redirects an image request to the mediaserver url with a token for protected media
+func (ctrl *Controller) iiifImage(c *gin.Context) {
+	id := c.Param("id")
+	item, protected, err := ctrl.iiifImageItem(c, id)
+	if err != nil {
+		ctrl.abortIIIF(c, err)
+		return
+	}
+	width, height := item.GetWidth(), item.GetHeight()
+	if item.GetOrientation() >= 5 {
+		width, height = height, width
+	}
+	req, err := parseIIIFImageRequest(width, height, c.Param("region"), c.Param("size"), c.Param("rotation"), c.Param("file"))
+	if err != nil {
+		ctrl.abortIIIF(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, ctrl.mediaLink(item.GetURI(), "resize", req.param(), protected))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseIIIFImageRequest(t *testing.T) {
+	for _, tc := range []struct {
+		region, size, rotation, file string
+		param                        string
+	}{
+		{"full", "max", "0", "default.jpg", "size4000x3000/formatJPEG/autorotate"},
+		{"full", "1000,", "0", "color.png", "size1000x750/formatPNG/autorotate"},
+		{"full", ",300", "0", "default.jpg", "size400x300/formatJPEG/autorotate"},
+		{"full", "pct:10", "0", "default.jpg", "size400x300/formatJPEG/autorotate"},
+		{"full", "!500,500", "0", "default.jpg", "size500x375/formatJPEG/autorotate"},
+		{"full", "800,600", "0", "default.jpg", "size800x600/formatJPEG/autorotate"},
+		{"square", "200,200", "0", "default.jpg", "size200x200/formatJPEG/autorotate/crop"},
+	} {
+		req, err := parseIIIFImageRequest(4000, 3000, tc.region, tc.size, tc.rotation, tc.file)
+		if err != nil {
+			t.Errorf("%s/%s: %v", tc.region, tc.size, err)
+			continue
+		}
+		if req.param() != tc.param {
+			t.Errorf("%s/%s: %s, expected %s", tc.region, tc.size, req.param(), tc.param)
+		}
+	}
+
+	for _, tc := range []struct {
+		region, size, rotation, file string
+		status                       int
+	}{
+		{"0,0,100,100", "max", "0", "default.jpg", http.StatusNotImplemented},
+		{"full", "800,800", "0", "default.jpg", http.StatusNotImplemented},
+		{"full", "5000,", "0", "default.jpg", http.StatusBadRequest},
+		{"full", "^5000,", "0", "default.jpg", http.StatusNotImplemented},
+		{"full", "abc", "0", "default.jpg", http.StatusBadRequest},
+		{"full", "max", "90", "default.jpg", http.StatusNotImplemented},
+		{"full", "max", "!0", "default.jpg", http.StatusNotImplemented},
+		{"full", "max", "x", "default.jpg", http.StatusBadRequest},
+		{"full", "max", "0", "gray.jpg", http.StatusNotImplemented},
+		{"full", "max", "0", "default.tif", http.StatusNotImplemented},
+		{"full", "max", "0", "default", http.StatusBadRequest},
+	} {
+		_, err := parseIIIFImageRequest(4000, 3000, tc.region, tc.size, tc.rotation, tc.file)
+		var iErr *IIIFError
+		if !errors.As(err, &iErr) || iErr.Status != tc.status {
+			t.Errorf("%s/%s/%s/%s: %v, expected status %d", tc.region, tc.size, tc.rotation, tc.file, err, tc.status)
+		}
+	}
+}
+
+func TestIIIFImageSizes(t *testing.T) {
+	sizes := iiifImageSizes(2000, 1000)
+	if len(sizes) != 4 || sizes[0].Width != 250 || sizes[0].Height != 125 || sizes[3].Width != 2000 {
+		for _, s := range sizes {
+			t.Logf("%dx%d", s.Width, s.Height)
+		}
+		t.Errorf("invalid sizes")
+	}
+	if sizes := iiifImageSizes(100, 80); len(sizes) != 1 {
+		t.Errorf("%d sizes for a small image", len(sizes))
+	}
+}
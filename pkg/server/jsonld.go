@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// jsonLDPosterParam is the mediaserver resize parameter of the image of the json-ld representation
+const jsonLDPosterParam = "size600x600/formatJPEG/autorotate"
+
+// schemaOrgTypes maps the item types of the catalogue to schema.org types, all others are CreativeWork
+var schemaOrgTypes = map[string]string{
+	"book":           "Book",
+	"bookSection":    "Chapter",
+	"journalArticle": "ScholarlyArticle",
+	"thesis":         "Thesis",
+	"report":         "Report",
+	"videoRecording": "VideoObject",
+	"audioRecording": "AudioObject",
+	"artwork":        "VisualArtwork",
+	"interview":      "CreativeWork",
+	"webpage":        "WebPage",
+}
+
+func schemaOrgNamed(schemaType, name string) map[string]any {
+	return map[string]any{"@type": schemaType, "name": name}
+}
+
+// schemaOrgItem creates the schema.org json-ld representation of rec, image is the url of the poster or empty
+func schemaOrgItem(rec *exportRecord, image, lang string) map[string]any {
+	schemaType, ok := schemaOrgTypes[rec.Type]
+	if !ok {
+		schemaType = "CreativeWork"
+	}
+	item := map[string]any{
+		"@context":   "https://schema.org",
+		"@type":      schemaType,
+		"@id":        rec.Link,
+		"url":        rec.Link,
+		"identifier": rec.Signature,
+		"inLanguage": lang,
+	}
+	set := func(name string, value any, ok bool) {
+		if ok {
+			item[name] = value
+		}
+	}
+	set("name", rec.Title, rec.Title != "")
+	set("description", rec.Abstract, rec.Abstract != "")
+	set("dateCreated", rec.Date, rec.Date != "")
+	set("image", image, image != "")
+	set("thumbnailUrl", image, image != "")
+	set("sameAs", rec.URL, rec.URL != "")
+	set("locationCreated", schemaOrgNamed("Place", rec.Place), rec.Place != "")
+	set("publisher", schemaOrgNamed("Organization", rec.Publisher), rec.Publisher != "")
+	set("isPartOf", schemaOrgNamed("Collection", rec.Collection), rec.Collection != "")
+	creators := []map[string]any{}
+	for _, p := range rec.creators() {
+		creators = append(creators, schemaOrgNamed("Person", p.Name))
+	}
+	set("creator", creators, len(creators) > 0)
+	contributors := []map[string]any{}
+	for _, p := range rec.contributors() {
+		contributor := schemaOrgNamed("Person", p.Name)
+		contributor["roleName"] = p.Role
+		contributors = append(contributors, contributor)
+	}
+	set("contributor", contributors, len(contributors) > 0)
+	editors := []map[string]any{}
+	for _, p := range rec.personsWithRole("editor") {
+		editors = append(editors, schemaOrgNamed("Person", p.Name))
+	}
+	set("editor", editors, len(editors) > 0)
+	return item
+}
+
+// detailJSONLD creates the schema.org representation of an entry.
+// The poster is only linked if the media is visible and not protected, the link has no token
+func (ctrl *Controller) detailJSONLD(me *client.MediathekEntries_MediathekEntries, lang string) map[string]any {
+	rec := ctrl.newExportRecord(me.GetBase(), me.GetAbstract(), lang)
+	var image string
+	if poster := me.GetBase().GetPoster(); poster != nil && me.GetBase().GetMediaVisible() && !me.GetBase().GetMediaProtected() {
+		image = ctrl.mediaLink(poster.GetURI(), "resize", jsonLDPosterParam, false)
+	}
+	return schemaOrgItem(rec, image, lang)
+}
+
+// metaDescriptionLength is the maximum number of characters of the description in the page head
+const metaDescriptionLength = 300
+
+// openGraphTypes maps the item types of the catalogue to open graph types, all others are articles
+var openGraphTypes = map[string]string{
+	"book":           "book",
+	"videoRecording": "video.other",
+	"audioRecording": "music.song",
+	"webpage":        "website",
+}
+
+// pageMeta is the machine readable metadata of a page for search engines and social media
+type pageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Type        string
+	Image       string
+	JSONLD      template.JS
+}
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// metaDescription removes the markup of text and shortens it on a word boundary
+func metaDescription(text string) string {
+	text = strings.Join(strings.Fields(htmlTagRegexp.ReplaceAllString(text, " ")), " ")
+	runes := []rune(text)
+	if len(runes) <= metaDescriptionLength {
+		return text
+	}
+	text = string(runes[:metaDescriptionLength])
+	if pos := strings.LastIndex(text, " "); pos > 0 {
+		text = text[:pos]
+	}
+	return text + "…"
+}
+
+// detailMeta creates the json-ld and open graph metadata of the head of the detail page
+func (ctrl *Controller) detailMeta(me *client.MediathekEntries_MediathekEntries, lang string) (*pageMeta, error) {
+	item := ctrl.detailJSONLD(me, lang)
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal json-ld of '%s'", me.GetBase().GetSignature())
+	}
+	meta := &pageMeta{
+		URL:    ctrl.detailLink(me.GetBase().GetSignature(), lang),
+		Type:   "article",
+		JSONLD: template.JS(data),
+	}
+	meta.Title, _ = item["name"].(string)
+	description, _ := item["description"].(string)
+	meta.Description = metaDescription(description)
+	meta.Image, _ = item["image"].(string)
+	if ogType, ok := openGraphTypes[emptyIfNil(me.GetBase().GetType())]; ok {
+		meta.Type = ogType
+	}
+	return meta, nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+func TestSchemaOrgItem(t *testing.T) {
+	rec := testRecord()
+	rec.Link = "https://example.org/detail/zotero2-1.AB C/de"
+	data, err := json.Marshal(schemaOrgItem(rec, "https://media.example/poster.jpg", "de"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item map[string]any
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]any{
+		"@context":     "https://schema.org",
+		"@type":        "VideoObject",
+		"@id":          rec.Link,
+		"name":         rec.Title,
+		"dateCreated":  "ca. 1995",
+		"image":        "https://media.example/poster.jpg",
+		"thumbnailUrl": "https://media.example/poster.jpg",
+		"inLanguage":   "de",
+	} {
+		if item[name] != want {
+			t.Errorf("%s is %v, expected %v", name, item[name], want)
+		}
+	}
+	if creators, _ := item["creator"].([]any); len(creators) != 1 || creators[0].(map[string]any)["name"] != "Doe, John" {
+		t.Errorf("invalid creator %v", item["creator"])
+	}
+	if contributors, _ := item["contributor"].([]any); len(contributors) != 1 || contributors[0].(map[string]any)["roleName"] != "camera" {
+		t.Errorf("invalid contributor %v", item["contributor"])
+	}
+	if place, _ := item["locationCreated"].(map[string]any); place["name"] != "Basel" {
+		t.Errorf("invalid place %v", item["locationCreated"])
+	}
+	if _, ok := item["description"]; ok {
+		t.Error("empty description must be omitted")
+	}
+}
+
+func TestMetaDescription(t *testing.T) {
+	if d := metaDescription("<p>Eine <b>Performance</b>\n in Basel</p>"); d != "Eine Performance in Basel" {
+		t.Errorf("invalid description '%s'", d)
+	}
+	d := metaDescription(strings.Repeat("wort ", 100))
+	if !strings.HasSuffix(d, "wort…") || len([]rune(d)) > metaDescriptionLength+1 {
+		t.Errorf("invalid shortened description '%s'", d)
+	}
+}
+
+func TestDetailMeta(t *testing.T) {
+	ctrl := &Controller{detailAddr: "https://detail.example", mediaserverBase: "https://media.example"}
+	itemType := "videoRecording"
+	me := &client.MediathekEntries_MediathekEntries{
+		Base: &client.MediathekBaseFragment{
+			Signature: "zotero2-1.SIG",
+			Title:     []*client.MultiLangFragment{{Lang: "de", Value: "Titel </script>"}},
+			Type:      &itemType,
+			Poster:    &client.MediaItemFragment{URI: "mediaserver:coll/poster"},
+		},
+		Abstract: []*client.MultiLangFragment{{Lang: "de", Value: "<p>Text</p>"}},
+	}
+	meta, err := ctrl.detailMeta(me, "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Type != "video.other" || meta.Description != "Text" || meta.URL != "https://detail.example/detail/zotero2-1.SIG/de" {
+		t.Errorf("invalid metadata %+v", meta)
+	}
+	if meta.Image != "" {
+		t.Errorf("invisible poster %s", meta.Image)
+	}
+	me.Base.MediaVisible = true
+	if meta, err = ctrl.detailMeta(me, "de"); err != nil || meta.Image == "" {
+		t.Errorf("visible poster missing (%v)", err)
+	}
+	me.Base.MediaProtected = true
+	if meta, err = ctrl.detailMeta(me, "de"); err != nil || meta.Image != "" || strings.Contains(string(meta.JSONLD), "image") {
+		t.Errorf("protected poster %s (%v)", meta.Image, err)
+	}
+	if strings.Contains(string(meta.JSONLD), "</script>") {
+		t.Errorf("unescaped json-ld %s", meta.JSONLD)
+	}
+}
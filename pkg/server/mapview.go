@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// size of the map display mode in pixels
+const (
+	mapWidth  = 960
+	mapHeight = 540
+)
+
+const (
+	mapTileSize = 256
+	mapMinZoom  = 1
+	mapMaxZoom  = 14
+)
+
+// mapTileURL is the url of the openstreetmap tiles with zoom, x and y
+const mapTileURL = "https://tile.openstreetmap.org/%d/%d/%d.png"
+
+// mapMaxLat is the latitude limit of the web mercator projection
+const mapMaxLat = 85.05112878
+
+// defaultMapExtent is shown, if there are no places to show
+var defaultMapExtent = &bbox{West: 5.9, South: 45.8, East: 10.5, North: 47.8}
+
+type mapTile struct {
+	URL string `json:"url"`
+	X   int    `json:"x"`
+	Y   int    `json:"y"`
+}
+
+// mapMarker is a place of the search result, X and Y are the position on the map
+type mapMarker struct {
+	Place  string  `json:"place"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Count  int     `json:"count"`
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Radius int     `json:"radius"`
+	BBox   string  `json:"bbox"`
+}
+
+// mapView is a web mercator map of the search result built from tiles, which does not need a javascript library.
+// Left and Top are the pixel coordinates of the upper left corner at Zoom.
+// ZoomIn and ZoomOut are the bounding boxes of the neighbouring zoom levels, they are empty at the limits
+type mapView struct {
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	Zoom    int          `json:"zoom"`
+	Left    float64      `json:"left"`
+	Top     float64      `json:"top"`
+	Tiles   []*mapTile   `json:"tiles"`
+	Markers []*mapMarker `json:"markers"`
+	BBox    string       `json:"bbox"`
+	ZoomIn  string       `json:"zoomIn"`
+	ZoomOut string       `json:"zoomOut"`
+}
+
+func mapWorldSize(zoom int) float64 {
+	return mapTileSize * math.Exp2(float64(zoom))
+}
+
+func mercatorX(lon float64, zoom int) float64 {
+	return (lon + 180) / 360 * mapWorldSize(zoom)
+}
+
+func mercatorY(lat float64, zoom int) float64 {
+	lat = max(-mapMaxLat, min(mapMaxLat, lat)) * math.Pi / 180
+	return (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * mapWorldSize(zoom)
+}
+
+func mercatorLon(x float64, zoom int) float64 {
+	return max(-180, min(180, x/mapWorldSize(zoom)*360-180))
+}
+
+func mercatorLat(y float64, zoom int) float64 {
+	n := math.Pi * (1 - 2*y/mapWorldSize(zoom))
+	return max(-mapMaxLat, min(mapMaxLat, math.Atan(math.Sinh(n))*180/math.Pi))
+}
+
+// roundCoord keeps the bounding boxes of the zoom links short
+func roundCoord(f float64) float64 {
+	return math.Round(f*10000) / 10000
+}
+
+// geocodePlaces creates the markers of the places found in the gazetteer
+func geocodePlaces(counts map[string]int, g *gazetteer) []*mapMarker {
+	markers := []*mapMarker{}
+	for place, count := range counts {
+		p, ok := g.lookup(place)
+		if !ok || count == 0 {
+			continue
+		}
+		markers = append(markers, &mapMarker{Place: place, Lat: p.Lat, Lon: p.Lon, Count: count, BBox: pointBBox(p).String()})
+	}
+	slices.SortFunc(markers, func(a, b *mapMarker) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Place, b.Place)
+	})
+	return markers
+}
+
+// newMapView shows the extent or the extent of all markers with the highest zoom level, which fits into the map
+func newMapView(extent *bbox, markers []*mapMarker) *mapView {
+	if extent == nil && len(markers) > 0 {
+		extent = &bbox{West: 180, South: 90, East: -180, North: -90}
+		for _, m := range markers {
+			extent.West = min(extent.West, m.Lon)
+			extent.East = max(extent.East, m.Lon)
+			extent.South = min(extent.South, m.Lat)
+			extent.North = max(extent.North, m.Lat)
+		}
+	}
+	if extent == nil {
+		extent = defaultMapExtent
+	}
+	mv := &mapView{Width: mapWidth, Height: mapHeight, Zoom: mapMinZoom, Tiles: []*mapTile{}, Markers: []*mapMarker{}}
+	// a margin keeps the markers at the border visible
+	for zoom := mapMaxZoom; zoom >= mapMinZoom; zoom-- {
+		w := mercatorX(extent.East, zoom) - mercatorX(extent.West, zoom)
+		h := mercatorY(extent.South, zoom) - mercatorY(extent.North, zoom)
+		if w <= mapWidth*0.9 && h <= mapHeight*0.9 {
+			mv.Zoom = zoom
+			break
+		}
+	}
+	cx := (mercatorX(extent.West, mv.Zoom) + mercatorX(extent.East, mv.Zoom)) / 2
+	cy := (mercatorY(extent.North, mv.Zoom) + mercatorY(extent.South, mv.Zoom)) / 2
+	mv.Left = math.Round(cx - mapWidth/2)
+	mv.Top = math.Round(cy - mapHeight/2)
+
+	tiles := int(math.Exp2(float64(mv.Zoom)))
+	for ty := int(math.Floor(mv.Top / mapTileSize)); float64(ty*mapTileSize) < mv.Top+mapHeight; ty++ {
+		if ty < 0 || ty >= tiles {
+			continue
+		}
+		for tx := int(math.Floor(mv.Left / mapTileSize)); float64(tx*mapTileSize) < mv.Left+mapWidth; tx++ {
+			mv.Tiles = append(mv.Tiles, &mapTile{
+				URL: fmt.Sprintf(mapTileURL, mv.Zoom, ((tx%tiles)+tiles)%tiles, ty),
+				X:   tx*mapTileSize - int(mv.Left),
+				Y:   ty*mapTileSize - int(mv.Top),
+			})
+		}
+	}
+
+	var maxCount int
+	for _, m := range markers {
+		maxCount = max(maxCount, m.Count)
+	}
+	for _, m := range markers {
+		x := mercatorX(m.Lon, mv.Zoom) - mv.Left
+		y := mercatorY(m.Lat, mv.Zoom) - mv.Top
+		if x < 0 || x > mapWidth || y < 0 || y > mapHeight {
+			continue
+		}
+		marker := *m
+		marker.X = int(math.Round(x))
+		marker.Y = int(math.Round(y))
+		marker.Radius = 5 + int(math.Round(10*math.Sqrt(float64(m.Count)/float64(maxCount))))
+		mv.Markers = append(mv.Markers, &marker)
+	}
+
+	mv.BBox = mv.extent(0, 0, mapWidth, mapHeight).String()
+	// the extents of the neighbouring zoom levels have to fit into the margin
+	if mv.Zoom < mapMaxZoom {
+		mv.ZoomIn = mv.extent(mapWidth*0.3, mapHeight*0.3, mapWidth*0.7, mapHeight*0.7).String()
+	}
+	if mv.Zoom > mapMinZoom {
+		mv.ZoomOut = mv.extent(-mapWidth*0.3, -mapHeight*0.3, mapWidth*1.3, mapHeight*1.3).String()
+	}
+	return mv
+}
+
+// extent returns the bounding box of a rectangle of the map in pixels
+func (mv *mapView) extent(left, top, right, bottom float64) *bbox {
+	return &bbox{
+		West:  roundCoord(mercatorLon(mv.Left+left, mv.Zoom)),
+		South: roundCoord(mercatorLat(mv.Top+bottom, mv.Zoom)),
+		East:  roundCoord(mercatorLon(mv.Left+right, mv.Zoom)),
+		North: roundCoord(mercatorLat(mv.Top+top, mv.Zoom)),
+	}
+}
+
+// searchMap shows the places of all hits of the search, a bounding box of the search is the extent of the map
+func (ctrl *Controller) searchMap(ctx context.Context, sr *searchResult) (*mapView, error) {
+	if sr.QueryError != "" {
+		return newMapView(sr.BBox, nil), nil
+	}
+	counts, err := ctrl.termCounts(ctx, sr.queryString, sr.resultFilter(), "place", ctrl.placeField(), "")
+	if err != nil {
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			return nil, errors.WithStack(err)
+		}
+		sr.QueryError = qErr.Error()
+		return newMapView(sr.BBox, nil), nil
+	}
+	return newMapView(sr.BBox, geocodePlaces(counts, ctrl.gazetteer)), nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMercator(t *testing.T) {
+	for _, p := range []geoPoint{{Lat: 47.5596, Lon: 7.5886}, {Lat: -33.87, Lon: 151.21}, {Lat: 0, Lon: 0}} {
+		lon := mercatorLon(mercatorX(p.Lon, 10), 10)
+		lat := mercatorLat(mercatorY(p.Lat, 10), 10)
+		if math.Abs(lon-p.Lon) > 1e-9 || math.Abs(lat-p.Lat) > 1e-9 {
+			t.Errorf("%v: %v,%v after projection", p, lat, lon)
+		}
+	}
+	// tile of basel at zoom 10
+	if x, y := int(mercatorX(7.5886, 10)/mapTileSize), int(mercatorY(47.5596, 10)/mapTileSize); x != 533 || y != 357 {
+		t.Errorf("tile %d/%d, expected 533/357", x, y)
+	}
+}
+
+func TestNewMapView(t *testing.T) {
+	g := &gazetteer{places: map[string]geoPoint{
+		"basel":  {Lat: 47.5596, Lon: 7.5886},
+		"zürich": {Lat: 47.3769, Lon: 8.5417},
+	}}
+	markers := geocodePlaces(map[string]int{"Basel": 10, "Zürich": 3, "Nowhere": 5}, g)
+	if len(markers) != 2 || markers[0].Place != "Basel" {
+		t.Fatalf("invalid markers %+v", markers)
+	}
+	mv := newMapView(nil, markers)
+	if len(mv.Markers) != 2 || len(mv.Tiles) == 0 {
+		t.Fatalf("%d markers and %d tiles", len(mv.Markers), len(mv.Tiles))
+	}
+	if mv.Markers[0].Radius <= mv.Markers[1].Radius {
+		t.Errorf("marker radius %d, expected more than %d", mv.Markers[0].Radius, mv.Markers[1].Radius)
+	}
+	for _, m := range mv.Markers {
+		if m.X < 0 || m.X > mv.Width || m.Y < 0 || m.Y > mv.Height {
+			t.Errorf("marker %s outside of the map at %d,%d", m.Place, m.X, m.Y)
+		}
+	}
+	// the zoom links show the neighbouring zoom levels
+	for bboxStr, zoom := range map[string]int{mv.ZoomIn: mv.Zoom + 1, mv.ZoomOut: mv.Zoom - 1, mv.BBox: mv.Zoom - 1} {
+		bb, err := parseBBox(bboxStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z := newMapView(bb, nil).Zoom; z != zoom {
+			t.Errorf("zoom %d of '%s', expected %d", z, bboxStr, zoom)
+		}
+	}
+	if mv := newMapView(pointBBox(geoPoint{Lat: 47.5596, Lon: 7.5886}), nil); mv.Zoom != mapMaxZoom || mv.ZoomIn != "" {
+		t.Errorf("point is shown with zoom %d", mv.Zoom)
+	}
+}
@@ -0,0 +1,819 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// OAIConfig describes the repository of the oai-pmh provider, the provider is only available with an admin email
+type OAIConfig struct {
+	RepositoryName string   `toml:"repositoryname"`
+	AdminEmail     []string `toml:"adminemail"`
+}
+
+const (
+	oaiSchemaLocation = "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	oaiDateFormat     = "2006-01-02"
+	oaiPageSize       = 100
+	// oaiLang is the language of titles and abstracts in the records
+	oaiLang = "de"
+	// oaiSetPrefix is the prefix of the set spec of the collections
+	oaiSetPrefix = "collection-"
+)
+
+// oaiGroups are the acl groups of the harvesters, only records visible for guests are exposed
+var oaiGroups = []string{"global/guest"}
+
+// oaiVerbArgs are the allowed arguments of the verbs, required arguments are true
+var oaiVerbArgs = map[string]map[string]bool{
+	"Identify":            {},
+	"ListMetadataFormats": {"identifier": false},
+	"ListSets":            {"resumptionToken": false},
+	"ListIdentifiers":     {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+	"ListRecords":         {"metadataPrefix": true, "from": false, "until": false, "set": false, "resumptionToken": false},
+	"GetRecord":           {"identifier": true, "metadataPrefix": true},
+}
+
+// oaiError is an error of the oai-pmh protocol, it is part of the response and not an http error
+type oaiError struct {
+	Code string `xml:"code,attr"`
+	Msg  string `xml:",chardata"`
+}
+
+func (e *oaiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Msg)
+}
+
+func newOAIError(code, format string, args ...any) *oaiError {
+	return &oaiError{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+type oaiRequest struct {
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+	URL             string `xml:",chardata"`
+}
+
+type oaiIdentifierDescription struct {
+	XMLName              xml.Name `xml:"http://www.openarchives.org/OAI/2.0/oai-identifier oai-identifier"`
+	Scheme               string   `xml:"scheme"`
+	RepositoryIdentifier string   `xml:"repositoryIdentifier"`
+	Delimiter            string   `xml:"delimiter"`
+	SampleIdentifier     string   `xml:"sampleIdentifier"`
+}
+
+type oaiDescription struct {
+	Value any
+}
+
+type oaiIdentify struct {
+	RepositoryName    string            `xml:"repositoryName"`
+	BaseURL           string            `xml:"baseURL"`
+	ProtocolVersion   string            `xml:"protocolVersion"`
+	AdminEmail        []string          `xml:"adminEmail"`
+	EarliestDatestamp string            `xml:"earliestDatestamp"`
+	DeletedRecord     string            `xml:"deletedRecord"`
+	Granularity       string            `xml:"granularity"`
+	Description       []*oaiDescription `xml:"description"`
+}
+
+type oaiMetadataFormat struct {
+	MetadataPrefix    string `xml:"metadataPrefix"`
+	Schema            string `xml:"schema"`
+	MetadataNamespace string `xml:"metadataNamespace"`
+}
+
+type oaiListMetadataFormats struct {
+	MetadataFormats []*oaiMetadataFormat `xml:"metadataFormat"`
+}
+
+type oaiSet struct {
+	SetSpec string `xml:"setSpec"`
+	SetName string `xml:"setName"`
+}
+
+type oaiListSets struct {
+	Sets []*oaiSet `xml:"set"`
+}
+
+type oaiHeader struct {
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+type oaiMetadata struct {
+	Value any
+}
+
+type oaiRecord struct {
+	Header   *oaiHeader   `xml:"header"`
+	Metadata *oaiMetadata `xml:"metadata"`
+}
+
+type oaiResumptionToken struct {
+	CompleteListSize int64  `xml:"completeListSize,attr"`
+	Cursor           int64  `xml:"cursor,attr"`
+	Token            string `xml:",chardata"`
+}
+
+type oaiListIdentifiers struct {
+	Headers         []*oaiHeader        `xml:"header"`
+	ResumptionToken *oaiResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type oaiListRecords struct {
+	Records         []*oaiRecord        `xml:"record"`
+	ResumptionToken *oaiResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type oaiGetRecord struct {
+	Record *oaiRecord `xml:"record"`
+}
+
+type oaiResponse struct {
+	XMLName             xml.Name                `xml:"http://www.openarchives.org/OAI/2.0/ OAI-PMH"`
+	NSXSI               string                  `xml:"xmlns:xsi,attr"`
+	SchemaLocation      string                  `xml:"xsi:schemaLocation,attr"`
+	ResponseDate        string                  `xml:"responseDate"`
+	Request             *oaiRequest             `xml:"request"`
+	Errors              []*oaiError             `xml:"error"`
+	Identify            *oaiIdentify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *oaiListMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	ListSets            *oaiListSets            `xml:"ListSets,omitempty"`
+	ListIdentifiers     *oaiListIdentifiers     `xml:"ListIdentifiers,omitempty"`
+	ListRecords         *oaiListRecords         `xml:"ListRecords,omitempty"`
+	GetRecord           *oaiGetRecord           `xml:"GetRecord,omitempty"`
+}
+
+/*
+ * metadata formats
+ */
+
+// oaiItem is an entry with the fields of the metadata formats beyond the export record
+type oaiItem struct {
+	*exportRecord
+	Rights  []string
+	Preview string
+}
+
+type oaiDC struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	NSOAIDC        string   `xml:"xmlns:oai_dc,attr"`
+	NSDC           string   `xml:"xmlns:dc,attr"`
+	NSXSI          string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Title          []string `xml:"dc:title"`
+	Creator        []string `xml:"dc:creator"`
+	Contributor    []string `xml:"dc:contributor"`
+	Description    []string `xml:"dc:description"`
+	Publisher      []string `xml:"dc:publisher"`
+	Date           []string `xml:"dc:date"`
+	Type           []string `xml:"dc:type"`
+	Identifier     []string `xml:"dc:identifier"`
+	Source         []string `xml:"dc:source"`
+	Relation       []string `xml:"dc:relation"`
+	Coverage       []string `xml:"dc:coverage"`
+	Rights         []string `xml:"dc:rights"`
+}
+
+func nonEmpty(values ...string) []string {
+	result := []string{}
+	for _, val := range values {
+		if val != "" {
+			result = append(result, val)
+		}
+	}
+	return result
+}
+
+func newOAIDC(item *oaiItem) any {
+	dc := &oaiDC{
+		NSOAIDC:        "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		NSDC:           "http://purl.org/dc/elements/1.1/",
+		NSXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.openarchives.org/OAI/2.0/oai_dc/ http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+		Title:          nonEmpty(item.Title),
+		Creator:        []string{},
+		Contributor:    []string{},
+		Description:    nonEmpty(item.Abstract),
+		Publisher:      nonEmpty(item.Publisher),
+		Date:           nonEmpty(item.Date),
+		Type:           nonEmpty(item.Type),
+		Identifier:     nonEmpty(item.Link, item.Signature),
+		Source:         nonEmpty(item.URL),
+		Relation:       nonEmpty(item.Collection),
+		Coverage:       nonEmpty(item.Place),
+		Rights:         item.Rights,
+	}
+	for _, p := range item.creators() {
+		dc.Creator = append(dc.Creator, p.Name)
+	}
+	for _, p := range item.Persons {
+		if !creatorRoles[p.Role] {
+			dc.Contributor = append(dc.Contributor, p.Name)
+		}
+	}
+	return dc
+}
+
+// modsResourceTypes maps the item types of the catalogue to the mods resource types
+var modsResourceTypes = map[string]string{
+	"book":           "text",
+	"bookSection":    "text",
+	"journalArticle": "text",
+	"thesis":         "text",
+	"report":         "text",
+	"webpage":        "text",
+	"videoRecording": "moving image",
+	"audioRecording": "sound recording",
+	"artwork":        "still image",
+}
+
+type modsTitleInfo struct {
+	Title string `xml:"title"`
+}
+
+type modsRoleTerm struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type modsName struct {
+	NamePart string        `xml:"namePart"`
+	RoleTerm *modsRoleTerm `xml:"role>roleTerm"`
+}
+
+type modsPlaceTerm struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type modsOriginInfo struct {
+	Place       *modsPlaceTerm `xml:"place>placeTerm,omitempty"`
+	Publisher   string         `xml:"publisher,omitempty"`
+	DateCreated string         `xml:"dateCreated,omitempty"`
+}
+
+type modsRelatedItem struct {
+	Type      string         `xml:"type,attr"`
+	TitleInfo *modsTitleInfo `xml:"titleInfo"`
+}
+
+type modsIdentifier struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type modsURL struct {
+	Usage  string `xml:"usage,attr,omitempty"`
+	Access string `xml:"access,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type modsAccessCondition struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type mods struct {
+	XMLName         xml.Name               `xml:"http://www.loc.gov/mods/v3 mods"`
+	NSXSI           string                 `xml:"xmlns:xsi,attr"`
+	SchemaLocation  string                 `xml:"xsi:schemaLocation,attr"`
+	Version         string                 `xml:"version,attr"`
+	TitleInfo       *modsTitleInfo         `xml:"titleInfo,omitempty"`
+	Names           []*modsName            `xml:"name"`
+	TypeOfResource  string                 `xml:"typeOfResource,omitempty"`
+	Genre           string                 `xml:"genre,omitempty"`
+	OriginInfo      *modsOriginInfo        `xml:"originInfo,omitempty"`
+	Abstract        string                 `xml:"abstract,omitempty"`
+	AccessCondition []*modsAccessCondition `xml:"accessCondition"`
+	RelatedItem     *modsRelatedItem       `xml:"relatedItem,omitempty"`
+	Identifier      *modsIdentifier        `xml:"identifier"`
+	URLs            []*modsURL             `xml:"location>url"`
+}
+
+func newMODS(item *oaiItem) any {
+	m := &mods{
+		NSXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.loc.gov/mods/v3 http://www.loc.gov/standards/mods/v3/mods-3-7.xsd",
+		Version:        "3.7",
+		Names:          []*modsName{},
+		TypeOfResource: modsResourceTypes[item.Type],
+		Genre:          item.Type,
+		Abstract:       item.Abstract,
+		Identifier:     &modsIdentifier{Type: "local", Value: item.Signature},
+		URLs:           []*modsURL{{Usage: "primary display", Access: "object in context", Value: item.Link}},
+	}
+	if item.Title != "" {
+		m.TitleInfo = &modsTitleInfo{Title: item.Title}
+	}
+	for _, p := range item.Persons {
+		m.Names = append(m.Names, &modsName{NamePart: p.Name, RoleTerm: &modsRoleTerm{Type: "text", Value: p.Role}})
+	}
+	if item.Place != "" || item.Publisher != "" || item.Date != "" {
+		m.OriginInfo = &modsOriginInfo{Publisher: item.Publisher, DateCreated: item.Date}
+		if item.Place != "" {
+			m.OriginInfo.Place = &modsPlaceTerm{Type: "text", Value: item.Place}
+		}
+	}
+	for _, rights := range item.Rights {
+		m.AccessCondition = append(m.AccessCondition, &modsAccessCondition{Type: "use and reproduction", Value: rights})
+	}
+	if item.Collection != "" {
+		m.RelatedItem = &modsRelatedItem{Type: "host", TitleInfo: &modsTitleInfo{Title: item.Collection}}
+	}
+	if item.URL != "" {
+		m.URLs = append(m.URLs, &modsURL{Value: item.URL})
+	}
+	if item.Preview != "" {
+		m.URLs = append(m.URLs, &modsURL{Access: "preview", Value: item.Preview})
+	}
+	return m
+}
+
+type oaiFormat struct {
+	oaiMetadataFormat
+	Metadata func(item *oaiItem) any
+}
+
+var oaiFormats = []*oaiFormat{
+	{
+		oaiMetadataFormat: oaiMetadataFormat{
+			MetadataPrefix:    "oai_dc",
+			Schema:            "http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+			MetadataNamespace: "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		},
+		Metadata: newOAIDC,
+	},
+	{
+		oaiMetadataFormat: oaiMetadataFormat{
+			MetadataPrefix:    "mods",
+			Schema:            "http://www.loc.gov/standards/mods/v3/mods-3-7.xsd",
+			MetadataNamespace: "http://www.loc.gov/mods/v3",
+		},
+		Metadata: newMODS,
+	},
+}
+
+func oaiFormatByPrefix(prefix string) (*oaiFormat, bool) {
+	for _, format := range oaiFormats {
+		if format.MetadataPrefix == prefix {
+			return format, true
+		}
+	}
+	return nil, false
+}
+
+/*
+ * list requests
+ */
+
+// oaiListParams are the arguments of a list request, which are kept in the resumption token with the offset of the next page
+type oaiListParams struct {
+	MetadataPrefix string `json:"p"`
+	From           string `json:"f,omitempty"`
+	Until          string `json:"u,omitempty"`
+	Set            string `json:"s,omitempty"`
+	Offset         int64  `json:"o,omitempty"`
+}
+
+func (p *oaiListParams) token() string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseOAIToken(token string) (*oaiListParams, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, newOAIError("badResumptionToken", "invalid resumption token '%s'", token)
+	}
+	p := &oaiListParams{}
+	if err := json.Unmarshal(data, p); err != nil || p.MetadataPrefix == "" || p.Offset <= 0 {
+		return nil, newOAIError("badResumptionToken", "invalid resumption token '%s'", token)
+	}
+	return p, nil
+}
+
+// parseOAIDate parses a datestamp argument, only the day granularity is supported
+func parseOAIDate(name, value string) (time.Time, error) {
+	t, err := time.Parse(oaiDateFormat, value)
+	if err != nil {
+		return time.Time{}, newOAIError("badArgument", "invalid %s '%s', the granularity is %s", name, value, "YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+// oaiArgs checks the arguments of the request. Arguments must not be repeated,
+// the resumption token is exclusive and all other required arguments must be present without it
+func oaiArgs(values url.Values) (string, map[string]string, error) {
+	verbs := values["verb"]
+	if len(verbs) != 1 {
+		return "", nil, newOAIError("badVerb", "verb is missing or repeated")
+	}
+	verb := verbs[0]
+	allowed, ok := oaiVerbArgs[verb]
+	if !ok {
+		return "", nil, newOAIError("badVerb", "illegal verb '%s'", verb)
+	}
+	args := map[string]string{}
+	for name, vals := range values {
+		if name == "verb" {
+			continue
+		}
+		if _, ok := allowed[name]; !ok {
+			return verb, nil, newOAIError("badArgument", "illegal argument '%s'", name)
+		}
+		if len(vals) != 1 {
+			return verb, nil, newOAIError("badArgument", "repeated argument '%s'", name)
+		}
+		args[name] = vals[0]
+	}
+	if _, ok := args["resumptionToken"]; ok {
+		if len(args) > 1 {
+			return verb, nil, newOAIError("badArgument", "resumptionToken is an exclusive argument")
+		}
+		return verb, args, nil
+	}
+	for name, required := range allowed {
+		if _, ok := args[name]; required && !ok {
+			return verb, nil, newOAIError("badArgument", "missing argument '%s'", name)
+		}
+	}
+	return verb, args, nil
+}
+
+/*
+ * provider
+ */
+
+// oaiRepositoryIdentifier is the host of the external address, which is the namespace of the oai identifiers
+func (ctrl *Controller) oaiRepositoryIdentifier() string {
+	u, err := url.Parse(ctrl.externalAddr)
+	if err != nil || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
+
+func (ctrl *Controller) oaiIdentifier(signature string) string {
+	return fmt.Sprintf("oai:%s:%s", ctrl.oaiRepositoryIdentifier(), signature)
+}
+
+func (ctrl *Controller) oaiSignature(identifier string) (string, bool) {
+	signature, ok := strings.CutPrefix(identifier, fmt.Sprintf("oai:%s:", ctrl.oaiRepositoryIdentifier()))
+	return signature, ok && signature != ""
+}
+
+// oaiSetSpecs returns the sets of the collections with a field, which contain the record.
+// Query collections are only selectable, the membership of a record is not known
+func (ctrl *Controller) oaiSetSpecs(base *client.MediathekBaseFragment) []string {
+	result := []string{}
+	for _, coll := range ctrl.collectionRegistry.collections {
+		var values []string
+		switch coll.Kind {
+		case collectionKindCategory:
+			values = base.GetCategory()
+		case collectionKindTag:
+			values = base.GetTags()
+		case collectionKindSignature:
+			values = []string{base.GetSignature()}
+		default:
+			continue
+		}
+		for _, val := range coll.Values {
+			if slices.Contains(values, val) {
+				result = append(result, oaiSetPrefix+strconv.FormatInt(coll.Id, 10))
+				break
+			}
+		}
+	}
+	return result
+}
+
+// oaiVisible checks the acl of a record like the search filter of the guests
+func oaiVisible(base *client.MediathekBaseFragment) bool {
+	if base.GetPoster() == nil {
+		return false
+	}
+	for _, acl := range base.GetACL() {
+		if acl.GetName() != "content" {
+			continue
+		}
+		for _, group := range acl.GetGroups() {
+			if slices.Contains(oaiGroups, group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ctrl *Controller) newOAIItem(base *client.MediathekBaseFragment, abstract []*client.MultiLangFragment) *oaiItem {
+	item := &oaiItem{
+		exportRecord: ctrl.newExportRecord(base, abstract, oaiLang),
+		Rights:       nonEmpty(emptyIfNil(base.GetRights()), emptyIfNil(base.GetLicense())),
+	}
+	// the preview link has no token, protected media are not linked
+	if poster := base.GetPoster(); poster != nil && base.GetMediaVisible() && !base.GetMediaProtected() {
+		item.Preview = ctrl.mediaLink(poster.GetURI(), "resize", jsonLDPosterParam, false)
+	}
+	return item
+}
+
+func (ctrl *Controller) oaiHeader(base *client.MediathekBaseFragment, datestamp string) *oaiHeader {
+	return &oaiHeader{
+		Identifier: ctrl.oaiIdentifier(base.GetSignature()),
+		Datestamp:  datestamp,
+		SetSpecs:   ctrl.oaiSetSpecs(base),
+	}
+}
+
+func (ctrl *Controller) oaiIdentify(datestamp string) *oaiIdentify {
+	name := ctrl.oaiConfig.RepositoryName
+	if name == "" {
+		localizer := i18n.NewLocalizer(ctrl.bundle, oaiLang)
+		var err error
+		if name, err = localizer.LocalizeMessage(&i18n.Message{ID: "title"}); err != nil {
+			name = "title"
+		}
+	}
+	return &oaiIdentify{
+		RepositoryName:    name,
+		BaseURL:           ctrl.externalAddr + "/oai",
+		ProtocolVersion:   "2.0",
+		AdminEmail:        ctrl.oaiConfig.AdminEmail,
+		EarliestDatestamp: datestamp,
+		DeletedRecord:     "no",
+		Granularity:       "YYYY-MM-DD",
+		Description: []*oaiDescription{{Value: &oaiIdentifierDescription{
+			Scheme:               "oai",
+			RepositoryIdentifier: ctrl.oaiRepositoryIdentifier(),
+			Delimiter:            ":",
+			SampleIdentifier:     ctrl.oaiIdentifier("zotero2-2486551.SIG"),
+		}}},
+	}
+}
+
+// oaiEntry loads a record, records, which are not visible for guests, do not exist
+func (ctrl *Controller) oaiEntry(ctx context.Context, identifier string) (*client.MediathekEntries_MediathekEntries, error) {
+	signature, ok := ctrl.oaiSignature(identifier)
+	if !ok {
+		return nil, newOAIError("idDoesNotExist", "unknown identifier '%s'", identifier)
+	}
+	source, err := ctrl.client.MediathekEntries(ctx, []string{signature})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get source '%s'", signature)
+	}
+	if source == nil || len(source.MediathekEntries) == 0 || !oaiVisible(source.MediathekEntries[0].GetBase()) {
+		return nil, newOAIError("idDoesNotExist", "unknown identifier '%s'", identifier)
+	}
+	return source.MediathekEntries[0], nil
+}
+
+func (ctrl *Controller) oaiSets() (*oaiListSets, error) {
+	if len(ctrl.collectionRegistry.collections) == 0 {
+		return nil, newOAIError("noSetHierarchy", "the repository does not support sets")
+	}
+	sets := &oaiListSets{Sets: []*oaiSet{}}
+	for _, coll := range ctrl.collectionRegistry.collections {
+		sets.Sets = append(sets.Sets, &oaiSet{SetSpec: oaiSetPrefix + strconv.FormatInt(coll.Id, 10), SetName: coll.Title})
+	}
+	return sets, nil
+}
+
+// oaiListRequest reads the arguments or the resumption token of a list request
+func (ctrl *Controller) oaiListRequest(args map[string]string, today time.Time) (*oaiListParams, error) {
+	if token, ok := args["resumptionToken"]; ok {
+		return parseOAIToken(token)
+	}
+	p := &oaiListParams{MetadataPrefix: args["metadataPrefix"], From: args["from"], Until: args["until"], Set: args["set"]}
+	from, until := today, today
+	var err error
+	if p.From != "" {
+		if from, err = parseOAIDate("from", p.From); err != nil {
+			return nil, err
+		}
+	}
+	if p.Until != "" {
+		if until, err = parseOAIDate("until", p.Until); err != nil {
+			return nil, err
+		}
+	}
+	if p.From != "" && p.Until != "" && from.After(until) {
+		return nil, newOAIError("badArgument", "from '%s' is after until '%s'", p.From, p.Until)
+	}
+	if _, ok := oaiFormatByPrefix(p.MetadataPrefix); !ok {
+		return nil, newOAIError("cannotDisseminateFormat", "unknown metadata format '%s'", p.MetadataPrefix)
+	}
+	if p.Set != "" {
+		if _, err := ctrl.oaiCollection(p.Set); err != nil {
+			return nil, err
+		}
+	}
+	// revcat does not return the modification date, all records have the date of the response
+	if from.After(today) || until.Before(today) {
+		return nil, newOAIError("noRecordsMatch", "no records between '%s' and '%s'", p.From, p.Until)
+	}
+	return p, nil
+}
+
+func (ctrl *Controller) oaiCollection(set string) (*collection, error) {
+	idStr, ok := strings.CutPrefix(set, oaiSetPrefix)
+	if !ok {
+		return nil, newOAIError("badArgument", "unknown set '%s'", set)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, newOAIError("badArgument", "unknown set '%s'", set)
+	}
+	coll, ok := ctrl.collectionRegistry.get(id)
+	if !ok {
+		return nil, newOAIError("badArgument", "unknown set '%s'", set)
+	}
+	return coll, nil
+}
+
+// oaiList searches one page of the records of a list request. The records are sorted by signature,
+// the offset of the next page is part of the resumption token. The end cursor of revcat is not used,
+// the next page would start with the last record of the current page
+func (ctrl *Controller) oaiList(ctx context.Context, p *oaiListParams, resumed bool) ([]*client.Search_Search_Edges, *oaiResumptionToken, error) {
+	var query string
+	filter := searchFilter(oaiGroups)
+	if p.Set != "" {
+		coll, err := ctrl.oaiCollection(p.Set)
+		if err != nil {
+			return nil, nil, newOAIError("badResumptionToken", "unknown set '%s' in resumption token", p.Set)
+		}
+		collQuery, collFilter, hasRecords, err := ctrl.collectionSearch(ctx, oaiGroups, coll)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		if !hasRecords {
+			if resumed {
+				return []*client.Search_Search_Edges{}, nil, nil
+			}
+			return nil, nil, newOAIError("noRecordsMatch", "no records in set '%s'", p.Set)
+		}
+		query = collQuery
+		filter = append(filter, collFilter...)
+	}
+	var size int64 = oaiPageSize
+	offset := p.Offset
+	result, err := ctrl.client.Search(ctx, query, []*client.InFacet{}, filter, nil, &offset, &size, nil, []*client.SortField{{Field: signatureField, Order: sortOrderAsc}})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot search for set '%s'", p.Set)
+	}
+	edges := result.GetSearch().GetEdges()
+	if len(edges) == 0 && !resumed {
+		return nil, nil, newOAIError("noRecordsMatch", "no records in set '%s'", p.Set)
+	}
+	var token *oaiResumptionToken
+	next := p.Offset + int64(len(edges))
+	if len(edges) > 0 && next < result.GetSearch().GetTotalCount() {
+		np := *p
+		np.Offset = next
+		token = &oaiResumptionToken{CompleteListSize: result.GetSearch().GetTotalCount(), Cursor: p.Offset, Token: np.token()}
+	} else if resumed {
+		// the last page of a resumed list has an empty token
+		token = &oaiResumptionToken{CompleteListSize: result.GetSearch().GetTotalCount(), Cursor: p.Offset}
+	}
+	return edges, token, nil
+}
+
+// oaiHandle answers the verb of the request. Protocol errors are returned as oaiError
+func (ctrl *Controller) oaiHandle(ctx context.Context, resp *oaiResponse, verb string, args map[string]string, now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+	datestamp := today.Format(oaiDateFormat)
+	switch verb {
+	case "Identify":
+		resp.Identify = ctrl.oaiIdentify(datestamp)
+	case "ListMetadataFormats":
+		if identifier, ok := args["identifier"]; ok {
+			if _, err := ctrl.oaiEntry(ctx, identifier); err != nil {
+				return err
+			}
+		}
+		resp.ListMetadataFormats = &oaiListMetadataFormats{MetadataFormats: []*oaiMetadataFormat{}}
+		for _, format := range oaiFormats {
+			resp.ListMetadataFormats.MetadataFormats = append(resp.ListMetadataFormats.MetadataFormats, &format.oaiMetadataFormat)
+		}
+	case "ListSets":
+		if token, ok := args["resumptionToken"]; ok {
+			return newOAIError("badResumptionToken", "invalid resumption token '%s'", token)
+		}
+		sets, err := ctrl.oaiSets()
+		if err != nil {
+			return err
+		}
+		resp.ListSets = sets
+	case "ListIdentifiers", "ListRecords":
+		p, err := ctrl.oaiListRequest(args, today)
+		if err != nil {
+			return err
+		}
+		_, resumed := args["resumptionToken"]
+		edges, token, err := ctrl.oaiList(ctx, p, resumed)
+		if err != nil {
+			return err
+		}
+		if verb == "ListIdentifiers" {
+			resp.ListIdentifiers = &oaiListIdentifiers{Headers: []*oaiHeader{}, ResumptionToken: token}
+			for _, e := range edges {
+				resp.ListIdentifiers.Headers = append(resp.ListIdentifiers.Headers, ctrl.oaiHeader(e.GetBase(), datestamp))
+			}
+			return nil
+		}
+		format, ok := oaiFormatByPrefix(p.MetadataPrefix)
+		if !ok {
+			return newOAIError("badResumptionToken", "unknown metadata format '%s' in resumption token", p.MetadataPrefix)
+		}
+		resp.ListRecords = &oaiListRecords{Records: []*oaiRecord{}, ResumptionToken: token}
+		for _, e := range edges {
+			resp.ListRecords.Records = append(resp.ListRecords.Records, &oaiRecord{
+				Header:   ctrl.oaiHeader(e.GetBase(), datestamp),
+				Metadata: &oaiMetadata{Value: format.Metadata(ctrl.newOAIItem(e.GetBase(), e.GetAbstract()))},
+			})
+		}
+	case "GetRecord":
+		format, ok := oaiFormatByPrefix(args["metadataPrefix"])
+		if !ok {
+			return newOAIError("cannotDisseminateFormat", "unknown metadata format '%s'", args["metadataPrefix"])
+		}
+		me, err := ctrl.oaiEntry(ctx, args["identifier"])
+		if err != nil {
+			return err
+		}
+		resp.GetRecord = &oaiGetRecord{Record: &oaiRecord{
+			Header:   ctrl.oaiHeader(me.GetBase(), datestamp),
+			Metadata: &oaiMetadata{Value: format.Metadata(ctrl.newOAIItem(me.GetBase(), me.GetAbstract()))},
+		}}
+	}
+	return nil
+}
+
+// oai is the oai-pmh 2.0 provider. The request context has no user, revcat is queried with the groups of the guests
+func (ctrl *Controller) oai(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		ctrl.logger.Error().Err(err).Msg("cannot parse oai request")
+		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Sprintf("cannot parse oai request: %v", err))
+		return
+	}
+	now := time.Now().UTC()
+	resp := &oaiResponse{
+		NSXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: oaiSchemaLocation,
+		ResponseDate:   now.Format(time.RFC3339),
+		Request:        &oaiRequest{URL: ctrl.externalAddr + "/oai"},
+	}
+	verb, args, err := oaiArgs(c.Request.Form)
+	if err == nil {
+		resp.Request.Verb = verb
+		resp.Request.Identifier = args["identifier"]
+		resp.Request.MetadataPrefix = args["metadataPrefix"]
+		resp.Request.From = args["from"]
+		resp.Request.Until = args["until"]
+		resp.Request.Set = args["set"]
+		resp.Request.ResumptionToken = args["resumptionToken"]
+		err = ctrl.oaiHandle(c.Request.Context(), resp, verb, args, now)
+	}
+	if err != nil {
+		var oErr *oaiError
+		if !errors.As(err, &oErr) {
+			ctrl.logger.Error().Err(err).Msgf("cannot process oai request '%s'", verb)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot process oai request '%s': %v", verb, err))
+			return
+		}
+		resp.Errors = []*oaiError{oErr}
+		// the request of an illegal verb or argument is not echoed
+		if oErr.Code == "badVerb" || oErr.Code == "badArgument" {
+			resp.Request = &oaiRequest{URL: resp.Request.URL}
+		}
+	}
+	data, err := xml.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot create oai response '%s'", verb)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot create oai response '%s': %v", verb, err))
+		return
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+func TestOAIArgs(t *testing.T) {
+	for query, code := range map[string]string{
+		"verb=Identify": "",
+		"verb=ListRecords&metadataPrefix=oai_dc&set=x": "",
+		"verb=ListRecords&resumptionToken=abc":         "",
+		"":                                             "badVerb",
+		"verb=Identify&verb=Identify":                  "badVerb",
+		"verb=Harvest":                                 "badVerb",
+		"verb=Identify&set=x":                          "badArgument",
+		"verb=ListRecords":                             "badArgument",
+		"verb=ListRecords&metadataPrefix=oai_dc&set=a&set=b":         "badArgument",
+		"verb=ListRecords&metadataPrefix=oai_dc&resumptionToken=abc": "badArgument",
+		"verb=GetRecord&identifier=oai:x:1":                          "badArgument",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, _, err := oaiArgs(values)
+		var oErr *oaiError
+		switch {
+		case code == "" && err != nil:
+			t.Errorf("%s: %v", query, err)
+		case code != "" && (!errors.As(err, &oErr) || oErr.Code != code):
+			t.Errorf("%s: %v, expected %s", query, err, code)
+		}
+	}
+}
+
+func TestOAIListRequest(t *testing.T) {
+	ctrl := &Controller{collectionRegistry: &collectionRegistry{collections: []*collection{{CollFacetType: &CollFacetType{Id: 5}}}}}
+	today := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	for query, code := range map[string]string{
+		"metadataPrefix=oai_dc":                                                 "",
+		"metadataPrefix=mods&from=2026-01-01&until=2026-03-10":                  "",
+		"metadataPrefix=oai_dc&set=collection-5":                                "",
+		"metadataPrefix=marc":                                                   "cannotDisseminateFormat",
+		"metadataPrefix=oai_dc&set=collection-6":                                "badArgument",
+		"metadataPrefix=oai_dc&from=2026-01-01T00:00:00Z":                       "badArgument",
+		"metadataPrefix=oai_dc&from=2026-02-01&until=2026-01-01":                "badArgument",
+		"metadataPrefix=oai_dc&until=2026-03-09":                                "noRecordsMatch",
+		"metadataPrefix=oai_dc&from=2026-03-11":                                 "noRecordsMatch",
+		"resumptionToken=" + (&oaiListParams{MetadataPrefix: "oai_dc"}).token(): "badResumptionToken",
+	} {
+		values, _ := url.ParseQuery(query)
+		args := map[string]string{}
+		for name := range values {
+			args[name] = values.Get(name)
+		}
+		_, err := ctrl.oaiListRequest(args, today)
+		var oErr *oaiError
+		switch {
+		case code == "" && err != nil:
+			t.Errorf("%s: %v", query, err)
+		case code != "" && (!errors.As(err, &oErr) || oErr.Code != code):
+			t.Errorf("%s: %v, expected %s", query, err, code)
+		}
+	}
+
+	p := &oaiListParams{MetadataPrefix: "mods", Set: "collection-5", Offset: 100}
+	parsed, err := parseOAIToken(p.token())
+	if err != nil || *parsed != *p {
+		t.Errorf("resumption token %+v: %v", parsed, err)
+	}
+}
+
+func TestOAIMetadata(t *testing.T) {
+	item := &oaiItem{exportRecord: testRecord(), Rights: []string{"CC BY 4.0"}, Preview: "https://media.example/poster.jpg"}
+	item.Link = "https://example.org/detail/zotero2-1.AB C/de"
+	for _, format := range oaiFormats {
+		data, err := xml.Marshal(format.Metadata(item))
+		if err != nil {
+			t.Fatalf("%s: %v", format.MetadataPrefix, err)
+		}
+		want := map[string][]string{
+			"oai_dc": {`<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/"`, "<dc:title>50% &amp; more {sic}</dc:title>", "<dc:creator>Doe, John</dc:creator>", "<dc:contributor>Smith, Ann</dc:contributor>", "<dc:contributor>Studio X</dc:contributor>", "<dc:rights>CC BY 4.0</dc:rights>"},
+			"mods":   {`<mods xmlns="http://www.loc.gov/mods/v3"`, "<typeOfResource>moving image</typeOfResource>", `<roleTerm type="text">camera</roleTerm>`, `<placeTerm type="text">Basel</placeTerm>`, `<url access="preview">https://media.example/poster.jpg</url>`},
+		}[format.MetadataPrefix]
+		for _, w := range want {
+			if !strings.Contains(string(data), w) {
+				t.Errorf("%s: missing %s in %s", format.MetadataPrefix, w, data)
+			}
+		}
+	}
+}
+
+func TestOAIPreview(t *testing.T) {
+	ctrl := &Controller{mediaserverBase: "https://media.example"}
+	base := &client.MediathekBaseFragment{
+		Signature:    "zotero2-1.SIG",
+		Poster:       &client.MediaItemFragment{URI: "mediaserver:coll/poster"},
+		MediaVisible: true,
+	}
+	if item := ctrl.newOAIItem(base, nil); item.Preview == "" {
+		t.Error("visible poster without preview")
+	}
+	base.MediaProtected = true
+	if item := ctrl.newOAIItem(base, nil); item.Preview != "" {
+		t.Errorf("protected poster %s", item.Preview)
+	}
+}
+
+func TestOAIListPages(t *testing.T) {
+	const total = 250
+	tc := &testClient{search: func(req *testSearch) (*client.Search, error) {
+		if req.Cursor != nil || req.First == nil {
+			return nil, fmt.Errorf("offset expected")
+		}
+		result := &client.Search{}
+		result.Search.TotalCount = total
+		result.Search.Edges = edges()
+		for i := *req.First; i < min(*req.First+*req.Size, total); i++ {
+			result.Search.Edges = append(result.Search.Edges, edges(fmt.Sprintf("zotero2-1.%03d", i))...)
+		}
+		return result, nil
+	}}
+	ctrl := &Controller{client: tc, externalAddr: "https://ext.example", oaiConfig: &OAIConfig{}, collectionRegistry: &collectionRegistry{}}
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	seen := map[string]int{}
+	args := map[string]string{"metadataPrefix": "oai_dc"}
+	for page := 0; ; page++ {
+		if page > total/oaiPageSize+1 {
+			t.Fatal("resumption tokens do not end")
+		}
+		resp := &oaiResponse{}
+		if err := ctrl.oaiHandle(context.Background(), resp, "ListIdentifiers", args, now); err != nil {
+			t.Fatal(err)
+		}
+		for _, header := range resp.ListIdentifiers.Headers {
+			seen[header.Identifier]++
+		}
+		token := resp.ListIdentifiers.ResumptionToken
+		if token == nil || token.Token == "" {
+			break
+		}
+		if token.CompleteListSize != total || token.Cursor != int64(page*oaiPageSize) {
+			t.Errorf("page %d: invalid resumption token %+v", page, token)
+		}
+		args = map[string]string{"resumptionToken": token.Token}
+	}
+	if len(seen) != total {
+		t.Errorf("%d of %d records listed", len(seen), total)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("%s listed %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// searchPageSizes are the selectable numbers of hits per search page, the first is the default
+var searchPageSizes = []int64{25, 50, 100}
+
+// paginationWindow is the number of page links on each side of the current page
+const paginationWindow = 2
+
+// pagination is the numbered page navigation of a search result, pages start with 1.
+// Pages are requested with offsets, the last page is limited by the result window of the backend.
+// Pages contains the page links, 0 is a gap between them
+type pagination struct {
+	Page      int64   `json:"page"`
+	PageSize  int64   `json:"pageSize"`
+	LastPage  int64   `json:"lastPage"`
+	Pages     []int64 `json:"pages"`
+	PageSizes []int64 `json:"pageSizes"`
+}
+
+// newPagination checks page and page size, 0 selects the first page and the default size
+func newPagination(page, pageSize int64) (*pagination, error) {
+	if pageSize == 0 {
+		pageSize = searchPageSizes[0]
+	}
+	if !slices.Contains(searchPageSizes, pageSize) {
+		return nil, &QueryError{Msg: fmt.Sprintf("invalid page size %d", pageSize)}
+	}
+	if page == 0 {
+		page = 1
+	}
+	if page < 0 {
+		return nil, &QueryError{Msg: fmt.Sprintf("invalid page %d", page)}
+	}
+	if (page-1)*pageSize >= maxResultWindow {
+		return nil, &QueryError{Msg: fmt.Sprintf("page %d is beyond the first %d hits", page, maxResultWindow)}
+	}
+	return &pagination{
+		Page:      page,
+		PageSize:  pageSize,
+		LastPage:  page,
+		Pages:     []int64{page},
+		PageSizes: searchPageSizes,
+	}, nil
+}
+
+// first returns the offset of the page
+func (p *pagination) first() int64 {
+	return (p.Page - 1) * p.PageSize
+}
+
+// setTotal calculates the last page and the page links from the number of hits
+func (p *pagination) setTotal(total int64) {
+	total = min(total, maxResultWindow)
+	p.LastPage = max(1, (total+p.PageSize-1)/p.PageSize)
+	p.Pages = []int64{1}
+	from := max(2, p.Page-paginationWindow)
+	to := min(p.LastPage-1, p.Page+paginationWindow)
+	if from > 2 {
+		p.Pages = append(p.Pages, 0)
+	}
+	for page := from; page <= to; page++ {
+		p.Pages = append(p.Pages, page)
+	}
+	if to < p.LastPage-1 {
+		p.Pages = append(p.Pages, 0)
+	}
+	if p.LastPage > 1 {
+		p.Pages = append(p.Pages, p.LastPage)
+	}
+}
+
+func (p *pagination) HasPrevious() bool {
+	return p.Page > 1
+}
+
+func (p *pagination) HasNext() bool {
+	return p.Page < p.LastPage
+}
+
+func (p *pagination) Previous() int64 {
+	return max(1, p.Page-1)
+}
+
+func (p *pagination) Next() int64 {
+	return min(p.LastPage, p.Page+1)
+}
+
+// cursorPage returns the page of a cursor of previous search links or api clients.
+// Hybrid cursors contain the offset, revcat cursors are base64 encoded json with offset and size
+func cursorPage(cursor string, pageSize int64) (int64, bool) {
+	var offset int64
+	if str, ok := strings.CutPrefix(cursor, hybridCursorPrefix); ok {
+		offset = int64(parseHybridCursor(str))
+	} else {
+		data, err := base64.StdEncoding.DecodeString(cursor)
+		if err != nil {
+			return 0, false
+		}
+		crs := struct {
+			From int64 `json:"from"`
+			Size int64 `json:"size"`
+		}{}
+		if err := json.Unmarshal(data, &crs); err != nil {
+			return 0, false
+		}
+		offset = max(0, crs.From)
+	}
+	// revcat cursors of the next page start with the last hit of the current page
+	return (offset+pageSize-1)/pageSize + 1, true
+}
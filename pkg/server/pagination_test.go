@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	p, err := newPagination(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Page != 1 || p.PageSize != searchPageSizes[0] || p.first() != 0 {
+		t.Errorf("invalid default pagination %+v", p)
+	}
+	p.setTotal(0)
+	if p.LastPage != 1 || !slices.Equal(p.Pages, []int64{1}) || p.HasNext() || p.HasPrevious() {
+		t.Errorf("invalid pagination without hits %+v", p)
+	}
+
+	p, err = newPagination(7, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setTotal(2100)
+	if p.first() != 300 || p.LastPage != 42 || p.Previous() != 6 || p.Next() != 8 {
+		t.Errorf("invalid pagination %+v", p)
+	}
+	if want := []int64{1, 0, 5, 6, 7, 8, 9, 0, 42}; !slices.Equal(p.Pages, want) {
+		t.Errorf("pages are %v, want %v", p.Pages, want)
+	}
+	p, _ = newPagination(2, 100)
+	p.setTotal(50000)
+	if want := []int64{1, 2, 3, 4, 0, 100}; p.LastPage != maxResultWindow/100 || !slices.Equal(p.Pages, want) {
+		t.Errorf("pages are %v, want %v", p.Pages, want)
+	}
+
+	var qErr *QueryError
+	for _, invalid := range [][2]int64{{1, 30}, {-1, 25}, {1, -1}, {maxResultWindow/25 + 1, 25}} {
+		if _, err := newPagination(invalid[0], invalid[1]); !errors.As(err, &qErr) {
+			t.Errorf("page %d of size %d must fail: %v", invalid[0], invalid[1], err)
+		}
+	}
+
+	// cursors of previous links
+	if page, ok := cursorPage(hybridCursor(50), 25); !ok || page != 3 {
+		t.Errorf("hybrid cursor is page %d", page)
+	}
+	if page, ok := cursorPage(base64.StdEncoding.EncodeToString([]byte(`{"from":24,"size":25}`)), 25); !ok || page != 2 {
+		t.Errorf("revcat cursor is page %d", page)
+	}
+	if _, ok := cursorPage("invalid", 25); ok {
+		t.Error("invalid cursor must fail")
+	}
+}
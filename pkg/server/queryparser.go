@@ -1,59 +1,303 @@
 package server
 
 import (
+	"fmt"
+	"strings"
+
 	"emperror.dev/errors"
 	"github.com/alecthomas/participle/v2"
-	"strings"
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/je4/revcat/v2/tools/client"
 )
 
-type Property struct {
-	Key   string `@Ident ":"`
-	Value string `@String | @Ident`
+// Query is the root of the search syntax
+//
+//	author:"Doe" OR author:"Smith" -category:"x" (performance | "body art")
+//
+// AND binds stronger than OR, adjacent expressions are combined with the
+// default operator of the fulltext search.
+type Query struct {
+	Expr *OrExpr `@@?`
 }
 
-func (Property) all() {}
+type OrExpr struct {
+	And []*AndExpr `@@ ( "OR" @@ )*`
+}
 
-type String struct {
-	Value string `@String`
+type AndExpr struct {
+	Head *NotExpr   `@@`
+	Tail []*AndTerm `@@*`
 }
 
-func (String) all() {}
+type AndTerm struct {
+	Explicit bool     `@"AND"?`
+	Expr     *NotExpr `@@`
+}
 
-type All interface {
-	all()
+type NotExpr struct {
+	Negated bool     `@( "-" | "NOT" )?`
+	Operand *Operand `@@`
 }
 
-type Query struct {
-	Items []All `( @@ " "?)*`
+type Operand struct {
+	Group    *OrExpr   `  "(" @@ ")"`
+	Property *Property `| @@`
+	Term     *Term     `| @@`
 }
 
+type Property struct {
+	Key   string `@Word ":"`
+	Value string `@( String | Word )`
+}
+
+type Term struct {
+	Value string `@( String | Word )`
+}
+
+var queryLexer = lexer.MustSimple([]lexer.SimpleRule{
+	{Name: "String", Pattern: `"(?:\\.|[^"])*"`},
+	{Name: "Keyword", Pattern: `\b(?:AND|OR|NOT)\b`},
+	{Name: "Word", Pattern: `[^\s"():\-][^\s"():]*`},
+	{Name: "Punct", Pattern: `[()\-:]`},
+	{Name: "Whitespace", Pattern: `\s+`},
+})
+
 var queryPparser = participle.MustBuild[Query](
-	//participle.Unquote("String"),
-	participle.Union[All](String{}, Property{}),
+	participle.Lexer(queryLexer),
+	participle.Elide("Whitespace"),
+	participle.UseLookahead(2),
 )
 
-func parseQuery(query string) (map[string]string, string, error) {
+// QueryError is reported back to the user if the search string cannot be
+// parsed or cannot be translated into a revcat query
+type QueryError struct {
+	Query  string
+	Column int
+	Msg    string
+}
 
+func (e *QueryError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s (column %d)", e.Msg, e.Column)
+	}
+	return e.Msg
+}
+
+func parseQuery(query string) (*Query, error) {
 	result, err := queryPparser.ParseString("", query)
 	if err != nil {
-		return nil, "", errors.Wrapf(err, "cannot parse query '%s'", query)
+		qErr := &QueryError{Query: query, Msg: err.Error()}
+		var pErr participle.Error
+		if errors.As(err, &pErr) {
+			qErr.Msg = pErr.Message()
+			qErr.Column = pErr.Position().Column
+		}
+		return nil, qErr
 	}
+	return result, nil
+}
+
+// compileQuery splits the query into a fulltext part in simple_query_string syntax
+// and field filters. revcat combines all filters with AND and does not support negation,
+// so negated field values are required negations of the fulltext query, like the excluded facet values.
+// Negated field groups and OR across different fields are rejected
+func compileQuery(q *Query, fieldMapping map[string]*FieldMapping) (string, []*client.InFilter, error) {
+	cq, err := compileQueryParts(q, fieldMapping)
+	if err != nil {
+		return "", nil, err
+	}
+	return excludeQuery(cq.Text, cq.Excluded), cq.Filter, nil
+}
+
+// compiledQuery is the fulltext, the negated field values and the field filters of a query
+type compiledQuery struct {
+	Text     string
+	Excluded []string
+	Filter   []*client.InFilter
+}
+
+// compileQueryParts compiles the query like compileQuery, the negated field values are not part of the fulltext
+func compileQueryParts(q *Query, fieldMapping map[string]*FieldMapping) (*compiledQuery, error) {
+	if q == nil || q.Expr == nil {
+		return &compiledQuery{Excluded: []string{}, Filter: []*client.InFilter{}}, nil
+	}
+	qc := &queryCompiler{fieldMapping: fieldMapping, filter: []*client.InFilter{}, fields: map[string]*client.InFilter{}, excluded: []string{}}
+	text, err := qc.conjunction(q.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledQuery{Text: text, Excluded: qc.excluded, Filter: qc.filter}, nil
+}
+
+type queryCompiler struct {
+	fieldMapping map[string]*FieldMapping
+	filter       []*client.InFilter
+	// repeated fields of the top level conjunction share one filter
+	fields map[string]*client.InFilter
+	// excluded are the values of negated fields
+	excluded []string
+}
 
-	filter := map[string]string{}
-	qResult := ""
-	for _, item := range result.Items {
-		switch i := item.(type) {
-		case Property:
-			if i.Key != "" {
-				filter[i.Key] = i.Value
+// conjunction adds all field filters of expr to the filter list and returns the remaining fulltext
+func (qc *queryCompiler) conjunction(expr *OrExpr) (string, error) {
+	if len(expr.And) > 1 {
+		if !hasProperty(expr) {
+			return renderOr(expr), nil
+		}
+		f, err := qc.disjunction(expr)
+		if err != nil {
+			return "", err
+		}
+		qc.filter = append(qc.filter, f)
+		return "", nil
+	}
+	and := expr.And[0]
+	terms := append([]*AndTerm{{Expr: and.Head}}, and.Tail...)
+	var text string
+	for _, t := range terms {
+		var part string
+		switch {
+		case t.Expr.Operand.Property != nil:
+			f, err := qc.property(t.Expr.Operand.Property)
+			if err != nil {
+				return "", err
+			}
+			if t.Expr.Negated {
+				// filters cannot be negated, the value is excluded in the fulltext query
+				qc.excluded = append(qc.excluded, f.BoolTerm.Values...)
+				continue
+			}
+			if ff, ok := qc.fields[f.BoolTerm.Field]; ok {
+				ff.BoolTerm.Values = append(ff.BoolTerm.Values, f.BoolTerm.Values...)
 			} else {
-				qResult += " " + i.Value
+				qc.fields[f.BoolTerm.Field] = f
+				qc.filter = append(qc.filter, f)
+			}
+		case t.Expr.Operand.Group != nil && hasProperty(t.Expr.Operand.Group):
+			if t.Expr.Negated {
+				return "", &QueryError{Msg: "negation of field groups is not supported"}
+			}
+			var err error
+			if part, err = qc.conjunction(t.Expr.Operand.Group); err != nil {
+				return "", err
+			}
+			if part != "" && len(t.Expr.Operand.Group.And) == 1 && len(t.Expr.Operand.Group.And[0].Tail) > 0 {
+				part = "(" + part + ")"
 			}
-		case String:
-			qResult += " " + i.Value
 		default:
-			return nil, "", errors.Errorf("unknown item type %T", item)
+			part = renderNot(t.Expr)
+		}
+		if part == "" {
+			continue
 		}
+		if text != "" {
+			if t.Explicit {
+				text += " + "
+			} else {
+				text += " "
+			}
+		}
+		text += part
+	}
+	return text, nil
+}
+
+// disjunction creates a single OR filter from alternatives on the same field
+func (qc *queryCompiler) disjunction(expr *OrExpr) (*client.InFilter, error) {
+	var result *client.InFilter
+	for _, and := range expr.And {
+		var f *client.InFilter
+		switch {
+		case len(and.Tail) > 0:
+			return nil, &QueryError{Msg: "field filters cannot be combined with AND inside of OR"}
+		case and.Head.Negated:
+			return nil, &QueryError{Msg: "negation inside of OR is not supported"}
+		case and.Head.Operand.Group != nil:
+			var err error
+			if f, err = qc.disjunction(and.Head.Operand.Group); err != nil {
+				return nil, err
+			}
+		case and.Head.Operand.Property != nil:
+			var err error
+			if f, err = qc.property(and.Head.Operand.Property); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &QueryError{Msg: "fulltext and field filters cannot be combined with OR"}
+		}
+		if result == nil {
+			result = f
+			continue
+		}
+		if result.BoolTerm.Field != f.BoolTerm.Field {
+			return nil, &QueryError{Msg: fmt.Sprintf("fields '%s' and '%s' cannot be combined with OR", result.BoolTerm.Field, f.BoolTerm.Field)}
+		}
+		result.BoolTerm.Values = append(result.BoolTerm.Values, f.BoolTerm.Values...)
+	}
+	result.BoolTerm.And = false
+	return result, nil
+}
+
+func (qc *queryCompiler) property(p *Property) (*client.InFilter, error) {
+	mapping, ok := qc.fieldMapping[p.Key]
+	if !ok {
+		return nil, &QueryError{Msg: fmt.Sprintf("unknown field '%s'", p.Key)}
+	}
+	return &client.InFilter{
+		BoolTerm: &client.InFilterBoolTerm{
+			Field:  mapping.Field,
+			Values: []string{strings.Trim(p.Value, "\" ")},
+			And:    mapping.And,
+		},
+	}, nil
+}
+
+func hasProperty(expr *OrExpr) bool {
+	for _, and := range expr.And {
+		terms := append([]*AndTerm{{Expr: and.Head}}, and.Tail...)
+		for _, t := range terms {
+			if t.Expr.Operand.Property != nil {
+				return true
+			}
+			if t.Expr.Operand.Group != nil && hasProperty(t.Expr.Operand.Group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func renderOr(expr *OrExpr) string {
+	parts := []string{}
+	for _, and := range expr.And {
+		parts = append(parts, renderAnd(and))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func renderAnd(expr *AndExpr) string {
+	result := renderNot(expr.Head)
+	for _, t := range expr.Tail {
+		if t.Explicit {
+			result += " + "
+		} else {
+			result += " "
+		}
+		result += renderNot(t.Expr)
+	}
+	return result
+}
+
+func renderNot(expr *NotExpr) string {
+	var result string
+	if expr.Negated {
+		result = "-"
+	}
+	switch {
+	case expr.Operand.Group != nil:
+		result += "(" + renderOr(expr.Operand.Group) + ")"
+	case expr.Operand.Term != nil:
+		result += expr.Operand.Term.Value
 	}
-	return filter, strings.TrimSpace(qResult), nil
+	return result
 }
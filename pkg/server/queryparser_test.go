@@ -1,15 +1,90 @@
 package server
 
-import "testing"
-import "github.com/alecthomas/repr"
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/repr"
+	"github.com/je4/revcat/v2/tools/client"
+)
 
 func TestParseQuery(t *testing.T) {
 	query := "author:\"John Doe\" test  \"lorem ipsum dolor\"  test:\"blubb\" hello world"
-	filter, qStr, err := parseQuery(query)
+	result, err := parseQuery(query)
 	if err != nil {
 		t.Fatal(err)
 	}
-	repr.Println(filter)
-	repr.Println(qStr)
+	repr.Println(result)
 	//t.Logf("result: %v", result)
 }
+
+func TestCompileQuery(t *testing.T) {
+	fieldMapping := map[string]*FieldMapping{
+		"author":   {Field: "[persons].name.keyword", And: false},
+		"category": {Field: "category.keyword", And: true},
+	}
+	tests := []struct {
+		query   string
+		text    string
+		filters int
+		err     bool
+	}{
+		{query: "hello world", text: "hello world"},
+		{query: "hello AND world OR -foo", text: "hello + world | -foo"},
+		{query: "author:\"A\" OR author:\"B\"", filters: 1},
+		{query: "(author:\"A\" OR author:\"B\") (performance OR \"body art\")", text: "(performance | \"body art\")", filters: 1},
+		{query: "author:\"A\" category:x -\"lorem ipsum\"", text: "-\"lorem ipsum\"", filters: 2},
+		{query: "author:\"A\" author:\"B\" category:x category:y", filters: 2},
+		{query: "-category:\"x\"", text: "+-\"x\""},
+		{query: "hello -category:\"x\" author:\"A\"", text: "(hello) +-\"x\"", filters: 1},
+		{query: "-unknown:\"x\"", err: true},
+		{query: "-(category:\"x\" category:\"y\")", err: true},
+		{query: "author:\"A\" OR category:\"x\"", err: true},
+		{query: "unknown:\"x\"", err: true},
+		{query: "(hello", err: true},
+	}
+	for _, tc := range tests {
+		q, err := parseQuery(tc.query)
+		var text string
+		var filter []*client.InFilter
+		if err == nil {
+			text, filter, err = compileQuery(q, fieldMapping)
+		}
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: error expected", tc.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		if tc.text != "" && text != tc.text {
+			t.Errorf("%s: text '%s' != '%s'", tc.query, text, tc.text)
+		}
+		if len(filter) != tc.filters {
+			t.Errorf("%s: %d filters, expected %d", tc.query, len(filter), tc.filters)
+		}
+	}
+}
+
+func TestFieldMappingTOML(t *testing.T) {
+	var conf struct {
+		FieldMapping map[string]*FieldMapping `toml:"fieldmapping"`
+	}
+	data := "fieldmapping.author = \"[persons].name.keyword\"\nfieldmapping.category = { field = \"category.keyword\", and = false, suggest = true }\n"
+	if _, err := toml.Decode(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	if fm := conf.FieldMapping["author"]; fm == nil || fm.Field != "[persons].name.keyword" || !fm.And {
+		t.Errorf("invalid author mapping %v", fm)
+	}
+	if fm := conf.FieldMapping["category"]; fm == nil || fm.Field != "category.keyword" || fm.And || !fm.Suggest {
+		t.Errorf("invalid category mapping %v", fm)
+	}
+	// revcat cannot aggregate nested fields for the suggestions
+	if _, err := toml.Decode("fieldmapping.author = { field = \"[persons].name.keyword\", suggest = true }\n", &conf); err == nil {
+		t.Error("suggest of nested field must fail")
+	}
+}
@@ -0,0 +1,681 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/je4/zsearch/v2/pkg/translate"
+	"golang.org/x/text/language"
+)
+
+// searchParams are the parameters of the search pages and the search api
+type searchParams struct {
+	Search      string `json:"search"`
+	Collections string `json:"collections"`
+	Vocabulary  string `json:"vocabulary"`
+	Dates       string `json:"dates"`
+	BBox        string `json:"bbox"`
+	Expand      string `json:"expand"`
+	Cursor      string `json:"cursor"`
+	Page        int64  `json:"page"`
+	PageSize    int64  `json:"pageSize"`
+	Sort        string `json:"sort"`
+	SortOrder   string `json:"sortOrder"`
+	KI          bool   `json:"ki"`
+	// SortField is the former sort parameter with a field name, it is mapped to the sort option of the field
+	SortField string `json:"sortField"`
+
+	// Facets are the selected values of the term facets
+	Facets map[string][]string `json:"facets"`
+}
+
+func newSearchParams(values url.Values) *searchParams {
+	params := &searchParams{
+		Search:      values.Get("search"),
+		Collections: values.Get("collections"),
+		Vocabulary:  values.Get("vocabulary"),
+		Dates:       values.Get("dates"),
+		BBox:        values.Get("bbox"),
+		Expand:      values.Get("expand"),
+		Cursor:      values.Get("cursor"),
+		Page:        intParam(values.Get("page")),
+		PageSize:    intParam(values.Get("size")),
+		Sort:        values.Get("sort"),
+		SortOrder:   values.Get("sortOrder"),
+		KI:          values.Has("ki"),
+		SortField:   values.Get("sortField"),
+		Facets:      map[string][]string{},
+	}
+	for key, vals := range values {
+		if name, ok := strings.CutPrefix(key, facetParamPrefix); ok {
+			params.Facets[name] = vals
+		}
+	}
+	return params
+}
+
+// requestSearchParams reads the parameters from the url or from a form or json body of a POST request
+func requestSearchParams(c *gin.Context) (*searchParams, error) {
+	if c.Request.Method != http.MethodPost {
+		return newSearchParams(c.Request.URL.Query()), nil
+	}
+	if c.ContentType() == binding.MIMEJSON {
+		params := &searchParams{}
+		if err := c.ShouldBindJSON(params); err != nil {
+			return nil, errors.Wrap(err, "cannot parse json body")
+		}
+		return params, nil
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "cannot parse form")
+	}
+	return newSearchParams(c.Request.Form), nil
+}
+
+// values returns the search parameters, which are kept in search urls
+func (p *searchParams) values() url.Values {
+	values := url.Values{}
+	if p.Search != "" {
+		values.Set("search", p.Search)
+	}
+	if p.Collections != "" {
+		values.Set("collections", p.Collections)
+	}
+	if p.Vocabulary != "" {
+		values.Set("vocabulary", p.Vocabulary)
+	}
+	if p.Dates != "" {
+		values.Set("dates", p.Dates)
+	}
+	if p.BBox != "" {
+		values.Set("bbox", p.BBox)
+	}
+	if p.Expand != "" {
+		values.Set("expand", p.Expand)
+	}
+	if p.PageSize != 0 && p.PageSize != searchPageSizes[0] {
+		values.Set("size", strconv.FormatInt(p.PageSize, 10))
+	}
+	if p.Sort != "" && p.Sort != sortRelevance {
+		values.Set("sort", p.Sort)
+		if p.SortOrder != "" {
+			values.Set("sortOrder", p.SortOrder)
+		}
+	} else if p.Sort == "" && p.SortField != "" {
+		values.Set("sortField", p.SortField)
+		if p.SortOrder != "" {
+			values.Set("sortOrder", p.SortOrder)
+		}
+	}
+	for name, vals := range p.Facets {
+		for _, val := range vals {
+			if val != "" {
+				values.Add(facetParamPrefix+name, val)
+			}
+		}
+	}
+	return values
+}
+
+// intParam parses a numeric url parameter, invalid numbers are -1
+func intParam(str string) int64 {
+	if str == "" {
+		return 0
+	}
+	i, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// excludePrefix marks the excluded values of the facet parameters
+const excludePrefix = "-"
+
+// splitParam splits a comma separated list and removes empty entries
+func splitParam(str string) []string {
+	result := []string{}
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		result = append(result, part)
+	}
+	return result
+}
+
+// splitExcluded separates the selected values from the excluded ones with the exclude prefix
+func splitExcluded(values []string) (selected []string, excluded []string) {
+	selected, excluded = []string{}, []string{}
+	for _, val := range values {
+		if ex, ok := strings.CutPrefix(val, excludePrefix); ok {
+			if ex != "" {
+				excluded = append(excluded, ex)
+			}
+			continue
+		}
+		selected = append(selected, val)
+	}
+	return selected, excluded
+}
+
+func (p *searchParams) collectionIDs() (selected []int, excluded []int) {
+	selected, excluded = []int{}, []int{}
+	for _, part := range splitParam(p.Collections) {
+		ex := strings.HasPrefix(part, excludePrefix)
+		collID, err := strconv.Atoi(strings.TrimPrefix(part, excludePrefix))
+		if err != nil || collID <= 0 {
+			continue
+		}
+		if ex {
+			excluded = append(excluded, collID)
+		} else {
+			selected = append(selected, collID)
+		}
+	}
+	return selected, excluded
+}
+
+// excludeQuery adds the excluded facet values as negated phrases to the fulltext query.
+// revcat filters cannot be negated, so the phrases match the values in all fields and not only in the facet field.
+// Only values, which do not occur in free text, can be excluded exactly
+func excludeQuery(query string, values []string) string {
+	phrases := []string{}
+	for _, val := range values {
+		phrases = append(phrases, phrase(val))
+	}
+	return negateQuery(query, phrases)
+}
+
+var phraseEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// phrase quotes the value as a phrase of the fulltext query
+func phrase(value string) string {
+	return `"` + phraseEscaper.Replace(value) + `"`
+}
+
+// negateQuery adds the clauses as required negations to the fulltext query
+func negateQuery(query string, clauses []string) string {
+	if len(clauses) == 0 {
+		return query
+	}
+	if query != "" {
+		query = "(" + query + ")"
+	}
+	for _, clause := range clauses {
+		if query != "" {
+			query += " "
+		}
+		// without the plus, the negation would be optional with the default OR operator
+		query += "+-" + clause
+	}
+	return query
+}
+
+// andQuery combines two fulltext queries with AND
+func andQuery(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return "(" + a + ") + (" + b + ")"
+}
+
+type searchResult struct {
+	Result                *client.Search
+	QueryError            string
+	CollectionIDs         []int
+	ExcludedCollectionIDs []int
+	VocabularyIDs         []string
+	ExcludedVocabularyIDs []string
+	DateRanges            []string
+	// BBox restricts the search to the places inside the bounding box
+	BBox                *bbox
+	FacetValues         map[string][]string
+	ExcludedFacetValues map[string][]string
+	Expand              []string
+	// Sort is the id of the sort option, SortOrder is empty for the relevance ranking
+	Sort       string
+	SortOrder  string
+	Pagination *pagination
+
+	// prepared request for further pages
+	queryString string
+	// vectorQuery is the fulltext query of the vector search, it contains the exclusions only
+	vectorQuery string
+	// restriction is the fulltext query of the selected collections, the hits of the vector search are checked against it
+	restriction string
+	embedding   []float64
+	facets      []*client.InFacet
+	filter      []*client.InFilter
+	sort        []*client.SortField
+}
+
+// search runs the search with facets and the acl of the current user.
+// Invalid queries are reported in QueryError and do not return any results
+func (ctrl *Controller) search(c *gin.Context, params *searchParams) (*searchResult, error) {
+	sr, err := ctrl.prepareSearch(c, params)
+	if err != nil {
+		return nil, err
+	}
+	// do not show unrelated results for an invalid query
+	if sr.QueryError != "" {
+		return sr, nil
+	}
+	first, size := sr.Pagination.first(), sr.Pagination.PageSize
+	if len(sr.embedding) > 0 {
+		sr.Result, err = ctrl.hybridSearch(c, sr.queryString, sr.vectorQuery, sr.restriction, sr.embedding, sr.facets, sr.filter, first, size)
+	} else {
+		sr.Result, err = ctrl.client.Search(c, sr.queryString, sr.facets, sr.filter, nil, &first, &size, nil, sr.sort)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot search for '%s'", params.Search)
+	}
+	sr.Pagination.setTotal(sr.Result.GetSearch().GetTotalCount())
+	return sr, nil
+}
+
+// prepareSearch builds query, facets and filters of the search without running it
+func (ctrl *Controller) prepareSearch(c *gin.Context, params *searchParams) (*searchResult, error) {
+	sr := &searchResult{
+		DateRanges:          splitParam(params.Dates),
+		FacetValues:         map[string][]string{},
+		ExcludedFacetValues: map[string][]string{},
+		Expand:              splitParam(params.Expand),
+	}
+	sr.CollectionIDs, sr.ExcludedCollectionIDs = params.collectionIDs()
+	sr.VocabularyIDs, sr.ExcludedVocabularyIDs = splitExcluded(splitParam(params.Vocabulary))
+	// the excluded values of all facets except collections are part of the fulltext query
+	excludedValues := slices.Clone(sr.ExcludedVocabularyIDs)
+	for name, values := range params.Facets {
+		if fc, ok := ctrl.facetConfig(name); ok && fc.Type == facetTypeTerm {
+			sr.FacetValues[name], sr.ExcludedFacetValues[name] = splitExcluded(values)
+			if len(sr.ExcludedFacetValues[name]) > 0 && !fc.excludable() {
+				sr.QueryError = fmt.Sprintf("values of facet '%s' cannot be excluded", name)
+				sr.ExcludedFacetValues[name] = []string{}
+			}
+			excludedValues = append(excludedValues, sr.ExcludedFacetValues[name]...)
+		}
+	}
+	var queryString string
+	var queryFilter = []*client.InFilter{}
+	query, err := parseQuery(params.Search)
+	if err == nil {
+		var cq *compiledQuery
+		if cq, err = compileQueryParts(query, ctrl.fieldMapping); err == nil {
+			// negated fields are excluded like facet values
+			queryString, queryFilter = cq.Text, cq.Filter
+			excludedValues = append(excludedValues, cq.Excluded...)
+		}
+	}
+	if err != nil {
+		ctrl.logger.Info().Err(err).Msgf("invalid query '%s'", params.Search)
+		sr.QueryError = err.Error()
+	}
+
+	sel := &collectionSelection{Values: map[string][]string{}}
+	if _, ok := ctrl.facetOfType(facetTypeCollection); ok {
+		if sel, err = ctrl.collectionRegistry.selection(sr.CollectionIDs, sr.ExcludedCollectionIDs); err != nil {
+			var qErr *QueryError
+			if !errors.As(err, &qErr) {
+				return nil, errors.Wrap(err, "cannot select collections")
+			}
+			sr.QueryError = qErr.Error()
+			sel = &collectionSelection{Values: map[string][]string{}}
+		}
+	}
+
+	facets := []*client.InFacet{}
+	var dateFacet *client.InFacet
+	for _, fc := range ctrl.facets {
+		facet := fc.inFacet()
+		switch fc.Type {
+		case facetTypeCollection:
+			// the collections have a facet for each kind of identifier
+			for _, collFacet := range ctrl.collectionRegistry.facets() {
+				collFacet.Query.BoolTerm.Values = slices.Clone(sel.Values[collFacet.Term.Name])
+				facets = append(facets, collFacet)
+			}
+			continue
+		case facetTypeVocabulary:
+			facet.Query.BoolTerm.Values = slices.Clone(sr.VocabularyIDs)
+		case facetTypeDate:
+			facet.Query.BoolTerm.Values = slices.Clone(sr.DateRanges)
+			dateFacet = facet
+		default:
+			facet.Query.BoolTerm.Values = slices.Clone(sr.FacetValues[fc.Name])
+		}
+		facets = append(facets, facet)
+	}
+
+	sortOption, sortOrder, err := ctrl.searchSortOption(params)
+	if err != nil {
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			return nil, errors.Wrap(err, "cannot select sort option")
+		}
+		sr.QueryError = qErr.Error()
+		sortOption, sortOrder, _ = ctrl.sortOption(sortRelevance, "")
+	}
+	sr.Sort = sortOption.ID
+	sr.SortOrder = sortOrder
+
+	page := params.Page
+	if page == 0 && params.Cursor != "" && params.PageSize >= 0 {
+		pageSize := params.PageSize
+		if pageSize == 0 {
+			pageSize = searchPageSizes[0]
+		}
+		page, _ = cursorPage(params.Cursor, pageSize)
+	}
+	if sr.Pagination, err = newPagination(page, params.PageSize); err != nil {
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			return nil, errors.Wrap(err, "cannot select page")
+		}
+		sr.QueryError = qErr.Error()
+		sr.Pagination, _ = newPagination(1, 0)
+	}
+
+	var embedding64 = []float64{}
+	// field filters are not part of the embedding, without fulltext there is nothing to embed.
+	// The ki ranking is a relevance ranking, it is not used for the other sort options
+	if params.KI && ctrl.embeddings != nil && queryString != "" && sr.QueryError == "" && sortOption.IsRelevance() {
+		embedding64, err = ctrl.embeddings.CreateEmbedding(c, queryString)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create embedding for '%s'", queryString)
+		}
+	}
+	excludedValues = append(excludedValues, sel.ExcludedPhrases...)
+	queryString = andQuery(queryString, sel.Query)
+	queryString = negateQuery(excludeQuery(queryString, excludedValues), sel.ExcludedClauses)
+	// the negations alone match all records with the same score, so they do not change the ranking of the vector search
+	vectorQuery := negateQuery(excludeQuery("", excludedValues), sel.ExcludedClauses)
+	user := GetUser(c)
+	filter := []*client.InFilter{
+		{
+			ExistsTerm: &client.InFilterExistsTerm{
+				Field: "poster",
+			},
+		},
+		{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  "acl.content.keyword",
+				Values: user.Groups,
+			},
+		},
+	}
+	filter = append(filter, queryFilter...)
+	filter = append(filter, sel.Filter...)
+	if params.BBox != "" && sr.QueryError == "" {
+		if sr.BBox, err = parseBBox(params.BBox); err != nil {
+			sr.QueryError = err.Error()
+		} else {
+			placeFilter, err := ctrl.bboxFilter(c, user.Groups, sr.BBox)
+			if err != nil {
+				var qErr *QueryError
+				if !errors.As(err, &qErr) {
+					return nil, errors.Wrapf(err, "cannot resolve bounding box '%s'", params.BBox)
+				}
+				sr.QueryError = qErr.Error()
+			} else {
+				filter = append(filter, placeFilter)
+			}
+		}
+	}
+	if sr.QueryError == "" {
+		dateFilters := append(slices.Clone(queryFilter), sel.Filter...)
+		if dateFacet != nil {
+			dateFilters = append(dateFilters, dateFacet.Query)
+		}
+		added, err := ctrl.resolveDateRanges(c, user.Groups, dateFilters...)
+		if err != nil {
+			var qErr *QueryError
+			if !errors.As(err, &qErr) {
+				return nil, errors.Wrapf(err, "cannot resolve date ranges of '%s'", params.Search)
+			}
+			sr.QueryError = qErr.Error()
+		}
+		filter = append(filter, added...)
+	}
+	sr.queryString = queryString
+	sr.vectorQuery = vectorQuery
+	sr.restriction = sel.Query
+	sr.embedding = embedding64
+	sr.facets = facets
+	sr.filter = filter
+	sr.sort = sortOption.sort(sortOrder)
+	return sr, nil
+}
+
+// maxResultWindow is the maximum offset of the elastic search backend
+const maxResultWindow = 10000
+
+const allPageSize = 200
+
+// searchAll calls fn for all hits of the prepared search of sr, page by page, together with the total count of hits.
+// The pages are searched without aggregations, the selected facet values are applied as filters.
+// Only the first maxResultWindow hits are returned, fn can compare the total count to detect a truncated result
+func (ctrl *Controller) searchAll(ctx context.Context, sr *searchResult, fn func(edges []*client.Search_Search_Edges, total int64) error) error {
+	if sr.QueryError != "" {
+		return nil
+	}
+	filter := sr.resultFilter()
+	if len(sr.embedding) > 0 {
+		// the fused hits of both searches are complete after one hybrid search
+		result, err := ctrl.hybridSearch(ctx, sr.queryString, sr.vectorQuery, sr.restriction, sr.embedding, nil, filter, 0, 2*ctrl.hybridWindow)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return fn(result.GetSearch().GetEdges(), result.GetSearch().GetTotalCount())
+	}
+	var size int64 = allPageSize
+	for first := int64(0); first < maxResultWindow; first += size {
+		size = min(size, maxResultWindow-first)
+		result, err := ctrl.client.Search(ctx, sr.queryString, nil, filter, nil, &first, &size, nil, sr.sort)
+		if err != nil {
+			return errors.Wrapf(err, "cannot search for '%s'", sr.queryString)
+		}
+		edges := result.GetSearch().GetEdges()
+		total := result.GetSearch().GetTotalCount()
+		if err := fn(edges, total); err != nil {
+			return err
+		}
+		if int64(len(edges)) < size || first+size >= total {
+			return nil
+		}
+	}
+	return nil
+}
+
+// resultFilter returns the filters of the search including the selected facet values.
+// Aggregations over the hits of the search need them, revcat applies the facet queries to the search only
+func (sr *searchResult) resultFilter() []*client.InFilter {
+	filter := slices.Clone(sr.filter)
+	for _, facet := range sr.facets {
+		if facet.Query != nil && facet.Query.BoolTerm != nil && len(facet.Query.BoolTerm.Values) > 0 {
+			filter = append(filter, facet.Query)
+		}
+	}
+	return filter
+}
+
+func (sr *searchResult) pageInfo() *client.PageInfoFragment {
+	pageInfo := sr.Result.GetSearch().GetPageInfo()
+	if pageInfo == nil {
+		pageInfo = &client.PageInfoFragment{}
+	}
+	return pageInfo
+}
+
+type searchEdge struct {
+	Edge             *client.Search_Search_Edges `json:"edge"`
+	Title            *translate.MultiLangString  `json:"title"`
+	Persons          string                      `json:"persons"`
+	Type             string                      `json:"type"`
+	Date             string                      `json:"date"`
+	PersonRole       map[string][]string         `json:"personRole"`
+	ShowContent      bool                        `json:"-"`
+	ProtectedContent bool                        `json:"-"`
+}
+
+func newSearchEdge(e *client.Search_Search_Edges) *searchEdge {
+	ne := &searchEdge{
+		Edge:       e,
+		Title:      &translate.MultiLangString{},
+		Type:       emptyIfNil(e.Base.GetType()),
+		Date:       emptyIfNil(e.Base.GetDate()),
+		PersonRole: map[string][]string{},
+		//ShowContent:      false,
+		//ProtectedContent: false,
+	}
+	for _, t := range e.Base.GetTitle() {
+		ne.Title.Set(t.Value, language.MustParse(t.Lang), t.Translated)
+	}
+	var firstPerson string
+	for _, p := range e.Base.GetPerson() {
+		if firstPerson == "" {
+			firstPerson = p.GetName()
+		}
+		if ne.Persons != "" {
+			ne.Persons += "; "
+		}
+		ne.Persons += p.GetName()
+		var role = "author"
+		if p.GetRole() != nil {
+			role = *p.GetRole()
+		}
+		if _, ok := ne.PersonRole[role]; !ok {
+			ne.PersonRole[role] = []string{}
+		}
+		ne.PersonRole[role] = append(ne.PersonRole[role], p.GetName())
+	}
+	if len(ne.Persons) > 30 && len(e.Base.GetPerson()) > 1 {
+		ne.Persons = firstPerson + " et al."
+	}
+	return ne
+}
+
+type collFacetType struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Checked  bool   `json:"checked"`
+	Excluded bool   `json:"excluded"`
+}
+
+type termFacetType struct {
+	Value    string `json:"value"`
+	Count    int    `json:"count"`
+	Checked  bool   `json:"checked"`
+	Excluded bool   `json:"excluded"`
+}
+
+// facetType is a configured facet in display order.
+// Only term facets carry their values, the others are in the specific lists of searchFacets
+type facetType struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Label  string           `json:"label"`
+	Param  string           `json:"param"`
+	Values []*termFacetType `json:"values,omitempty"`
+	// Excludable is true, if the values can be excluded from the search
+	Excludable bool `json:"excludable"`
+}
+
+type searchFacets struct {
+	Facets            []*facetType     `json:"facets"`
+	CollectionFacets  []*collFacetType `json:"collectionFacets"`
+	VocabularyFacets  []*vocNode       `json:"vocabularyFacets"`
+	VocabularyChecked []*vocNode       `json:"vocabularyChecked"`
+	DateFacets        []*dateFacetType `json:"dateFacets"`
+}
+
+func (ctrl *Controller) searchFacets(sr *searchResult, lang string) *searchFacets {
+	result := &searchFacets{
+		Facets:            []*facetType{},
+		CollectionFacets:  []*collFacetType{},
+		VocabularyFacets:  []*vocNode{},
+		VocabularyChecked: []*vocNode{},
+		DateFacets:        []*dateFacetType{},
+	}
+	if _, ok := ctrl.facetOfType(facetTypeCollection); ok {
+		result.CollectionFacets = ctrl.collectionRegistry.collFacets(sr.Result.GetSearch().GetFacets(), sr.CollectionIDs, sr.ExcludedCollectionIDs)
+	}
+	termValues := map[string][]*termFacetType{}
+	for _, facet := range sr.Result.GetSearch().GetFacets() {
+		fc, ok := ctrl.facetConfig(facet.GetName())
+		if !ok {
+			continue
+		}
+		switch fc.Type {
+		case facetTypeTerm:
+			termValues[fc.Name] = []*termFacetType{}
+			for _, val := range facet.GetValues() {
+				strVal := val.GetFacetValueString()
+				if strVal == nil || fc.excluded(strVal.GetStrVal()) {
+					continue
+				}
+				termValues[fc.Name] = append(termValues[fc.Name], &termFacetType{
+					Value:   strVal.GetStrVal(),
+					Count:   int(strVal.GetCount()),
+					Checked: slices.Contains(sr.FacetValues[fc.Name], strVal.GetStrVal()),
+				})
+			}
+			// excluded values are not part of the result anymore
+			for _, val := range sr.ExcludedFacetValues[fc.Name] {
+				termValues[fc.Name] = append(termValues[fc.Name], &termFacetType{Value: val, Excluded: true})
+			}
+		case facetTypeVocabulary:
+			vocCounts := map[string]int{}
+			for _, val := range facet.GetValues() {
+				strVal := val.GetFacetValueString()
+				if strVal == nil || fc.excluded(strVal.GetStrVal()) {
+					continue
+				}
+				vocCounts[strVal.GetStrVal()] = int(strVal.GetCount())
+			}
+			result.VocabularyFacets = buildVocTree(vocCounts, sr.VocabularyIDs, sr.ExcludedVocabularyIDs, sr.Expand, func(key string) string {
+				return ctrl.localize(key, lang)
+			})
+			result.VocabularyChecked = checkedVocNodes(result.VocabularyFacets)
+		case facetTypeDate:
+			dateCounts := map[string]int64{}
+			for _, val := range facet.GetValues() {
+				if strVal := val.GetFacetValueString(); strVal != nil && !fc.excluded(strVal.GetStrVal()) {
+					dateCounts[strVal.GetStrVal()] = strVal.GetCount()
+				}
+			}
+			result.DateFacets = decadeHistogram(dateCounts, sr.DateRanges)
+		}
+	}
+	for _, fc := range ctrl.facets {
+		ft := &facetType{
+			Name:       fc.Name,
+			Type:       fc.Type,
+			Label:      fc.Label,
+			Param:      fc.Param(),
+			Excludable: fc.excludable(),
+		}
+		if fc.Type == facetTypeTerm {
+			ft.Values = termValues[fc.Name]
+			if ft.Values == nil {
+				ft.Values = []*termFacetType{}
+			}
+		}
+		result.Facets = append(result.Facets, ft)
+	}
+	return result
+}
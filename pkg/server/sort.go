@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/revcat/v2/tools/client"
+)
+
+// sortRelevance is the sort option without fields, which keeps the ranking of the search
+const sortRelevance = "relevance"
+
+const (
+	sortOrderAsc  = "asc"
+	sortOrderDesc = "desc"
+)
+
+// sortFieldRegexp matches the field names accepted by revcat
+var sortFieldRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+
+// SortOption is a sort order of the search pages, which is selected by ID with the url parameter sort.
+// The hits are sorted by Fields one after another. A field with suffix :asc or :desc has its own order, otherwise Order is used.
+// The url parameter sortOrder with the opposite of Order reverses all fields.
+// Label is the i18n key of the option. The option without fields is the relevance ranking
+type SortOption struct {
+	ID     string   `toml:"id" json:"id"`
+	Fields []string `toml:"fields" json:"fields"`
+	Order  string   `toml:"order" json:"order"`
+	Label  string   `toml:"label" json:"label"`
+
+	sortFields []*client.SortField
+}
+
+// DefaultSortOptions are the sort options of the search pages without sort configuration
+func DefaultSortOptions() []*SortOption {
+	return []*SortOption{
+		{ID: sortRelevance, Label: "relevance"},
+		{ID: "signature", Fields: []string{"signature.keyword"}, Order: sortOrderAsc, Label: "signature"},
+		{ID: "year", Fields: []string{"date.keyword", "signature.keyword:asc"}, Order: sortOrderDesc, Label: "year"},
+	}
+}
+
+// IsRelevance is true for the option without fields
+func (so *SortOption) IsRelevance() bool {
+	return len(so.sortFields) == 0
+}
+
+// sort returns the revcat sort fields in the given order, an empty order is the default order
+func (so *SortOption) sort(order string) []*client.SortField {
+	result := []*client.SortField{}
+	for _, sf := range so.sortFields {
+		fieldOrder := sf.Order
+		if order != "" && order != so.Order {
+			fieldOrder = oppositeSortOrder(fieldOrder)
+		}
+		result = append(result, &client.SortField{Field: sf.Field, Order: fieldOrder})
+	}
+	return result
+}
+
+func oppositeSortOrder(order string) string {
+	if order == sortOrderDesc {
+		return sortOrderAsc
+	}
+	return sortOrderDesc
+}
+
+// initSortOptions checks the sort options and parses their fields.
+// The relevance option is the default of all search pages, it is added in front if it is missing
+func initSortOptions(options []*SortOption) ([]*SortOption, error) {
+	result := []*SortOption{}
+	ids := map[string]bool{}
+	var relevance bool
+	for _, so := range options {
+		if so.ID == "" {
+			return nil, errors.Errorf("sort option without id: %+v", so)
+		}
+		if ids[so.ID] {
+			return nil, errors.Errorf("duplicate sort option '%s'", so.ID)
+		}
+		ids[so.ID] = true
+		if so.Label == "" {
+			so.Label = so.ID
+		}
+		if so.Order == "" {
+			so.Order = sortOrderAsc
+		}
+		if so.Order != sortOrderAsc && so.Order != sortOrderDesc {
+			return nil, errors.Errorf("invalid order '%s' of sort option '%s'", so.Order, so.ID)
+		}
+		so.sortFields = []*client.SortField{}
+		for _, field := range so.Fields {
+			name, order, ok := strings.Cut(field, ":")
+			if !ok {
+				order = so.Order
+			}
+			if !sortFieldRegexp.MatchString(name) {
+				return nil, errors.Errorf("invalid field '%s' of sort option '%s'", name, so.ID)
+			}
+			if order != sortOrderAsc && order != sortOrderDesc {
+				return nil, errors.Errorf("invalid order '%s' of field '%s' of sort option '%s'", order, name, so.ID)
+			}
+			so.sortFields = append(so.sortFields, &client.SortField{Field: name, Order: order})
+		}
+		if so.IsRelevance() {
+			if relevance {
+				return nil, errors.Errorf("more than one sort option without fields")
+			}
+			relevance = true
+			if so.ID != sortRelevance {
+				return nil, errors.Errorf("sort option '%s' without fields must have the id '%s'", so.ID, sortRelevance)
+			}
+		} else if so.ID == sortRelevance {
+			return nil, errors.Errorf("sort option '%s' must not have fields", sortRelevance)
+		}
+		result = append(result, so)
+	}
+	if !relevance {
+		result = append([]*SortOption{{ID: sortRelevance, Label: sortRelevance, Order: sortOrderAsc, sortFields: []*client.SortField{}}}, result...)
+	}
+	return result, nil
+}
+
+// sortFieldOption returns the id of the sort option for the former parameter sortField,
+// which is the option sorting by the field first. Fields without option are reported as QueryError
+func (ctrl *Controller) sortFieldOption(field string) (string, error) {
+	for _, so := range ctrl.sortOptions {
+		if !so.IsRelevance() && so.sortFields[0].Field == field {
+			return so.ID, nil
+		}
+	}
+	return "", &QueryError{Msg: fmt.Sprintf("unknown sort field '%s'", field)}
+}
+
+// searchSortOption returns the sort option of the search parameters, sortField is used without sort parameter
+func (ctrl *Controller) searchSortOption(params *searchParams) (*SortOption, string, error) {
+	id := params.Sort
+	if id == "" && params.SortField != "" {
+		var err error
+		if id, err = ctrl.sortFieldOption(params.SortField); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	}
+	return ctrl.sortOption(id, params.SortOrder)
+}
+
+// sortOption returns the option of the sort parameters, the relevance option if there is no sort parameter.
+// Unknown options and orders are reported as QueryError
+func (ctrl *Controller) sortOption(id, order string) (*SortOption, string, error) {
+	if id == "" {
+		id = sortRelevance
+	}
+	if order != "" && order != sortOrderAsc && order != sortOrderDesc {
+		return nil, "", &QueryError{Msg: fmt.Sprintf("unknown sort order '%s'", order)}
+	}
+	for _, so := range ctrl.sortOptions {
+		if so.ID != id {
+			continue
+		}
+		if so.IsRelevance() {
+			return so, "", nil
+		}
+		if order == "" {
+			order = so.Order
+		}
+		return so, order, nil
+	}
+	return nil, "", &QueryError{Msg: fmt.Sprintf("unknown sort option '%s'", id)}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSortOptions(t *testing.T) {
+	options, err := initSortOptions([]*SortOption{
+		{ID: "year", Fields: []string{"date.keyword", "signature.keyword:asc"}, Order: sortOrderDesc, Label: "year"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options) != 2 || options[0].ID != sortRelevance || !options[0].IsRelevance() {
+		t.Fatalf("relevance must be the first option: %+v", options)
+	}
+	ctrl := &Controller{sortOptions: options}
+
+	so, order, err := ctrl.sortOption("", "asc")
+	if err != nil || so.ID != sortRelevance || order != "" || len(so.sort(order)) != 0 {
+		t.Errorf("relevance must be the default without sort fields: %v %s %v", so, order, err)
+	}
+	so, order, err = ctrl.sortOption("year", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sort := so.sort(order); order != sortOrderDesc || sort[0].Order != sortOrderDesc || sort[1].Order != sortOrderAsc {
+		t.Errorf("invalid default order %s of %+v", order, sort)
+	}
+	// the opposite order reverses all fields
+	if sort := so.sort(sortOrderAsc); sort[0].Field != "date.keyword" || sort[0].Order != sortOrderAsc || sort[1].Order != sortOrderDesc {
+		t.Errorf("invalid reversed order %+v", sort)
+	}
+
+	var qErr *QueryError
+	if _, _, err := ctrl.sortOption("signature.keyword", ""); !errors.As(err, &qErr) {
+		t.Errorf("unknown sort option must fail: %v", err)
+	}
+	if _, _, err := ctrl.sortOption("year", "up"); !errors.As(err, &qErr) {
+		t.Errorf("unknown sort order must fail: %v", err)
+	}
+
+	// the former parameter sortField selects the option of the field
+	params := newSearchParams(url.Values{"sortField": {"date.keyword"}, "sortOrder": {"asc"}})
+	if so, order, err := ctrl.searchSortOption(params); err != nil || so.ID != "year" || order != sortOrderAsc {
+		t.Errorf("sortField: %v %s: %v", so, order, err)
+	}
+	if values := params.values(); values.Get("sortField") != "date.keyword" || values.Get("sortOrder") != "asc" {
+		t.Errorf("sortField must be kept in search urls: %v", values)
+	}
+	if _, _, err := ctrl.searchSortOption(&searchParams{SortField: "title.keyword"}); !errors.As(err, &qErr) {
+		t.Errorf("unknown sort field must fail: %v", err)
+	}
+	if so, _, err := ctrl.searchSortOption(&searchParams{Sort: sortRelevance, SortField: "date.keyword"}); err != nil || !so.IsRelevance() {
+		t.Errorf("sort must have priority over sortField: %v %v", so, err)
+	}
+
+	for _, invalid := range [][]*SortOption{
+		{{ID: "title", Fields: []string{"title.keyword"}}, {ID: "title", Fields: []string{"title.keyword"}}},
+		{{ID: "script", Fields: []string{"doc['date']"}}},
+		{{ID: "date", Fields: []string{"date.keyword:up"}}},
+		{{ID: "none"}},
+	} {
+		if _, err := initSortOptions(invalid); err == nil {
+			t.Errorf("invalid sort options %+v must fail", invalid[len(invalid)-1])
+		}
+	}
+}
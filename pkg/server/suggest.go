@@ -0,0 +1,221 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const suggestSize = 10
+
+const suggestMinLength = 2
+
+const titleField = "title.keyword"
+
+const vocabularyField = "tags.keyword"
+
+// titles are stored as "text ::ger" or "text ::t:eng"
+var titleLangRegexp = regexp.MustCompile(` ::(?:t:)?[a-z]{3}$`)
+
+type suggestion struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Label  string `json:"label"`
+	Count  int64  `json:"count"`
+	Insert string `json:"insert"`
+}
+
+// prefixRegexp creates a case insensitive lucene regexp, which matches terms with a word starting with prefix
+func prefixRegexp(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString("(.*[ ,(])?")
+	for _, r := range prefix {
+		lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+		switch {
+		case lower != upper:
+			fmt.Fprintf(&sb, "[%c%c]", lower, upper)
+		case strings.ContainsRune(`.?+*|{}[]()"\#@&<>~`, r):
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteString(".*")
+	return sb.String()
+}
+
+// hasWordPrefix is the go counterpart of prefixRegexp
+func hasWordPrefix(str, prefix string) bool {
+	str = strings.ToLower(str)
+	prefix = strings.ToLower(prefix)
+	for {
+		if strings.HasPrefix(str, prefix) {
+			return true
+		}
+		pos := strings.IndexAny(str, " ,(")
+		if pos < 0 {
+			return false
+		}
+		str = str[pos+1:]
+	}
+}
+
+func quoteValue(value string) string {
+	return "\"" + strings.ReplaceAll(value, "\"", "") + "\""
+}
+
+// suggestFacet aggregates the values of field like the facets of the search pages
+func suggestFacet(name, field string, include []string) *client.InFacet {
+	return &client.InFacet{
+		Term: &client.InFacetTerm{
+			Name:        name,
+			Field:       aggregationField(field),
+			Size:        suggestSize,
+			MinDocCount: 1,
+			Include:     include,
+			Exclude:     []string{},
+		},
+		Query: &client.InFilter{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  field,
+				Values: []string{},
+			},
+		},
+	}
+}
+
+// suggest returns prefix matches of the mapped fields with suggest enabled, the vocabulary and the titles.
+// Vocabulary is matched against the localized labels, which are unknown to revcat. Only the most frequent tags
+// up to the size of the vocabulary facet are matched. Nested fields are skipped, revcat cannot aggregate them
+func (ctrl *Controller) suggest(c *gin.Context) {
+	var lang = c.Param("lang")
+	if !ctrl.langAvailable(lang) {
+		lang = "de"
+	}
+	prefix := strings.TrimSpace(strings.Trim(c.Query("q"), "\""))
+	result := []*suggestion{}
+	if len([]rune(prefix)) < suggestMinLength {
+		ctrl.writeSuggestions(c, result)
+		return
+	}
+	pattern := prefixRegexp(prefix)
+	keys := []string{}
+	facets := []*client.InFacet{}
+	for key, mapping := range ctrl.fieldMapping {
+		if !mapping.Suggest || aggregationField(mapping.Field) != mapping.Field {
+			continue
+		}
+		keys = append(keys, key)
+		if mapping.Field == vocabularyField {
+			facet := suggestFacet(key, mapping.Field, []string{})
+			facet.Term.Size = facetDefaultSize[facetTypeVocabulary]
+			if fc, ok := ctrl.facetOfType(facetTypeVocabulary); ok {
+				vocFacet := fc.inFacet()
+				facet.Term.Include, facet.Term.Size = vocFacet.Term.Include, vocFacet.Term.Size
+			}
+			facets = append(facets, facet)
+			continue
+		}
+		facets = append(facets, suggestFacet(key, mapping.Field, []string{pattern}))
+	}
+	slices.Sort(keys)
+	facets = append(facets, suggestFacet(titleField, titleField, []string{pattern}))
+
+	user := GetUser(c)
+	filter := []*client.InFilter{
+		{
+			ExistsTerm: &client.InFilterExistsTerm{
+				Field: "poster",
+			},
+		},
+		{
+			BoolTerm: &client.InFilterBoolTerm{
+				Field:  "acl.content.keyword",
+				Values: user.Groups,
+			},
+		},
+	}
+	var size int64 = 0
+	searchResult, err := ctrl.client.Search(c, "", facets, filter, nil, nil, &size, nil, nil)
+	if err != nil {
+		ctrl.logger.Error().Err(err).Msgf("cannot get suggestions for '%s'", prefix)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, fmt.Sprintf("cannot get suggestions for '%s': %v", prefix, err))
+		return
+	}
+	values := map[string][]*client.FacetValueStringFragment{}
+	for _, facet := range searchResult.GetSearch().GetFacets() {
+		for _, val := range facet.GetValues() {
+			if strVal := val.GetFacetValueString(); strVal != nil {
+				values[facet.GetName()] = append(values[facet.GetName()], strVal)
+			}
+		}
+	}
+
+	localizer := i18n.NewLocalizer(ctrl.bundle, lang)
+	for _, key := range append(keys, titleField) {
+		var num int
+		for _, val := range values[key] {
+			if num >= suggestSize {
+				break
+			}
+			str := val.GetStrVal()
+			s := &suggestion{
+				Field: key,
+				Value: str,
+				Label: str,
+				Count: val.GetCount(),
+			}
+			switch {
+			case key == titleField:
+				s.Field = ""
+				s.Label = titleLangRegexp.ReplaceAllString(str, "")
+				s.Value = s.Label
+				s.Insert = quoteValue(s.Label)
+			case ctrl.fieldMapping[key].Field == vocabularyField:
+				if fc, ok := ctrl.facetOfType(facetTypeVocabulary); ok && fc.excluded(str) {
+					continue
+				}
+				parts := strings.Split(str, ":")
+				label, err := localizer.LocalizeMessage(&i18n.Message{ID: parts[len(parts)-1]})
+				if err != nil {
+					label = parts[len(parts)-1]
+				}
+				if !hasWordPrefix(label, prefix) {
+					continue
+				}
+				s.Label = label
+				s.Insert = key + ":" + quoteValue(str)
+			default:
+				s.Insert = key + ":" + quoteValue(str)
+			}
+			if slices.ContainsFunc(result, func(r *suggestion) bool { return r.Insert == s.Insert }) {
+				continue
+			}
+			result = append(result, s)
+			num++
+		}
+	}
+	ctrl.writeSuggestions(c, result)
+}
+
+// writeSuggestions writes the suggestions as json or in the opensearch suggestions format ([query, [completions]])
+func (ctrl *Controller) writeSuggestions(c *gin.Context, result []*suggestion) {
+	if c.Query("format") != "opensearch" {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	completions := []string{}
+	for _, s := range result {
+		completions = append(completions, s.Insert)
+	}
+	c.Header("Content-Type", "application/x-suggestions+json; charset=utf-8")
+	c.JSON(http.StatusOK, []any{c.Query("q"), completions})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Yamashou/gqlgenc/clientv2"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/revcat/v2/tools/client"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// testSearch is a search request to the testClient
+type testSearch struct {
+	Query  string
+	Facets []*client.InFacet
+	Filter []*client.InFilter
+	Vector []float64
+	First  *int64
+	Size   *int64
+	Cursor *string
+	Sort   []*client.SortField
+}
+
+// testClient answers revcat requests with the given functions and records the searches
+type testClient struct {
+	entries func(signatures []string) (*client.MediathekEntries, error)
+	search  func(req *testSearch) (*client.Search, error)
+
+	mutex    sync.Mutex
+	searches []*testSearch
+}
+
+func (tc *testClient) MediathekEntries(ctx context.Context, signatures []string, interceptors ...clientv2.RequestInterceptor) (*client.MediathekEntries, error) {
+	if tc.entries == nil {
+		return &client.MediathekEntries{}, nil
+	}
+	return tc.entries(signatures)
+}
+
+func (tc *testClient) Search(ctx context.Context, query string, facets []*client.InFacet, filter []*client.InFilter, vector []float64, first *int64, size *int64, cursor *string, sort []*client.SortField, interceptors ...clientv2.RequestInterceptor) (*client.Search, error) {
+	req := &testSearch{Query: query, Facets: facets, Filter: filter, Vector: vector, First: first, Size: size, Cursor: cursor, Sort: sort}
+	tc.mutex.Lock()
+	tc.searches = append(tc.searches, req)
+	tc.mutex.Unlock()
+	if tc.search == nil {
+		return &client.Search{}, nil
+	}
+	return tc.search(req)
+}
+
+// testRequest runs handler with the url parameters params
+func testRequest(handler gin.HandlerFunc, req *http.Request, params ...gin.Param) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = params
+	handler(c)
+	return w
+}
+
+func TestPrefixRegexp(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"do":   "(.*[ ,(])?[dD][oO].*",
+		"c.f":  "(.*[ ,(])?[cC]\\.[fF].*",
+		"20 ü": "(.*[ ,(])?20 [üÜ].*",
+	} {
+		if got := prefixRegexp(prefix); got != want {
+			t.Errorf("prefixRegexp(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestHasWordPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		str, prefix string
+		want        bool
+	}{
+		{"Doe, John", "do", true},
+		{"Doe, John", "jo", true},
+		{"Doe, John", "oh", false},
+		{"Körper (Bewegung)", "bew", true},
+	} {
+		if got := hasWordPrefix(tc.str, tc.prefix); got != tc.want {
+			t.Errorf("hasWordPrefix(%q, %q) = %v, want %v", tc.str, tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestSuggestNestedField(t *testing.T) {
+	tc := &testClient{search: func(req *testSearch) (*client.Search, error) {
+		return &client.Search{}, nil
+	}}
+	bundle := i18n.NewBundle(language.German)
+	bundle.AddMessages(language.German, &i18n.Message{ID: "de", Other: "Deutsch"})
+	ctrl := &Controller{
+		client:       tc,
+		bundle:       bundle,
+		fieldMapping: map[string]*FieldMapping{"person": {Field: "[persons].name.keyword", Suggest: true}},
+	}
+	w := testRequest(ctrl.suggest, httptest.NewRequest(http.MethodGet, "/suggest/de?q=do", nil), gin.Param{Key: "lang", Value: "de"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(tc.searches) != 1 {
+		t.Fatalf("%d searches", len(tc.searches))
+	}
+	// revcat cannot aggregate nested fields, a plain aggregation would not return any value
+	for _, facet := range tc.searches[0].Facets {
+		if facet.Term.Name == "person" {
+			t.Errorf("nested field %s is aggregated", facet.Query.BoolTerm.Field)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"emperror.dev/errors"
+)
+
+// timelineMaxYears is the largest span of years, which is shown year by year instead of in decades
+const timelineMaxYears = 30
+
+// timelineBucket is a year or decade of the timeline.
+// Count is the number of hits of all pages, Edges are the hits of the current page.
+// Value is the date range of the dates parameter, it is empty without date facet
+type timelineBucket struct {
+	Label  string        `json:"label"`
+	From   int           `json:"from"`
+	To     int           `json:"to"`
+	Value  string        `json:"value"`
+	Count  int           `json:"count"`
+	Height int           `json:"height"`
+	Edges  []*searchEdge `json:"edges"`
+}
+
+// timeline groups the hits of a search chronologically by the year of their free form date.
+// The hits without year are collected in Undated
+type timeline struct {
+	Decades bool              `json:"decades"`
+	Buckets []*timelineBucket `json:"buckets"`
+	Undated *timelineBucket   `json:"undated,omitempty"`
+}
+
+// newTimeline creates the buckets from the date counts of the search and the hits of the current page
+func newTimeline(counts map[string]int, edges []*searchEdge, dateFacet bool) *timeline {
+	years := map[int]int{}
+	var undated int
+	for date, count := range counts {
+		if year, ok := parseYear(date); ok {
+			years[year] += count
+		} else {
+			undated += count
+		}
+	}
+	edgeYears := map[*searchEdge]int{}
+	for _, e := range edges {
+		if year, ok := parseYear(e.Date); ok {
+			edgeYears[e] = year
+			if _, ok := years[year]; !ok {
+				years[year] = 0
+			}
+		}
+	}
+	tl := &timeline{Buckets: []*timelineBucket{}}
+	if len(years) > 0 {
+		var minYear, maxYear = 9999, 0
+		for year := range years {
+			minYear = min(minYear, year)
+			maxYear = max(maxYear, year)
+		}
+		tl.Decades = maxYear-minYear >= timelineMaxYears
+	}
+
+	buckets := map[int]*timelineBucket{}
+	bucket := func(year int) *timelineBucket {
+		from, to := year, year
+		if tl.Decades {
+			from = year - year%10
+			to = from + 9
+		}
+		b, ok := buckets[from]
+		if !ok {
+			b = &timelineBucket{From: from, To: to, Label: fmt.Sprintf("%d", from), Edges: []*searchEdge{}}
+			if tl.Decades {
+				b.Label = fmt.Sprintf("%d–%d", from, to)
+			}
+			if dateFacet {
+				b.Value = fmt.Sprintf("%d..%d", from, to)
+			}
+			buckets[from] = b
+			tl.Buckets = append(tl.Buckets, b)
+		}
+		return b
+	}
+	for year, count := range years {
+		bucket(year).Count += count
+	}
+	for _, e := range edges {
+		if year, ok := edgeYears[e]; ok {
+			b := bucket(year)
+			b.Edges = append(b.Edges, e)
+			continue
+		}
+		if tl.Undated == nil {
+			tl.Undated = &timelineBucket{Edges: []*searchEdge{}}
+		}
+		tl.Undated.Edges = append(tl.Undated.Edges, e)
+	}
+	if undated > 0 && tl.Undated == nil {
+		tl.Undated = &timelineBucket{Edges: []*searchEdge{}}
+	}
+	slices.SortFunc(tl.Buckets, func(a, b *timelineBucket) int {
+		return a.From - b.From
+	})
+
+	// the counts of the search contain the hits of the page, unless there is no date field
+	var maxCount int
+	for _, b := range tl.Buckets {
+		b.Count = max(b.Count, len(b.Edges))
+		maxCount = max(maxCount, b.Count)
+	}
+	for _, b := range tl.Buckets {
+		b.Height = max(1, b.Count*100/maxCount)
+	}
+	if tl.Undated != nil {
+		tl.Undated.Count = max(undated, len(tl.Undated.Edges))
+	}
+	return tl
+}
+
+// searchTimeline aggregates the dates of all hits of the search
+func (ctrl *Controller) searchTimeline(ctx context.Context, sr *searchResult, edges []*searchEdge) (*timeline, error) {
+	_, dateFacet := ctrl.facetOfType(facetTypeDate)
+	mapping, ok := ctrl.fieldMapping["date"]
+	if !ok || sr.QueryError != "" {
+		return newTimeline(map[string]int{}, edges, dateFacet), nil
+	}
+	counts, err := ctrl.termCounts(ctx, sr.queryString, sr.resultFilter(), "date", mapping.Field, "")
+	if err != nil {
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			return nil, errors.WithStack(err)
+		}
+		sr.QueryError = qErr.Error()
+		return newTimeline(map[string]int{}, edges, dateFacet), nil
+	}
+	return newTimeline(counts, edges, dateFacet), nil
+}
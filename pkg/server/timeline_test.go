@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestNewTimeline(t *testing.T) {
+	edges := []*searchEdge{{Date: "ca. 1985"}, {Date: "1987-03-12"}, {Date: "unbekannt"}}
+	tl := newTimeline(map[string]int{"ca. 1985": 4, "1987-03-12": 1, "1987": 2, "unbekannt": 3}, edges, true)
+	if tl.Decades || len(tl.Buckets) != 2 {
+		t.Fatalf("invalid timeline %+v", tl)
+	}
+	if b := tl.Buckets[0]; b.Label != "1985" || b.Value != "1985..1985" || b.Count != 4 || b.Height != 100 || len(b.Edges) != 1 {
+		t.Errorf("invalid bucket %+v", b)
+	}
+	if b := tl.Buckets[1]; b.Label != "1987" || b.Count != 3 || b.Height != 75 || len(b.Edges) != 1 {
+		t.Errorf("invalid bucket %+v", b)
+	}
+	if tl.Undated == nil || tl.Undated.Count != 3 || len(tl.Undated.Edges) != 1 {
+		t.Errorf("invalid undated bucket %+v", tl.Undated)
+	}
+
+	tl = newTimeline(map[string]int{"1968": 1, "1975": 2, "2001": 5}, nil, false)
+	if !tl.Decades || len(tl.Buckets) != 3 {
+		t.Fatalf("invalid timeline %+v", tl)
+	}
+	for i, label := range []string{"1960–1969", "1970–1979", "2000–2009"} {
+		if b := tl.Buckets[i]; b.Label != label || b.Value != "" {
+			t.Errorf("bucket %d is '%s' with value '%s', expected '%s'", i, b.Label, b.Value, label)
+		}
+	}
+	if tl.Undated != nil {
+		t.Errorf("unexpected undated bucket %+v", tl.Undated)
+	}
+
+	// without date counts the hits of the page are shown
+	tl = newTimeline(map[string]int{}, edges, true)
+	if len(tl.Buckets) != 2 || tl.Buckets[0].Count != 1 || tl.Undated == nil || tl.Undated.Count != 1 {
+		t.Errorf("invalid timeline %+v", tl)
+	}
+}
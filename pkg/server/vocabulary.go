@@ -0,0 +1,169 @@
+package server
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// vocGenericID is the root of the tags, which are not part of a vocabulary
+const vocGenericID = "generic"
+
+// vocTermPrefix marks the terms of a vocabulary path
+const vocTermPrefix = "voc_"
+
+// ratioRegexp matches aspect ratios like 16:9, which are plain tags
+var ratioRegexp = regexp.MustCompile(`^\d+:\d+$`)
+
+// vocNode is a term of the vocabulary tree.
+// Count is the number of hits tagged with the term itself, Total includes the counts of all descendants.
+// Total is an upper bound, hits with several terms of a subtree are counted more than once
+type vocNode struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Label    string     `json:"label"`
+	Count    int        `json:"count"`
+	Total    int        `json:"total"`
+	Checked  bool       `json:"checked"`
+	Excluded bool       `json:"excluded"`
+	Expanded bool       `json:"expanded"`
+	Children []*vocNode `json:"children,omitempty"`
+}
+
+// HasUnchecked returns true, if there is an unchecked term below the node
+func (n *vocNode) HasUnchecked() bool {
+	for _, child := range n.Children {
+		if (child.Count > 0 && !child.Checked && !child.Excluded) || child.HasUnchecked() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *vocNode) hasChecked() bool {
+	for _, child := range n.Children {
+		if child.Checked || child.Excluded || child.hasChecked() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *vocNode) child(id, name string) *vocNode {
+	for _, child := range n.Children {
+		if child.ID == id {
+			return child
+		}
+	}
+	child := &vocNode{ID: id, Name: name, Children: []*vocNode{}}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// vocPath returns the node ids and names of a tag.
+// Vocabulary tags look like scheme:voc_term:voc_subterm:..., other tags belong to the generic root.
+// Tags with a scheme, which are not vocabulary paths, are not part of the tree
+func vocPath(tag string) (ids []string, names []string, ok bool) {
+	parts := strings.Split(tag, ":")
+	if len(parts) == 1 || ratioRegexp.MatchString(tag) {
+		return []string{vocGenericID, tag}, []string{vocGenericID, tag}, true
+	}
+	for i := 1; i < len(parts); i++ {
+		if !strings.HasPrefix(parts[i], vocTermPrefix) {
+			return nil, nil, false
+		}
+		ids = append(ids, strings.Join(parts[:i+1], ":"))
+		names = append(names, parts[i])
+	}
+	return ids, names, true
+}
+
+// buildVocTree creates the vocabulary tree of the tag counts.
+// Excluded terms are not part of the counts, they are added without hits.
+// Nodes with selected or excluded descendants are expanded, the ids in expand toggle this state
+func buildVocTree(counts map[string]int, selected, excluded, expand []string, localize func(string) string) []*vocNode {
+	root := &vocNode{Children: []*vocNode{}}
+	add := func(tag string, count int) {
+		ids, names, ok := vocPath(tag)
+		if !ok {
+			return
+		}
+		node := root
+		for i, id := range ids {
+			node = node.child(id, names[i])
+		}
+		node.Count += count
+	}
+	for tag, count := range counts {
+		add(tag, count)
+	}
+	for _, tag := range excluded {
+		add(tag, 0)
+	}
+	var finish func(n *vocNode)
+	finish = func(n *vocNode) {
+		n.Label = localize(n.Name)
+		n.Checked = slices.Contains(selected, n.ID)
+		n.Excluded = slices.Contains(excluded, n.ID)
+		n.Total = n.Count
+		for _, child := range n.Children {
+			finish(child)
+			n.Total += child.Total
+		}
+		n.Expanded = n.hasChecked() != slices.Contains(expand, n.ID)
+		slices.SortStableFunc(n.Children, func(a, b *vocNode) int {
+			if c := strings.Compare(strings.ToLower(a.Label), strings.ToLower(b.Label)); c != 0 {
+				return c
+			}
+			return strings.Compare(a.ID, b.ID)
+		})
+	}
+	for _, child := range root.Children {
+		finish(child)
+		// the roots are the headings of the facet
+		child.Expanded = true
+	}
+	// the generic tags are listed last
+	slices.SortStableFunc(root.Children, func(a, b *vocNode) int {
+		if (a.ID == vocGenericID) != (b.ID == vocGenericID) {
+			if a.ID == vocGenericID {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(strings.ToLower(a.Label), strings.ToLower(b.Label))
+	})
+	return root.Children
+}
+
+// checkedVocNodes returns the selected and excluded terms of the tree in display order
+func checkedVocNodes(nodes []*vocNode) []*vocNode {
+	result := []*vocNode{}
+	for _, n := range nodes {
+		if n.Checked || n.Excluded {
+			result = append(result, n)
+		}
+		result = append(result, checkedVocNodes(n.Children)...)
+	}
+	return result
+}
+
+// topVocTerms returns the n most frequent terms of the tag counts, which are part of the vocabulary tree
+func topVocTerms(counts map[string]int, n int, localize func(string) string) []*vocNode {
+	result := []*vocNode{}
+	for tag, count := range counts {
+		ids, names, ok := vocPath(tag)
+		if !ok || count == 0 {
+			continue
+		}
+		name := names[len(names)-1]
+		result = append(result, &vocNode{ID: ids[len(ids)-1], Name: name, Label: localize(name), Count: count, Total: count})
+	}
+	slices.SortFunc(result, func(a, b *vocNode) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return result[:min(n, len(result))]
+}
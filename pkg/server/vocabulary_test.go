@@ -0,0 +1,91 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVocPath(t *testing.T) {
+	for tag, want := range map[string]string{
+		"plain":                   "generic/plain",
+		"16:9":                    "generic/16:9",
+		"voc:voc_a":               "voc:voc_a",
+		"voc:voc_a:voc_b:voc_c":   "voc:voc_a/voc:voc_a:voc_b/voc:voc_a:voc_b:voc_c",
+		"vww:intern":              "",
+		"voc:voc_a:other":         "",
+		"zotero2:voc_a:voc_b:x:y": "",
+	} {
+		ids, _, ok := vocPath(tag)
+		if got := strings.Join(ids, "/"); got != want || ok != (want != "") {
+			t.Errorf("vocPath(%s) = '%s', %v, want '%s'", tag, got, ok, want)
+		}
+	}
+}
+
+func TestBuildVocTree(t *testing.T) {
+	labels := map[string]string{"voc_tanzen": "Tanzen", "voc_wild": "wild", "voc_sehr": "sehr", "voc_stumm": "Stumm", "generic": "Allgemein"}
+	localize := func(key string) string {
+		if label, ok := labels[key]; ok {
+			return label
+		}
+		return key
+	}
+	counts := map[string]int{
+		"voc:voc_tanzen:voc_wild":          5,
+		"voc:voc_tanzen:voc_wild:voc_sehr": 2,
+		"voc:voc_tanzen:voc_stumm":         3,
+		"16:9":                             4,
+		"vww:intern":                       8,
+	}
+	tree := buildVocTree(counts, []string{"voc:voc_tanzen:voc_wild:voc_sehr"}, nil, nil, localize)
+	if len(tree) != 2 || tree[0].Label != "Tanzen" || tree[1].ID != vocGenericID {
+		t.Fatalf("invalid roots %+v", tree)
+	}
+	tanzen := tree[0]
+	if tanzen.Total != 10 || tanzen.Count != 0 {
+		t.Errorf("tanzen count %d, total %d, want 0, 10", tanzen.Count, tanzen.Total)
+	}
+	if len(tanzen.Children) != 2 || tanzen.Children[0].Label != "Stumm" || tanzen.Children[1].Label != "wild" {
+		t.Fatalf("invalid order %+v", tanzen.Children)
+	}
+	wild := tanzen.Children[1]
+	if wild.Count != 5 || wild.Total != 7 || !wild.Expanded || !wild.Children[0].Checked {
+		t.Errorf("invalid node wild %+v", wild)
+	}
+	if checked := checkedVocNodes(tree); len(checked) != 1 || checked[0].Label != "sehr" {
+		t.Errorf("invalid checked nodes %+v", checked)
+	}
+	if !tanzen.HasUnchecked() {
+		t.Error("tanzen has unchecked terms")
+	}
+
+	// the expand list toggles the state
+	tree = buildVocTree(counts, []string{"voc:voc_tanzen:voc_wild:voc_sehr"}, nil, []string{"voc:voc_tanzen:voc_wild"}, localize)
+	if tree[0].Children[1].Expanded {
+		t.Error("wild must be collapsed")
+	}
+	tree = buildVocTree(counts, nil, nil, []string{"voc:voc_tanzen:voc_wild"}, localize)
+	if !tree[0].Children[1].Expanded {
+		t.Error("wild must be expanded")
+	}
+
+	// excluded terms are not counted, but part of the tree
+	tree = buildVocTree(counts, nil, []string{"voc:voc_tanzen:voc_laut"}, nil, localize)
+	checked := checkedVocNodes(tree)
+	if len(checked) != 1 || !checked[0].Excluded || checked[0].Count != 0 || !tree[0].Expanded {
+		t.Errorf("invalid excluded nodes %+v", checked)
+	}
+}
+
+func TestTopVocTerms(t *testing.T) {
+	counts := map[string]int{
+		"voc:voc_tanzen":          4,
+		"voc:voc_tanzen:voc_wild": 9,
+		"16:9":                    4,
+		"vww:1234":                20,
+	}
+	terms := topVocTerms(counts, 2, func(key string) string { return strings.TrimPrefix(key, "voc_") })
+	if len(terms) != 2 || terms[0].ID != "voc:voc_tanzen:voc_wild" || terms[0].Label != "wild" || terms[1].ID != "16:9" {
+		t.Errorf("invalid terms %+v", terms)
+	}
+}